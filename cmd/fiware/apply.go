@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/warpcomdev/fiware/internal/config"
+	"github.com/warpcomdev/fiware/internal/diff"
+	"github.com/warpcomdev/fiware/internal/snapshots"
+)
+
+// applyResource reconciles the live subservice with a manifest
+func applyResource(c *cli.Context, store *config.Store) error {
+	live, err := newLiveDiff(c, store)
+	if err != nil {
+		return err
+	}
+
+	// Without prune, resources missing from the manifest are left alone
+	prune := c.Bool(pruneFlag.Name)
+	report, kept := live.Report, 0
+	if !prune {
+		report = diff.Report{Resources: make([]diff.Resource, 0, len(live.Report.Resources))}
+		for _, res := range live.Report.Resources {
+			if res.Action == diff.Removed {
+				kept += 1
+				continue
+			}
+			report.Resources = append(report.Resources, res)
+		}
+	}
+
+	if report.Empty() {
+		fmt.Println("nothing to apply")
+	} else if err := report.Write(os.Stdout); err != nil {
+		return err
+	}
+	if kept > 0 {
+		fmt.Printf("%d resources not in the manifest were kept, use --%s to delete them\n", kept, pruneFlag.Name)
+	}
+	if report.Empty() {
+		return nil
+	}
+	if removed := countRemoved(report); removed > 0 {
+		question := fmt.Sprintf("About to delete %d resources not in the manifest from subservice %s", removed, live.Selected.Subservice)
+		if err := confirmDeletion(c, question); err != nil {
+			return err
+		}
+	}
+
+	return snapshots.Apply(dryRun(c, live.Client), live.Selected, live.Header, live.Manifest, report, snapshots.ApplyOptions{
+		Prune:     prune,
+		BatchSize: c.Int(batchSizeFlag.Name),
+		Endpoints: live.Endpoints,
+	})
+}
+
+// countRemoved counts the resources that the report deletes
+func countRemoved(report diff.Report) int {
+	removed := 0
+	for _, res := range report.Resources {
+		if res.Action == diff.Removed {
+			removed += 1
+		}
+	}
+	return removed
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/warpcomdev/fiware/internal/diff"
+	"github.com/warpcomdev/fiware/internal/perseo"
+	"github.com/warpcomdev/fiware/models"
+)
+
+// diffReport runs the diff command, and decodes the json report
+func diffReport(t *testing.T, store, datafile string) diff.Report {
+	t.Helper()
+	output := filepath.Join(t.TempDir(), "report.json")
+	mustRunCLI(t, store, "diff", "-d", datafile, "-o", output)
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report diff.Report
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatalf("failed to decode report: %v", err)
+	}
+	return report
+}
+
+func testRule(name, text string) models.Rule {
+	return models.Rule{
+		Name:   name,
+		Text:   text,
+		Action: json.RawMessage(`[{"type":"update","parameters":{"attributes":[{"name":"alarm","value":"true"}]}}]`),
+	}
+}
+
+func TestApplySubscriptions(t *testing.T) {
+	_, _, store := testPlatform(t, "/riego")
+	manifest := models.Manifest{
+		Environment: models.Environment{NotificationEndpoints: map[string]string{"LASTDATA": "http://cygnus:5051/notify"}},
+		Subscriptions: map[string]models.Subscription{"lastdata": {
+			Description: "lastdata sensors",
+			Subject: models.Subject{
+				Entities: []models.SubjectEntity{{IdPattern: ".*", Type: "Sensor"}},
+			},
+			Notification: models.Notification{
+				Attrs:      []string{"temperature"},
+				HTTPCustom: models.NotificationCustom{URL: "LASTDATA"},
+			},
+		}},
+	}
+	datafile := writeJSON(t, "manifest.json", manifest)
+	if report := diffReport(t, store, datafile); report.Count(diff.Added) != 1 {
+		t.Fatalf("expected the subscription to be added, got %+v", report.Resources)
+	}
+
+	mustRunCLI(t, store, "apply", "-d", datafile)
+	// The live subscription has an ID, status and resolved URL
+	if report := diffReport(t, store, datafile); !report.Empty() {
+		t.Errorf("expected no differences after apply, got %+v", report.Resources)
+	}
+}
+
+func TestApplyPrune(t *testing.T) {
+	platform, cfg, store := testPlatform(t, "/riego")
+	current := models.Manifest{Rules: map[string]models.Rule{
+		"alarm": testRule("alarm", `select * from iotEvent where type="Sensor" and temperature? > 30`),
+		"old":   testRule("old", `select * from iotEvent where type="Sensor"`),
+	}}
+	mustRunCLI(t, store, "post", "-d", writeJSON(t, "current.json", current), "rules")
+
+	desired := models.Manifest{Rules: map[string]models.Rule{
+		"alarm": testRule("alarm", `select * from iotEvent where type="Sensor" and temperature? > 35`),
+	}}
+	datafile := writeJSON(t, "desired.json", desired)
+	api, err := perseo.New(cfg.PerseoURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	liveRules := func() map[string]models.Rule {
+		t.Helper()
+		rules, err := api.Rules(http.DefaultClient, platform.Headers("/riego"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		byName := make(map[string]models.Rule, len(rules))
+		for _, rule := range rules {
+			byName[rule.Name] = rule
+		}
+		return byName
+	}
+
+	// Without prune, rules not in the manifest are kept
+	mustRunCLI(t, store, "apply", "-d", datafile)
+	live := liveRules()
+	if _, found := live["old"]; !found || live["alarm"].Text != desired.Rules["alarm"].Text {
+		t.Fatalf("expected alarm updated and old kept, got %+v", live)
+	}
+
+	// Prune must be confirmed
+	withStdin(t, "n\n")
+	if err := runCLI(t, store, "apply", "--prune", "-d", datafile); err == nil {
+		t.Error("expected the prune to be cancelled")
+	}
+	if _, found := liveRules()["old"]; !found {
+		t.Fatal("cancelled prune must not delete rules")
+	}
+
+	mustRunCLI(t, store, "apply", "--prune", "--yes", "-d", datafile)
+	if live := liveRules(); len(live) != 1 {
+		t.Errorf("expected old rule to be pruned, got %+v", live)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/warpcomdev/fiware/internal/audit"
+	"github.com/warpcomdev/fiware/internal/config"
+	"github.com/warpcomdev/fiware/keystone"
+)
+
+var canAudit []string = []string{
+	"roles",
+}
+
+// auditResource audits the platform and writes a report
+func auditResource(c *cli.Context, store *config.Store) error {
+	if c.NArg() <= 0 {
+		return fmt.Errorf("select a resource from: %s", strings.Join(canAudit, ", "))
+	}
+	selected, err := getConfig(c, store)
+	if err != nil {
+		return err
+	}
+	k, header, err := getKeystoneHeaders(c, &selected)
+	if err != nil {
+		return err
+	}
+	output := outputFile(c.String(outputFlag.Name))
+	outfile, err := output.Create()
+	if err != nil {
+		return err
+	}
+	defer outfile.Close()
+
+	client := withSession(c, store, selected, httpClient(verbosity(c), configuredTimeout(c), configuredBackoff(c, selected)))
+	for _, arg := range c.Args().Slice() {
+		switch arg {
+		case "roles":
+			domains := auditDomains(c, client, k, header, selected)
+			report := audit.Roles(client, k, header, domains)
+			for _, domain := range report.Domains {
+				if domain.Error != "" {
+					fmt.Fprintf(os.Stderr, "[%s] failed: %s\n", domain.Name, domain.Error)
+				} else {
+					fmt.Fprintf(os.Stderr, "[%s] %d users, %d groups, %d findings\n", domain.Name, domain.Users, domain.Groups, domain.Findings)
+				}
+			}
+			if strings.HasSuffix(strings.ToLower(string(output)), ".csv") {
+				err = report.WriteCSV(outfile)
+			} else {
+				err = report.WriteJSON(outfile)
+			}
+			if err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("don't know how to audit resource %s", arg)
+		}
+	}
+	return nil
+}
+
+// auditDomains returns the domain selected in the command line, or all
+// the domains (but admin_domain, unless requested) if none selected.
+func auditDomains(c *cli.Context, client keystone.HTTPClient, k *keystone.Keystone, header http.Header, selected config.Config) []string {
+	if domain := c.String(domainFlag.Name); domain != "" {
+		return []string{domain}
+	}
+	all, err := k.Domains(client, header, true)
+	if err != nil {
+		// Only cloud admins can list domains, fall back to our own
+		log.Printf("Failed to list domains, auditing only domain %s: %v", selected.Service, err)
+		return []string{selected.Service}
+	}
+	domains := make([]string, 0, len(all))
+	for _, domain := range all {
+		if domain.Name != "admin_domain" || c.Bool(adminDomainFlag.Name) {
+			domains = append(domains, domain.Name)
+		}
+	}
+	return domains
+}
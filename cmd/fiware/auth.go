@@ -11,6 +11,7 @@ import (
 	"strings"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/urfave/cli/v2"
 
@@ -85,13 +86,13 @@ func getCredentials(c *cli.Context, selected *config.Config, backoff keystone.Ba
 	if err != nil {
 		return err
 	}
-	client := httpClient(verbosity(c), configuredTimeout(c))
-	fiwareToken, urboToken, userId, err := getTokens(client, k, selected, string(bytepw), backoff, getProjects)
+	client := httpClient(verbosity(c), configuredTimeout(c), configuredBackoff(c, *selected))
+	fiwareToken, urboToken, userId, expiry, err := getTokens(client, k, selected, string(bytepw), backoff, getProjects)
 	if err != nil {
 		return err
 	}
 	if saveCreds {
-		selected.SetCredentials(fiwareToken, urboToken)
+		selected.SetCredentials(fiwareToken, urboToken, expiry)
 	} else {
 		if runtime.GOOS == "windows" {
 			fmt.Printf("SET FIWARE_USERID=%s\nSET FIWARE_TOKEN=%s\nSET URBO_TOKEN=%s\n", userId, fiwareToken, urboToken)
@@ -122,15 +123,16 @@ func cacheProjects(selected *config.Config, projects []models.Project) error {
 	return nil
 }
 
-func getTokens(client keystone.HTTPClient, api *keystone.Keystone, selected *config.Config, password string, backoff keystone.Backoff, getProjects bool) (string, string, string, error) {
+func getTokens(client keystone.HTTPClient, api *keystone.Keystone, selected *config.Config, password string, backoff keystone.Backoff, getProjects bool) (string, string, string, time.Time, error) {
 	var fiwareToken, urboToken, userId string
+	var expiry time.Time
 	var fiwareError, urboError error
 	wg := sync.WaitGroup{}
 	wg.Add(1)
 	go func() {
 		// get fiware token and user id
 		defer wg.Done()
-		fiwareToken, userId, fiwareError = api.Login(client, password, backoff)
+		fiwareToken, userId, expiry, fiwareError = api.LoginWithExpiry(client, password, backoff)
 		if fiwareError != nil {
 			return
 		}
@@ -143,7 +145,7 @@ func getTokens(client keystone.HTTPClient, api *keystone.Keystone, selected *con
 		wg.Add(1)
 		u, err := urbo.New(selected.UrboURL, selected.Username, selected.Service, selected.Service)
 		if err != nil {
-			return "", "", "", err
+			return "", "", "", time.Time{}, err
 		}
 		go func() {
 			defer wg.Done()
@@ -152,12 +154,12 @@ func getTokens(client keystone.HTTPClient, api *keystone.Keystone, selected *con
 	}
 	wg.Wait()
 	if fiwareError != nil {
-		return "", "", "", fiwareError
+		return "", "", "", time.Time{}, fiwareError
 	}
 	if urboError != nil {
-		return "", "", "", urboError
+		return "", "", "", time.Time{}, urboError
 	}
-	return fiwareToken, urboToken, userId, nil
+	return fiwareToken, urboToken, userId, expiry, nil
 }
 
 func authServe(client keystone.HTTPClient, store *config.Store, backoff keystone.Backoff) http.Handler {
@@ -198,12 +200,12 @@ func authServe(client keystone.HTTPClient, store *config.Store, backoff keystone
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		fiwareToken, urboToken, _, err := getTokens(client, k, &selected, password, backoff, false)
+		fiwareToken, urboToken, _, expiry, err := getTokens(client, k, &selected, password, backoff, false)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusNotFound)
 			return
 		}
-		selected.SetCredentials(fiwareToken, urboToken)
+		selected.SetCredentials(fiwareToken, urboToken, expiry)
 		w.Header().Add("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		enc := json.NewEncoder(w)
@@ -1,9 +1,14 @@
 package main
 
 import (
+	"bufio"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"maps"
 	"net/http"
+	"os"
 	"slices"
 	"strings"
 
@@ -12,6 +17,7 @@ import (
 	"github.com/warpcomdev/fiware/internal/config"
 	"github.com/warpcomdev/fiware/internal/importer"
 	"github.com/warpcomdev/fiware/internal/perseo"
+	"github.com/warpcomdev/fiware/internal/urbo"
 	"github.com/warpcomdev/fiware/iotam"
 	"github.com/warpcomdev/fiware/keystone"
 	"github.com/warpcomdev/fiware/models"
@@ -22,13 +28,23 @@ var canDelete []string = []string{
 	"services",
 	"devices",
 	"suscriptions",
+	"registrations",
 	"rules",
 	"entities",
+	"attributes",
+	"users",
+	"usergroups",
+	"projects",
+	"userroles",
+	"grouproles",
+	"assignments",
+	"verticals",
+	"panels",
 }
 
 func deleteResource(c *cli.Context, store *config.Store) error {
 	if c.NArg() <= 0 {
-		return fmt.Errorf("select a resource from: %s", strings.Join(canPost, ", "))
+		return fmt.Errorf("select a resource from: %s", strings.Join(canDelete, ", "))
 	}
 
 	selected, err := getConfig(c, store)
@@ -36,15 +52,21 @@ func deleteResource(c *cli.Context, store *config.Store) error {
 		return err
 	}
 
+	// Without a data file, entities can be deleted by query
+	var manifest models.Manifest
 	datapath, libpath := c.String(dataFlag.Name), c.String(libFlag.Name)
-	manifest, err := importer.Load(datapath, selected.Params, libpath)
-	if err != nil {
-		return err
+	if datapath != "" {
+		if manifest, err = importer.Load(datapath, selected.Params, libpath); err != nil {
+			return err
+		}
 	}
 
 	batchSize := c.Int(batchSizeFlag.Name)
-	client := httpClient(verbosity(c), configuredTimeout(c))
+	client := dryRun(c, withSession(c, store, selected, httpClient(verbosity(c), configuredTimeout(c), configuredBackoff(c, selected))))
 	for _, arg := range c.Args().Slice() {
+		if datapath == "" && arg != "entities" && arg != "attributes" {
+			return fmt.Errorf("--%s is required to delete %s", dataFlag.Name, arg)
+		}
 		var header http.Header
 		switch arg {
 		case "devices":
@@ -75,6 +97,14 @@ func deleteResource(c *cli.Context, store *config.Store) error {
 			if err := deleteSuscriptions(selected, client, header, manifest, useDescription); err != nil {
 				return err
 			}
+		case "registrations":
+			if _, header, err = getKeystoneHeaders(c, &selected); err != nil {
+				return err
+			}
+			useDescription := !c.Bool(useExactIdFlag.Name)
+			if err := deleteRegistrations(selected, client, header, manifest, useDescription); err != nil {
+				return err
+			}
 		case "rules":
 			if _, header, err = getKeystoneHeaders(c, &selected); err != nil {
 				return err
@@ -86,6 +116,12 @@ func deleteResource(c *cli.Context, store *config.Store) error {
 			if _, header, err = getKeystoneHeaders(c, &selected); err != nil {
 				return err
 			}
+			if datapath == "" {
+				if err := deleteEntitiesByQuery(c, selected, client, header, batchSize); err != nil {
+					return err
+				}
+				continue
+			}
 			filterManifest, err := filterEntities(c, manifest)
 			if err != nil {
 				return err
@@ -93,6 +129,71 @@ func deleteResource(c *cli.Context, store *config.Store) error {
 			if err := deleteEntities(selected, client, header, filterManifest, batchSize); err != nil {
 				return err
 			}
+		case "attributes":
+			if _, header, err = getKeystoneHeaders(c, &selected); err != nil {
+				return err
+			}
+			if err := deleteAttributes(c, selected, client, header, batchSize); err != nil {
+				return err
+			}
+		case "users":
+			var k *keystone.Keystone
+			if k, header, err = getKeystoneHeaders(c, &selected); err != nil {
+				return err
+			}
+			if err := deleteUsers(k, client, header, manifest); err != nil {
+				return err
+			}
+		case "usergroups":
+			fallthrough
+		case "user_groups":
+			var k *keystone.Keystone
+			if k, header, err = getKeystoneHeaders(c, &selected); err != nil {
+				return err
+			}
+			if err := deleteGroups(k, client, header, manifest); err != nil {
+				return err
+			}
+		case "projects":
+			var k *keystone.Keystone
+			if k, header, err = getKeystoneHeaders(c, &selected); err != nil {
+				return err
+			}
+			if err := deleteProjects(k, client, header, manifest); err != nil {
+				return err
+			}
+		case "userroles":
+			fallthrough
+		case "user_roles":
+			fallthrough
+		case "grouproles":
+			fallthrough
+		case "group_roles":
+			fallthrough
+		case "assignments":
+			var k *keystone.Keystone
+			if k, header, err = getKeystoneHeaders(c, &selected); err != nil {
+				return err
+			}
+			if err := deleteAssignments(k, client, header, manifest); err != nil {
+				return err
+			}
+		case "verticals":
+			var u *urbo.Urbo
+			if u, header, err = getUrboHeaders(c, &selected); err != nil {
+				return err
+			}
+			if err := deleteVerticals(u, client, header, manifest); err != nil {
+				return err
+			}
+		case "panels":
+			var u *urbo.Urbo
+			if u, header, err = getUrboHeaders(c, &selected); err != nil {
+				return err
+			}
+			if err := deletePanels(u, client, header, manifest); err != nil {
+				return err
+			}
 		default:
 			return fmt.Errorf("don't know how to delete resource %s", arg)
 		}
@@ -123,7 +224,7 @@ func deleteServices(ctx config.Config, client keystone.HTTPClient, header http.H
 }
 
 func deleteSuscriptions(ctx config.Config, client keystone.HTTPClient, header http.Header, vertical models.Manifest, useDescription bool) error {
-	api, err := orion.New(ctx.OrionURL)
+	api, err := orion.NewDialect(ctx.OrionURL, ctx.NGSI, ctx.LDContext)
 	if err != nil {
 		return err
 	}
@@ -143,6 +244,21 @@ func deleteSuscriptions(ctx config.Config, client keystone.HTTPClient, header ht
 	return api.DeleteSuscriptions(client, header, slices.Collect(maps.Values(vertical.Subscriptions)), useDescription)
 }
 
+func deleteRegistrations(ctx config.Config, client keystone.HTTPClient, header http.Header, vertical models.Manifest, useDescription bool) error {
+	api, err := orion.NewDialect(ctx.OrionURL, ctx.NGSI, ctx.LDContext)
+	if err != nil {
+		return err
+	}
+	listMessage("DELETing registrations with ids (or descriptions)", vertical.Registrations,
+		func(r models.Registration) string {
+			if r.ID != "" {
+				return fmt.Sprintf("%s (%s)", r.ID, r.Description)
+			}
+			return r.Description
+		})
+	return api.DeleteRegistrations(client, header, vertical.Registrations, useDescription)
+}
+
 func deleteRules(ctx config.Config, client keystone.HTTPClient, header http.Header, vertical models.Manifest) error {
 	api, err := perseo.New(ctx.PerseoURL)
 	if err != nil {
@@ -159,6 +275,70 @@ func deleteRules(ctx config.Config, client keystone.HTTPClient, header http.Head
 	return api.DeleteRules(client, header, slices.Collect(maps.Values(vertical.Rules)))
 }
 
+func deleteUsers(k *keystone.Keystone, client keystone.HTTPClient, header http.Header, vertical models.Manifest) error {
+	listMessage("DELETing users with names", vertical.Users,
+		func(u models.User) string { return u.Name })
+	return k.DeleteUsers(client, header, vertical.Users)
+}
+
+func deleteGroups(k *keystone.Keystone, client keystone.HTTPClient, header http.Header, vertical models.Manifest) error {
+	listMessage("DELETing groups with names", vertical.Groups,
+		func(g models.Group) string { return g.Name })
+	return k.DeleteGroups(client, header, vertical.Groups)
+}
+
+func deleteProjects(k *keystone.Keystone, client keystone.HTTPClient, header http.Header, vertical models.Manifest) error {
+	listMessage("DELETing projects with names", vertical.Projects,
+		func(p models.Project) string { return p.Name })
+	return k.DeleteProjects(client, header, vertical.Projects)
+}
+
+func deleteAssignments(k *keystone.Keystone, client keystone.HTTPClient, header http.Header, vertical models.Manifest) error {
+	listMessage("DELETing role assignments", vertical.Assignments,
+		func(a models.RoleAssignment) string {
+			actor := a.User.Name
+			if actor == "" {
+				actor = a.Group.Name
+			}
+			return fmt.Sprintf("%s [%s: %s]", actor, a.ScopeName, a.Role.Name)
+		})
+	return k.DeleteAssignments(client, header, vertical.Assignments)
+}
+
+func deleteVerticals(u *urbo.Urbo, client keystone.HTTPClient, header http.Header, vertical models.Manifest) error {
+	dictMessage("DELETing verticals with slugs", vertical.Verticals,
+		func(k string, v models.Vertical) string { return v.Slug },
+	)
+	errList := make([]error, 0, len(vertical.Verticals))
+	for k, v := range vertical.Verticals {
+		slug := v.Slug
+		if slug == "" {
+			slug = k
+		}
+		if err := u.DeleteVertical(client, header, slug); err != nil {
+			errList = append(errList, fmt.Errorf("while deleting vertical %s: %w", slug, err))
+		}
+	}
+	return errors.Join(errList...)
+}
+
+func deletePanels(u *urbo.Urbo, client keystone.HTTPClient, header http.Header, vertical models.Manifest) error {
+	dictMessage("DELETing panels with slugs", vertical.Panels,
+		func(k string, v models.UrboPanel) string { return v.Slug },
+	)
+	errList := make([]error, 0, len(vertical.Panels))
+	for k, p := range vertical.Panels {
+		slug := p.Slug
+		if slug == "" {
+			slug = k
+		}
+		if err := u.DeletePanel(client, header, slug); err != nil {
+			errList = append(errList, fmt.Errorf("while deleting panel %s: %w", slug, err))
+		}
+	}
+	return errors.Join(errList...)
+}
+
 func knownEntities(vertical models.Manifest) []models.Entity {
 	knownTypes := make(map[string]struct{})
 	for _, entType := range vertical.EntityTypes {
@@ -173,8 +353,108 @@ func knownEntities(vertical models.Manifest) []models.Entity {
 	return knownEntities
 }
 
+// deleteEntitiesByQuery deletes the entities that match the filters in
+// the command line, after asking for confirmation. Only the ID and type
+// of the matching entities are kept in memory.
+func deleteEntitiesByQuery(c *cli.Context, ctx config.Config, client keystone.HTTPClient, header http.Header, batchSize int) error {
+	filterId := c.String(filterIdFlag.Name)
+	filterType := c.String(filterTypeFlag.Name)
+	simpleQuery := c.String(simpleQueryFlag.Name)
+	if filterId == "" && filterType == "" && simpleQuery == "" {
+		return fmt.Errorf("either --%s or some filter (--%s, --%s, --%s) is required to delete entities",
+			dataFlag.Name, filterTypeFlag.Name, filterIdFlag.Name, simpleQueryFlag.Name)
+	}
+	api, err := orion.NewDialect(ctx.OrionURL, ctx.NGSI, ctx.LDContext)
+	if err != nil {
+		return err
+	}
+	var toDelete []models.Entity
+	err = api.StreamEntities(client, header, filterId, filterType, simpleQuery, 0, func(ent orion.Entity) error {
+		toDelete = append(toDelete, models.Entity{ID: ent.ID(), Type: ent.Type()})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("while reading entities: %w", err)
+	}
+	if len(toDelete) <= 0 {
+		fmt.Println("no entities match the filters")
+		return nil
+	}
+	question := fmt.Sprintf("About to delete %d entities from subservice %s", len(toDelete), ctx.Subservice)
+	if err := confirmDeletion(c, question); err != nil {
+		return err
+	}
+	fmt.Printf("DELETing %d entities\n", len(toDelete))
+	return api.DeleteEntities(client, header, toDelete, batchSize)
+}
+
+// deleteAttributes deletes the attributes selected in the command line
+// from all the entities of a type, keeping the entities themselves.
+func deleteAttributes(c *cli.Context, ctx config.Config, client keystone.HTTPClient, header http.Header, batchSize int) error {
+	attrs := c.StringSlice(attrFlag.Name)
+	filterType := c.String(filterTypeFlag.Name)
+	if len(attrs) <= 0 || filterType == "" {
+		return fmt.Errorf("--%s and --%s are required to delete attributes", filterTypeFlag.Name, attrFlag.Name)
+	}
+	api, err := orion.NewDialect(ctx.OrionURL, ctx.NGSI, ctx.LDContext)
+	if err != nil {
+		return err
+	}
+	// Only ask orion to delete the attributes each entity actually has
+	var (
+		toDelete []models.Entity
+		count    int
+	)
+	filterId, simpleQuery := c.String(filterIdFlag.Name), c.String(simpleQueryFlag.Name)
+	err = api.StreamEntities(client, header, filterId, filterType, simpleQuery, 0, func(ent orion.Entity) error {
+		current := ent.Attrs()
+		found := make(map[string]json.RawMessage, len(attrs))
+		for _, name := range attrs {
+			if _, ok := current[name]; ok {
+				found[name] = nil
+			}
+		}
+		if len(found) > 0 {
+			toDelete = append(toDelete, models.Entity{ID: ent.ID(), Type: ent.Type(), Attrs: found})
+			count += len(found)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("while reading entities: %w", err)
+	}
+	if len(toDelete) <= 0 {
+		fmt.Printf("no entities of type %s have attributes %s\n", filterType, strings.Join(attrs, ", "))
+		return nil
+	}
+	question := fmt.Sprintf("About to delete %d attributes from %d entities of type %s in subservice %s", count, len(toDelete), filterType, ctx.Subservice)
+	if err := confirmDeletion(c, question); err != nil {
+		return err
+	}
+	fmt.Printf("DELETing %d attributes from %d entities\n", count, len(toDelete))
+	return api.DeleteAttributes(client, header, toDelete, batchSize)
+}
+
+// confirmDeletion asks the user to confirm a deletion, in the terminal.
+// The question is skipped with --yes or --dry-run.
+func confirmDeletion(c *cli.Context, question string) error {
+	if c.Bool(yesFlag.Name) || c.Bool(dryRunFlag.Name) {
+		return nil
+	}
+	fmt.Fprintf(os.Stderr, "%s. Continue? [y/N]: ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	if answer != "y" && answer != "yes" {
+		return errors.New("deletion cancelled")
+	}
+	return nil
+}
+
 func deleteEntities(ctx config.Config, client keystone.HTTPClient, header http.Header, vertical models.Manifest, batchSize int) error {
-	api, err := orion.New(ctx.OrionURL)
+	api, err := orion.NewDialect(ctx.OrionURL, ctx.NGSI, ctx.LDContext)
 	if err != nil {
 		return err
 	}
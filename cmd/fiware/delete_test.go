@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/warpcomdev/fiware/internal/config"
+	"github.com/warpcomdev/fiware/internal/fakeplatform"
+	"github.com/warpcomdev/fiware/keystone"
+	"github.com/warpcomdev/fiware/models"
+	"github.com/warpcomdev/fiware/orion"
+)
+
+// withStdin replaces the standard input with the given text,
+// while the test runs
+func withStdin(t *testing.T, text string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "stdin")
+	if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdin := os.Stdin
+	os.Stdin = file
+	t.Cleanup(func() {
+		os.Stdin = stdin
+		file.Close()
+	})
+}
+
+// sensorPlatform starts a platform with some Sensor entities in /riego
+func sensorPlatform(t *testing.T) (*fakeplatform.Platform, config.Config, string) {
+	t.Helper()
+	platform, cfg, store := testPlatform(t, "/riego")
+	for _, entity := range []string{
+		`{"id":"s1","type":"Sensor","temperature":{"type":"Number","value":20},"humidity":{"type":"Number","value":50}}`,
+		`{"id":"s2","type":"Sensor","temperature":{"type":"Number","value":35},"humidity":{"type":"Number","value":40}}`,
+		`{"id":"p1","type":"Pump","flow":{"type":"Number","value":3}}`,
+	} {
+		if err := platform.AddEntity("/riego", json.RawMessage(entity)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return platform, cfg, store
+}
+
+func TestDeleteEntitiesFromManifest(t *testing.T) {
+	platform, cfg, store := sensorPlatform(t)
+	manifest := models.Manifest{
+		EntityTypes: []models.EntityType{testEntityType("Sensor")},
+		Entities:    []models.Entity{{ID: "s1", Type: "Sensor"}},
+	}
+	mustRunCLI(t, store, "delete", "-d", writeJSON(t, "manifest.json", manifest), "entities")
+
+	live := liveEntities(t, cfg, platform.Headers("/riego"))
+	if _, found := live["s1"]; found || len(live) != 2 {
+		t.Errorf("expected only s1 to be deleted, got %v", live)
+	}
+}
+
+func TestDeleteEntitiesByQuery(t *testing.T) {
+	platform, cfg, store := sensorPlatform(t)
+	mustRunCLI(t, store, "delete", "--filter-type", "Sensor", "--simple-query", "temperature==35", "--yes", "entities")
+
+	live := liveEntities(t, cfg, platform.Headers("/riego"))
+	if _, found := live["s2"]; found || len(live) != 2 {
+		t.Errorf("expected only s2 to be deleted, got %v", live)
+	}
+}
+
+func TestDeleteEntitiesByQueryCancelled(t *testing.T) {
+	platform, cfg, store := sensorPlatform(t)
+	withStdin(t, "n\n")
+	if err := runCLI(t, store, "delete", "--filter-type", "Sensor", "entities"); err == nil {
+		t.Error("expected the deletion to be cancelled")
+	}
+	if live := liveEntities(t, cfg, platform.Headers("/riego")); len(live) != 3 {
+		t.Errorf("expected no entities deleted, got %d left", len(live))
+	}
+}
+
+func TestDeleteEntitiesRequiresFilter(t *testing.T) {
+	_, _, store := sensorPlatform(t)
+	err := runCLI(t, store, "delete", "--yes", "entities")
+	if err == nil || !strings.Contains(err.Error(), "is required") {
+		t.Errorf("deleting entities without a manifest or filters must fail, got %v", err)
+	}
+}
+
+func TestDeleteAttributes(t *testing.T) {
+	platform, cfg, store := sensorPlatform(t)
+	mustRunCLI(t, store, "delete", "--filter-type", "Sensor", "--attr", "humidity", "--yes", "attributes")
+
+	live := liveEntities(t, cfg, platform.Headers("/riego"))
+	if len(live) != 3 {
+		t.Fatalf("attributes must be deleted without deleting entities, got %d", len(live))
+	}
+	for _, id := range []string{"s1", "s2"} {
+		if _, found := live[id].Attrs["humidity"]; found {
+			t.Errorf("expected humidity to be deleted from %s", id)
+		}
+		if _, found := live[id].Attrs["temperature"]; !found {
+			t.Errorf("expected temperature to be kept in %s", id)
+		}
+	}
+}
+
+func TestDeleteRegistrationsWithoutID(t *testing.T) {
+	platform, cfg, store := testPlatform(t, "/riego")
+	api, err := orion.New(cfg.OrionURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers := platform.Headers("/riego")
+	regs := []models.Registration{{
+		Description:  "weather provider",
+		DataProvided: json.RawMessage(`{"entities":[{"idPattern":".*","type":"Weather"}],"attrs":["temperature"]}`),
+		Provider:     json.RawMessage(`{"http":{"url":"http://provider:8080"}}`),
+	}}
+	if err := api.PostRegistrations(http.DefaultClient, headers, regs, false); err != nil {
+		t.Fatal(err)
+	}
+	live, err := api.Registrations(http.DefaultClient, headers)
+	if err != nil || len(live) != 1 {
+		t.Fatalf("expected one registration, got %d (%v)", len(live), err)
+	}
+
+	// The second registration is invalid, so none must be deleted
+	manifest := models.Manifest{Registrations: []models.Registration{{ID: live[0].ID}, {}}}
+	err = runCLI(t, store, "delete", "-d", writeJSON(t, "manifest.json", manifest), "registrations")
+	if err == nil || !strings.Contains(err.Error(), "must have an ID") {
+		t.Errorf("expected registrations without ID to be rejected, got %v", err)
+	}
+	if live, err := api.Registrations(http.DefaultClient, headers); err != nil || len(live) != 1 {
+		t.Errorf("no registration must be deleted when some is invalid, got %d (%v)", len(live), err)
+	}
+}
+
+func TestDeleteUsersByName(t *testing.T) {
+	platform, cfg, store := testPlatform(t, "/riego")
+	platform.AddUser("alice")
+	platform.AddUser("bob")
+
+	// The ID of alice comes from another environment. It must not
+	// fall back to the name, that is a different user here.
+	manifest := models.Manifest{Users: []models.User{
+		{Name: "alice", UserStatus: models.UserStatus{ID: "other-environment"}},
+		{Name: "bob"},
+	}}
+	mustRunCLI(t, store, "delete", "-d", writeJSON(t, "manifest.json", manifest), "users")
+
+	k, err := keystone.New(cfg.KeystoneURL, cfg.Username, cfg.Service)
+	if err != nil {
+		t.Fatal(err)
+	}
+	users, err := k.Users(http.DefaultClient, platform.Headers("/riego"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0, len(users))
+	for _, user := range users {
+		names = append(names, user.Name)
+	}
+	if !slices.Contains(names, "alice") || slices.Contains(names, "bob") {
+		t.Errorf("expected only bob to be deleted, got users %v", names)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/warpcomdev/fiware/internal/config"
+	"github.com/warpcomdev/fiware/internal/diff"
+	"github.com/warpcomdev/fiware/internal/importer"
+	"github.com/warpcomdev/fiware/internal/snapshots"
+	"github.com/warpcomdev/fiware/keystone"
+	"github.com/warpcomdev/fiware/models"
+)
+
+// liveDiff holds the result of comparing a manifest with the live subservice
+type liveDiff struct {
+	Selected  config.Config
+	Header    http.Header
+	Client    keystone.HTTPClient
+	Manifest  models.Manifest
+	Endpoints map[string]string
+	Report    diff.Report
+}
+
+// newLiveDiff loads the manifest and compares it with the live subservice
+func newLiveDiff(c *cli.Context, store *config.Store) (*liveDiff, error) {
+	selected, err := getConfig(c, store)
+	if err != nil {
+		return nil, err
+	}
+
+	datapath, libpath := c.String(dataFlag.Name), c.String(libFlag.Name)
+	manifest, err := importer.Load(datapath, selected.Params, libpath)
+	if err != nil {
+		return nil, err
+	}
+
+	kinds, err := diffKinds(c, manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	k, header, err := getKeystoneHeaders(c, &selected)
+	if err != nil {
+		return nil, err
+	}
+	client := withSession(c, store, selected, httpClient(verbosity(c), configuredTimeout(c), configuredBackoff(c, selected)))
+	project := models.Project{Name: "/" + strings.TrimPrefix(selected.Subservice, "/")}
+	endpoints := manifestEndpoints(selected, manifest)
+	live, err := snapshots.ProjectEndpoints(client, k, selected, header, project, kinds, c.Int(maxFlag.Name), endpoints)
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := diff.Manifests(live, manifest, kinds, endpoints)
+	if err != nil {
+		return nil, err
+	}
+	return &liveDiff{
+		Selected:  selected,
+		Header:    header,
+		Client:    client,
+		Manifest:  manifest,
+		Endpoints: endpoints,
+		Report:    report,
+	}, nil
+}
+
+// diffResource compares a manifest with the live state of the subservice
+func diffResource(c *cli.Context, store *config.Store) error {
+	live, err := newLiveDiff(c, store)
+	if err != nil {
+		return err
+	}
+
+	output := outputFile(c.String(outputFlag.Name))
+	outfile, err := output.Create()
+	if err != nil {
+		return err
+	}
+	defer outfile.Close()
+	if strings.HasSuffix(strings.ToLower(string(output)), ".json") {
+		encoder := json.NewEncoder(outfile)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(live.Report)
+	}
+	return live.Report.Write(outfile)
+}
+
+// diffKinds returns the kinds of resources selected in the command line,
+// or all the kinds present in the manifest if none selected.
+func diffKinds(c *cli.Context, manifest models.Manifest) ([]string, error) {
+	if c.NArg() <= 0 {
+		kinds := diff.ManifestKinds(manifest)
+		if len(kinds) <= 0 {
+			return nil, errors.New("manifest has no resources to compare")
+		}
+		return kinds, nil
+	}
+	kinds := make([]string, 0, c.NArg())
+	for _, arg := range c.Args().Slice() {
+		switch arg {
+		case "groups":
+			arg = diff.DeviceGroups
+		case "subs", "suscriptions":
+			arg = diff.Subscriptions
+		}
+		if !slices.Contains(diff.Kinds, arg) {
+			return nil, fmt.Errorf("don't know how to compare resource %s, select from: %s", arg, strings.Join(diff.Kinds, ", "))
+		}
+		kinds = append(kinds, arg)
+	}
+	return kinds, nil
+}
+
+// manifestEndpoints merges the notification endpoints of the
+// context with those defined in the manifest
+func manifestEndpoints(selected config.Config, manifest models.Manifest) map[string]string {
+	return config.NotificationEndpoints(selected, manifest.Environment.NotificationEndpoints)
+}
@@ -35,7 +35,7 @@ func newVerticalDownloader(c *cli.Context, store *config.Store) (*verticalDownlo
 	if err != nil {
 		return nil, err
 	}
-	client := httpClient(verbosity(c), configuredTimeout(c))
+	client := withSession(c, store, selected, httpClient(verbosity(c), configuredTimeout(c), configuredBackoff(c, selected)))
 	verticals, err := api.GetVerticals(client, headers)
 	if err != nil {
 		return nil, err
@@ -152,7 +152,7 @@ func newProjectDownloader(c *cli.Context, store *config.Store) (*projectDownload
 	if err != nil {
 		return nil, err
 	}
-	client := httpClient(verbosity(c), configuredTimeout(c))
+	client := withSession(c, store, selected, httpClient(verbosity(c), configuredTimeout(c), configuredBackoff(c, selected)))
 	projects, err := api.Projects(client, headers)
 	if err != nil {
 		return nil, err
@@ -202,27 +202,40 @@ func (dld *projectDownloader) Download(c *cli.Context, store *config.Store) erro
 	}
 	defer outfile.Close()
 
-	maximum := c.Int(maxFlag.Name)
+	selected := make([]models.Project, 0, len(dld.Projects))
 	for _, v := range dld.Projects {
 		if _, ok := targetNames[v.Name]; !ok && !allTargets {
 			continue
 		}
-		targetNames[v.Name] = true
+		selected = append(selected, v)
+	}
+
+	// Subservices are downloaded concurrently, but written in order
+	maximum, parallel := c.Int(maxFlag.Name), c.Int(parallelFlag.Name)
+	results := snapshots.Projects(dld.Client, dld.Api, dld.Selected, dld.Headers, selected, nil, maximum, parallel)
+	var errList []error
+	for _, result := range results {
+		v := result.Project
+		if result.Err != nil {
+			targetNames[v.Name] = false
+			errList = append(errList, result.Err)
+			continue
+		}
 		// Output is saved in manifest format
 		currentOutDir := filepath.Join(outdir, v.Name)
-		current, err := snapshots.Project(dld.Client, dld.Api, dld.Selected, dld.Headers, v, nil, maximum)
+		currentSource, err := snapshots.WriteManifest(result.Manifest, nil, config.FolderWriter(currentOutDir))
 		if err != nil {
-			return err
-		}
-		currentSource, err := snapshots.WriteManifest(current, nil, config.FolderWriter(currentOutDir))
-		if err != nil {
-			return err
+			targetNames[v.Name] = false
+			errList = append(errList, fmt.Errorf("while writing subservice %s: %w", v.Name, err))
+			continue
 		}
+		targetNames[v.Name] = true
 		currentSource.Path = "." + v.Name
 		manifest.Deployment.Sources["subservice:"+v.Name] = currentSource
 	}
 
-	return checkTargets(targetNames, output, outfile, manifest)
+	errList = append(errList, checkTargets(targetNames, output, outfile, manifest))
+	return errors.Join(errList...)
 }
 
 func ensureDir(outdir string) error {
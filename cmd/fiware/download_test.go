@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/warpcomdev/fiware/internal/config"
+	"github.com/warpcomdev/fiware/internal/importer"
+	"github.com/warpcomdev/fiware/models"
+	"github.com/warpcomdev/fiware/orion"
+)
+
+func TestDownloadSubservices(t *testing.T) {
+	platform, _, store := sensorPlatform(t)
+	platform.AddProject("/riego")
+	platform.AddProject("/otro")
+	outdir := t.TempDir()
+	mustRunCLI(t, store, "download", "subservices", "-o", outdir, "riego")
+
+	if _, err := os.Stat(filepath.Join(outdir, "otro")); err == nil {
+		t.Error("only the selected subservices must be downloaded")
+	}
+	if _, err := os.Stat(filepath.Join(outdir, "orion.json")); err != nil {
+		t.Errorf("expected the deployment manifest: %v", err)
+	}
+	manifest, err := importer.Load(filepath.Join(outdir, "riego", "entities.csv"), nil, "")
+	if err != nil {
+		t.Fatalf("failed to load the downloaded manifest: %v", err)
+	}
+	if len(manifest.Entities) != 3 {
+		t.Fatalf("expected 3 entities downloaded, got %d", len(manifest.Entities))
+	}
+	for _, entity := range manifest.Entities {
+		if entity.ID != "s2" {
+			continue
+		}
+		if value, err := strconv.ParseFloat(string(entity.Attrs["temperature"]), 64); err != nil || value != 35 {
+			t.Errorf("expected s2 temperature 35, got %s", entity.Attrs["temperature"])
+		}
+	}
+}
+
+func TestDownloadUnknownSubservice(t *testing.T) {
+	platform, _, store := testPlatform(t, "/riego")
+	platform.AddProject("/riego")
+	if err := runCLI(t, store, "download", "subservices", "-o", t.TempDir(), "missing"); err == nil {
+		t.Error("downloading a subservice that does not exist must fail")
+	}
+}
+
+func TestDownloadSubscriptionEndpoints(t *testing.T) {
+	platform, cfg, store := testPlatform(t, "/riego", func(cfg *config.Config) {
+		cfg.Params = map[string]string{"lastdata_url": "http://cygnus:5051/notify"}
+	})
+	platform.AddProject("/riego")
+	api, err := orion.New(cfg.OrionURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub := models.Subscription{
+		Description:  "lastdata",
+		Subject:      models.Subject{Entities: []models.SubjectEntity{{IdPattern: ".*", Type: "Sensor"}}},
+		Notification: models.Notification{HTTP: models.NotificationHTTP{URL: "LASTDATA"}},
+	}
+	endpoints := map[string]string{"LASTDATA": "http://cygnus:5051/notify"}
+	if err := api.PostSuscriptions(http.DefaultClient, platform.Headers("/riego"), []models.Subscription{sub}, endpoints, true); err != nil {
+		t.Fatal(err)
+	}
+	outdir := t.TempDir()
+	mustRunCLI(t, store, "download", "subservices", "-o", outdir, "riego")
+
+	// The URLs of the context must not leak into the downloaded files
+	data, err := os.ReadFile(filepath.Join(outdir, "riego", "subs.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "http://cygnus:5051/notify") || !strings.Contains(string(data), `"LASTDATA"`) {
+		t.Errorf("expected the notification URL replaced by its endpoint, got %s", data)
+	}
+}
@@ -16,6 +16,7 @@ import (
 
 	"github.com/warpcomdev/fiware/internal/config"
 	"github.com/warpcomdev/fiware/internal/decode"
+	"github.com/warpcomdev/fiware/internal/diff"
 	"github.com/warpcomdev/fiware/internal/template"
 	"github.com/warpcomdev/fiware/keystone"
 )
@@ -56,6 +57,13 @@ func subserviceComplete(currentStore *config.Store, contextName string) {
 }
 
 func main() {
+	if err := newApp().Run(os.Args); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// newApp builds the command line application
+func newApp() *cli.App {
 
 	dirname, err := os.UserConfigDir()
 	if err != nil {
@@ -87,6 +95,8 @@ func main() {
 				DefaultText: "${XDG_CONFIG_DIR}/fiware.json",
 				EnvVars:     []string{"FIWARE_CONTEXT"},
 			},
+			retriesFlag,
+			retryDelayFlag,
 		},
 		Before: func(c *cli.Context) error {
 			currentStore.Path = c.String("context")
@@ -162,6 +172,53 @@ func main() {
 				},
 			},
 
+			{
+				Name:     "validate",
+				Category: "template",
+				Usage:    "Check datafile consistency, without connecting to the platform",
+				Action: func(c *cli.Context) error {
+					if err := currentStore.Read(""); err != nil {
+						return err
+					}
+					return validateManifest(c, currentStore.Current)
+				},
+				Flags: []cli.Flag{
+					dataFlag,
+					libFlag,
+				},
+			},
+
+			{
+				Name:     "refactor",
+				Category: "template",
+				Usage:    "Rewrite datafile after a data model change",
+				Subcommands: []*cli.Command{
+
+					&(cli.Command{
+						Name:  "rename-attr",
+						Usage: "Rename an attribute of an entity type, everywhere it is used",
+						Action: func(c *cli.Context) error {
+							if err := currentStore.Read(""); err != nil {
+								return err
+							}
+							var params map[string]string
+							if selected := currentStore.Current; selected.Name != "" && len(selected.Params) > 0 {
+								params = selected.Params
+							}
+							return renameAttr(c, params)
+						},
+						Flags: []cli.Flag{
+							dataFlag,
+							libFlag,
+							outputFlag,
+							entityTypeFlag,
+							fromAttrFlag,
+							toAttrFlag,
+						},
+					}),
+				},
+			},
+
 			{
 				Name:     "template",
 				Category: "template",
@@ -264,6 +321,7 @@ func main() {
 					userIdFlag,
 					groupIdFlag,
 					continueFlag,
+					streamFlag,
 				}, verboseFlags...),
 			},
 
@@ -324,6 +382,8 @@ func main() {
 							outdirFlag,
 							tokenFlag,
 							allFlag,
+							maxFlag,
+							parallelFlag,
 							timeoutFlag,
 						}, verboseFlags...),
 					}),
@@ -333,7 +393,7 @@ func main() {
 			{
 				Name:    "upload",
 				Aliases: []string{"up"},
-				Usage:   "Upload panels to urbo",
+				Usage:   "Upload panels (files or folders) to urbo",
 				Action: func(c *cli.Context) error {
 					return uploadResource(c, currentStore)
 				},
@@ -342,6 +402,54 @@ func main() {
 					urboTokenFlag,
 					subServiceFlag,
 					timeoutFlag,
+					prunePanelsFlag,
+					yesFlag,
+					dryRunFlag,
+				}, verboseFlags...),
+			},
+
+			{
+				Name:     "diff",
+				Category: "platform",
+				Usage:    fmt.Sprintf("Compare a manifest with the subservice (%s)", strings.Join(diff.Kinds, ", ")),
+				BashComplete: func(c *cli.Context) {
+					fmt.Println(strings.Join(diff.Kinds, "\n"))
+				},
+				Action: func(c *cli.Context) error {
+					return diffResource(c, currentStore)
+				},
+				Flags: append([]cli.Flag{
+					tokenFlag,
+					subServiceFlag,
+					dataFlag,
+					libFlag,
+					outputFlag,
+					maxFlag,
+					timeoutFlag,
+				}, verboseFlags...),
+			},
+
+			{
+				Name:     "apply",
+				Category: "platform",
+				Usage:    fmt.Sprintf("Reconcile the subservice with a manifest (%s)", strings.Join(diff.Kinds, ", ")),
+				BashComplete: func(c *cli.Context) {
+					fmt.Println(strings.Join(diff.Kinds, "\n"))
+				},
+				Action: func(c *cli.Context) error {
+					return applyResource(c, currentStore)
+				},
+				Flags: append([]cli.Flag{
+					tokenFlag,
+					subServiceFlag,
+					dataFlag,
+					libFlag,
+					pruneFlag,
+					yesFlag,
+					dryRunFlag,
+					maxFlag,
+					timeoutFlag,
+					batchSizeFlag,
 				}, verboseFlags...),
 			},
 
@@ -366,6 +474,9 @@ func main() {
 					timeoutFlag,
 					batchSizeFlag,
 					overrideMetadataFlag,
+					entityModeFlag,
+					updateFlag,
+					dryRunFlag,
 				}, verboseFlags...),
 			},
 
@@ -374,7 +485,7 @@ func main() {
 				Category: "platform",
 				Usage:    fmt.Sprintf("Delete some resource (%s)", strings.Join(canDelete, ", ")),
 				BashComplete: func(c *cli.Context) {
-					fmt.Println(strings.Join(canPost, "\n"))
+					fmt.Println(strings.Join(canDelete, "\n"))
 				},
 				Action: func(c *cli.Context) error {
 					return deleteResource(c, currentStore)
@@ -383,12 +494,17 @@ func main() {
 					tokenFlag,
 					urboTokenFlag,
 					subServiceFlag,
-					dataFlag,
+					optionalDataFlag,
 					libFlag,
 					useExactIdFlag,
 					filterTypeFlag,
+					filterIdFlag,
+					simpleQueryFlag,
+					attrFlag,
 					timeoutFlag,
 					batchSizeFlag,
+					dryRunFlag,
+					yesFlag,
 				}, verboseFlags...),
 			},
 
@@ -412,6 +528,27 @@ func main() {
 					batchSizeFlag,
 					srcMapFlag,
 					dstMapFlag,
+					dryRunFlag,
+				}, verboseFlags...),
+			},
+
+			{
+				Name:     "audit",
+				Category: "platform",
+				Usage:    fmt.Sprintf("Audit some resource and report anomalies (%s)", strings.Join(canAudit, ", ")),
+				BashComplete: func(c *cli.Context) {
+					fmt.Println(strings.Join(canAudit, "\n"))
+				},
+				Action: func(c *cli.Context) error {
+					return auditResource(c, currentStore)
+				},
+				Flags: append([]cli.Flag{
+					tokenFlag,
+					subServiceFlag,
+					domainFlag,
+					adminDomainFlag,
+					outputFlag,
+					timeoutFlag,
 				}, verboseFlags...),
 			},
 
@@ -538,12 +675,28 @@ func main() {
 				},
 				Flags: []cli.Flag{
 					portFlag,
+					pruneIntervalFlag,
 				},
 			},
-		},
-	}
 
-	if err := app.Run(os.Args); err != nil {
-		log.Fatal(err)
+			{
+				Name:     "storage",
+				Category: "config",
+				Usage:    "Manage the snapshot storage of the http server",
+				Subcommands: []*cli.Command{
+					{
+						Name:  "prune",
+						Usage: "Remove the snapshots not kept by the retention policies",
+						Action: func(c *cli.Context) error {
+							return pruneStorage(c, currentStore)
+						},
+						Flags: []cli.Flag{
+							listOnlyFlag,
+						},
+					},
+				},
+			},
+		},
 	}
+	return app
 }
@@ -1,9 +1,14 @@
 package main
 
 import (
+	"log"
+	"strconv"
 	"time"
 
 	"github.com/urfave/cli/v2"
+
+	"github.com/warpcomdev/fiware/internal/config"
+	"github.com/warpcomdev/fiware/keystone"
 )
 
 var (
@@ -44,6 +49,13 @@ var (
 		Required: true,
 	}
 
+	// optionalDataFlag is dataFlag for commands that can work without a file
+	optionalDataFlag = &cli.StringFlag{
+		Name:    dataFlag.Name,
+		Aliases: dataFlag.Aliases,
+		Usage:   dataFlag.Usage,
+	}
+
 	libFlag = &cli.StringFlag{
 		Name:    "lib",
 		Aliases: []string{"l"},
@@ -129,6 +141,12 @@ var (
 		Value: false,
 	}
 
+	entityModeFlag = &cli.StringFlag{
+		Name:  "mode",
+		Usage: "Entity update mode (append, appendStrict, update, replace, auto)",
+		Value: "append",
+	}
+
 	useExactIdFlag = &cli.BoolFlag{
 		Name:    "exact",
 		Aliases: []string{"x"},
@@ -149,6 +167,12 @@ var (
 		Value:   9181,
 	}
 
+	pruneIntervalFlag = &cli.DurationFlag{
+		Name:  "prune-interval",
+		Usage: "Apply storage retention policies with this interval (e.g. 1h). Disabled if 0",
+		Value: 0,
+	}
+
 	maxFlag = &cli.IntFlag{
 		Name:    "maximum",
 		Aliases: []string{"M", "max"},
@@ -206,6 +230,29 @@ var (
 		Usage:   "Group ID",
 	}
 
+	attrFlag = &cli.StringSliceFlag{
+		Name:  "attr",
+		Usage: "Attribute `NAME` (comma separated or repeated)",
+	}
+
+	entityTypeFlag = &cli.StringFlag{
+		Name:     "type",
+		Usage:    "Entity `TYPE`",
+		Required: true,
+	}
+
+	fromAttrFlag = &cli.StringFlag{
+		Name:     "from",
+		Usage:    "Current attribute `NAME`",
+		Required: true,
+	}
+
+	toAttrFlag = &cli.StringFlag{
+		Name:     "to",
+		Usage:    "New attribute `NAME`",
+		Required: true,
+	}
+
 	domainFlag = &cli.StringFlag{
 		Name:    "domain",
 		Aliases: []string{"D"},
@@ -231,6 +278,78 @@ var (
 		Usage: "Do not stop on errors",
 		Value: false,
 	}
+
+	parallelFlag = &cli.IntFlag{
+		Name:    "parallel",
+		Aliases: []string{"P"},
+		Usage:   "Number of subservices to download concurrently",
+		Value:   4,
+	}
+
+	retriesFlag = &cli.IntFlag{
+		Name:        "retries",
+		Usage:       "Number of retries for failed requests",
+		DefaultText: "context retries setting, or 3",
+		Value:       -1,
+	}
+
+	retryDelayFlag = &cli.IntFlag{
+		Name:        "retry-delay",
+		Usage:       "Initial delay between retries, in seconds",
+		DefaultText: "context retryDelay setting, or 2",
+		Value:       -1,
+	}
+
+	yesFlag = &cli.BoolFlag{
+		Name:    "yes",
+		Aliases: []string{"y"},
+		Usage:   "Do not ask for confirmation",
+		Value:   false,
+	}
+
+	dryRunFlag = &cli.BoolFlag{
+		Name:  "dry-run",
+		Usage: "Print the requests that would modify the platform, without sending them",
+		Value: false,
+	}
+
+	// Same as dryRunFlag, for commands that do not talk to the platform
+	listOnlyFlag = &cli.BoolFlag{
+		Name:  dryRunFlag.Name,
+		Usage: "List the items that would be removed, without removing them",
+		Value: false,
+	}
+
+	updateFlag = &cli.BoolFlag{
+		Name:    "update",
+		Aliases: []string{"u"},
+		Usage:   "Update existing resources in place, instead of failing",
+		Value:   false,
+	}
+
+	pruneFlag = &cli.BoolFlag{
+		Name:  "prune",
+		Usage: "Delete resources that are not in the manifest",
+		Value: false,
+	}
+
+	streamFlag = &cli.BoolFlag{
+		Name:  "stream",
+		Usage: "Write entities as they are read, in JSON Lines or CSV (if output ends with .csv)",
+		Value: false,
+	}
+
+	prunePanelsFlag = &cli.BoolFlag{
+		Name:  "prune",
+		Usage: "Delete the panels of the uploaded verticals that are not uploaded",
+		Value: false,
+	}
+
+	adminDomainFlag = &cli.BoolFlag{
+		Name:  "include-admin-domain",
+		Usage: "Include admin_domain when auditing all domains",
+		Value: false,
+	}
 )
 
 // verbosity combines info from all verbose flags
@@ -260,3 +379,28 @@ func configuredTimeout(c *cli.Context) time.Duration {
 	}
 	return time.Duration(timeout) * time.Second
 }
+
+// configuredBackoff builds the retry policy from the flags, or the context
+func configuredBackoff(c *cli.Context, selected config.Config) keystone.Backoff {
+	setting := func(flag *cli.IntFlag, name, value string, defaultValue int) int {
+		if v := c.Int(flag.Name); v >= 0 {
+			return v
+		}
+		if value != "" {
+			v, err := strconv.Atoi(value)
+			if err == nil && v >= 0 {
+				return v
+			}
+			log.Printf("Ignoring invalid value %q for context setting %s", value, name)
+		}
+		return defaultValue
+	}
+	retries := setting(retriesFlag, "retries", selected.Retries, 3)
+	delay := time.Duration(setting(retryDelayFlag, "retryDelay", selected.RetryDelay, 2)) * time.Second
+	return keystone.ExponentialBackoff{
+		MaxRetries:   retries,
+		InitialDelay: delay,
+		DelayFactor:  2,
+		MaxDelay:     5 * delay,
+	}
+}
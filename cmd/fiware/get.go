@@ -57,6 +57,7 @@ func getConfig(c *cli.Context, store *config.Store) (zero config.Config, err err
 	if selected.KeystoneURL == "" || selected.Service == "" || selected.Username == "" {
 		return zero, errors.New("current context is not properly configured")
 	}
+	checkExpiry(c, store, &selected)
 	return selected, nil
 }
 
@@ -125,6 +126,13 @@ func getResource(c *cli.Context, store *config.Store) error {
 	}
 	defer outfile.Close()
 
+	if c.Bool(streamFlag.Name) {
+		if args := c.Args().Slice(); len(args) != 1 || args[0] != "entities" {
+			return fmt.Errorf("--%s is only supported for entities", streamFlag.Name)
+		}
+		return streamEntities(c, store, selected, output, outfile)
+	}
+
 	vertical := &models.Manifest{
 		Subservice: selected.Subservice,
 		Environment: models.Environment{
@@ -134,7 +142,7 @@ func getResource(c *cli.Context, store *config.Store) error {
 	maximum := c.Int(maxFlag.Name)
 	skipErrors := c.Bool(continueFlag.Name)
 	domain := c.String(domainFlag.Name)
-	client := httpClient(verbosity(c), configuredTimeout(c))
+	client := withSession(c, store, selected, httpClient(verbosity(c), configuredTimeout(c), configuredBackoff(c, selected)))
 	for _, arg := range c.Args().Slice() {
 		var k *keystone.Keystone
 		var u *urbo.Urbo
@@ -347,7 +355,7 @@ func getServices(ctx config.Config, c keystone.HTTPClient, header http.Header, v
 }
 
 func getSuscriptions(ctx config.Config, c keystone.HTTPClient, header http.Header, vertical *models.Manifest) error {
-	api, err := orion.New(ctx.OrionURL)
+	api, err := orion.NewDialect(ctx.OrionURL, ctx.NGSI, ctx.LDContext)
 	if err != nil {
 		return err
 	}
@@ -363,7 +371,7 @@ func getSuscriptions(ctx config.Config, c keystone.HTTPClient, header http.Heade
 }
 
 func getRegistrations(ctx config.Config, c keystone.HTTPClient, header http.Header, vertical *models.Manifest) error {
-	api, err := orion.New(ctx.OrionURL)
+	api, err := orion.NewDialect(ctx.OrionURL, ctx.NGSI, ctx.LDContext)
 	if err != nil {
 		return err
 	}
@@ -376,7 +384,7 @@ func getRegistrations(ctx config.Config, c keystone.HTTPClient, header http.Head
 }
 
 func getEntities(ctx config.Config, c keystone.HTTPClient, header http.Header, filterId, filterType, simpleQuery string, maximum int, vertical *models.Manifest) error {
-	api, err := orion.New(ctx.OrionURL)
+	api, err := orion.NewDialect(ctx.OrionURL, ctx.NGSI, ctx.LDContext)
 	if err != nil {
 		return err
 	}
@@ -4,47 +4,40 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"maps"
 	"net/http"
 	"os"
+	"slices"
 	"strings"
 	"time"
 
 	"cuelang.org/go/pkg/encoding/json"
+	"github.com/urfave/cli/v2"
+
+	"github.com/warpcomdev/fiware/internal/config"
 	"github.com/warpcomdev/fiware/keystone"
 )
 
 type loggingClient struct {
 	verbosity int
 	client    *http.Client
+	backoff   keystone.Backoff
+}
+
+// Backoff implements keystone.RetryPolicy
+func (lc loggingClient) Backoff() keystone.Backoff {
+	return lc.backoff
 }
 
 func (lc loggingClient) Do(req *http.Request) (*http.Response, error) {
 
 	if lc.verbosity > 0 {
 		fmt.Fprintln(os.Stderr, "-- performing request -- ")
-		command := make([]string, 0, 16)
-		for k, lv := range req.Header {
-			for _, v := range lv {
-				command = append(command, fmt.Sprintf("-H '%s: %s'", k, v))
-			}
-		}
-		command = append(command, fmt.Sprintf("'%s'", req.URL))
-
-		var (
-			body []byte
-			err  error
-		)
-		if req.Body != nil {
-			if body, err = io.ReadAll(req.Body); err != nil {
-				return nil, err
-			}
-		}
-		if body != nil {
-			command = append(command, fmt.Sprintf("-d '%s'", string(body)))
-			req.Body = io.NopCloser(bytes.NewReader(body))
+		command, err := curlCommand(req, false)
+		if err != nil {
+			return nil, err
 		}
-
-		fmt.Fprintf(os.Stderr, "curl -X %s %s\n", req.Method, strings.Join(command, " "))
+		fmt.Fprintln(os.Stderr, command)
 	}
 	resp, err := lc.client.Do(req)
 	if err == nil {
@@ -78,9 +71,98 @@ func (lc loggingClient) Do(req *http.Request) (*http.Response, error) {
 	return resp, err
 }
 
-func httpClient(verbosity int, timeout time.Duration) keystone.HTTPClient {
+// curlCommand formats the request as a curl command line. The request
+// body is read and replaced, so the request can still be sent afterwards.
+// If mask is true, authentication headers are replaced by config.HiddenToken.
+func curlCommand(req *http.Request, mask bool) (string, error) {
+	command := make([]string, 0, 16)
+	keys := slices.Sorted(maps.Keys(req.Header))
+	for _, k := range keys {
+		for _, v := range req.Header[k] {
+			if mask && isTokenHeader(k) {
+				v = config.HiddenToken
+			}
+			command = append(command, fmt.Sprintf("-H '%s: %s'", k, v))
+		}
+	}
+	command = append(command, fmt.Sprintf("'%s'", req.URL))
+
+	var (
+		body []byte
+		err  error
+	)
+	if req.Body != nil {
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return "", err
+		}
+	}
+	if body != nil {
+		command = append(command, fmt.Sprintf("-d '%s'", string(body)))
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	return fmt.Sprintf("curl -X %s %s", req.Method, strings.Join(command, " ")), nil
+}
+
+// isTokenHeader is true for headers carrying keystone or urbo tokens
+func isTokenHeader(key string) bool {
+	switch http.CanonicalHeaderKey(key) {
+	case "X-Auth-Token", "X-Subject-Token", "Authorization":
+		return true
+	}
+	return false
+}
+
+// dryRunClient sends read-only requests, and prints every other request
+// instead of sending it, replying with an empty "204 No Content".
+type dryRunClient struct {
+	client keystone.HTTPClient
+	out    io.Writer
+}
+
+func (dc dryRunClient) Do(req *http.Request) (*http.Response, error) {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions:
+		return dc.client.Do(req)
+	}
+	command, err := curlCommand(req, true)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fmt.Fprintln(dc.out, command); err != nil {
+		return nil, err
+	}
+	return &http.Response{
+		Status:     "204 No Content",
+		StatusCode: http.StatusNoContent,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+		Body:       http.NoBody,
+		Request:    req,
+	}, nil
+}
+
+// Backoff implements keystone.RetryPolicy
+func (dc dryRunClient) Backoff() keystone.Backoff {
+	if policy, ok := dc.client.(keystone.RetryPolicy); ok {
+		return policy.Backoff()
+	}
+	return nil
+}
+
+// dryRun wraps the client in a dryRunClient if the dry-run flag is set
+func dryRun(c *cli.Context, client keystone.HTTPClient) keystone.HTTPClient {
+	if !c.Bool(dryRunFlag.Name) {
+		return client
+	}
+	return dryRunClient{client: client, out: os.Stdout}
+}
+
+func httpClient(verbosity int, timeout time.Duration, backoff keystone.Backoff) keystone.HTTPClient {
 	return loggingClient{
 		verbosity: verbosity,
 		client:    _httpClient(timeout),
+		backoff:   backoff,
 	}
 }
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/warpcomdev/fiware/internal/config"
+	"github.com/warpcomdev/fiware/internal/fakeplatform"
+	"github.com/warpcomdev/fiware/models"
+	"github.com/warpcomdev/fiware/orion"
+)
+
+// testPlatform starts a fake platform, and a context store with a
+// context using it, selected and logged in to the given subservice.
+// Returns the platform, the selected context and the store path.
+func testPlatform(t *testing.T, subservice string, setup ...func(*config.Config)) (*fakeplatform.Platform, config.Config, string) {
+	t.Helper()
+	platform := fakeplatform.New()
+	t.Cleanup(platform.Close)
+	cfg := platform.Config(subservice)
+	for _, f := range setup {
+		f(&cfg)
+	}
+	store := config.Store{Path: filepath.Join(t.TempDir(), "fiware.json")}
+	if err := store.Save(cfg); err != nil {
+		t.Fatalf("failed to save context: %v", err)
+	}
+	if err := store.Use(cfg.Name); err != nil {
+		t.Fatalf("failed to use context: %v", err)
+	}
+	return platform, cfg, store.Path
+}
+
+// runCLI runs the application with the given context store
+func runCLI(t *testing.T, storePath string, args ...string) error {
+	t.Helper()
+	return newApp().Run(append([]string{"fiware", "-c", storePath}, args...))
+}
+
+// mustRunCLI runs the application, and fails the test on error
+func mustRunCLI(t *testing.T, storePath string, args ...string) {
+	t.Helper()
+	if err := runCLI(t, storePath, args...); err != nil {
+		t.Fatalf("fiware %v failed: %v", args, err)
+	}
+}
+
+// writeJSON saves the data as a json file in a temporary folder
+func writeJSON(t *testing.T, name string, data any) string {
+	t.Helper()
+	raw, err := json.Marshal(data)
+	if err != nil {
+		t.Fatalf("failed to encode %s: %v", name, err)
+	}
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, raw, 0644); err != nil {
+		t.Fatalf("failed to write %s: %v", name, err)
+	}
+	return path
+}
+
+// testEntity builds an entity with numeric attributes
+func testEntity(entityType, id string, attrs map[string]float64) models.Entity {
+	entity := models.Entity{ID: id, Type: entityType, Attrs: make(map[string]json.RawMessage)}
+	for name, value := range attrs {
+		raw, _ := json.Marshal(value)
+		entity.Attrs[name] = raw
+	}
+	return entity
+}
+
+// testEntityType models a type with numeric attributes
+func testEntityType(entityType string, attrs ...string) models.EntityType {
+	et := models.EntityType{Type: entityType}
+	for _, attr := range attrs {
+		et.Attrs = append(et.Attrs, models.Attribute{Name: attr, Type: "Number"})
+	}
+	return et
+}
+
+// liveEntities reads the entities of the subservice, by ID
+func liveEntities(t *testing.T, cfg config.Config, headers http.Header) map[string]models.Entity {
+	t.Helper()
+	api, err := orion.NewDialect(cfg.OrionURL, cfg.NGSI, cfg.LDContext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, entities, err := api.Entities(http.DefaultClient, headers, "", "", "", 0)
+	if err != nil {
+		t.Fatalf("failed to read entities: %v", err)
+	}
+	byID := make(map[string]models.Entity, len(entities))
+	for _, entity := range entities {
+		byID[entity.ID] = entity
+	}
+	return byID
+}
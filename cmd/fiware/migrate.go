@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"slices"
 	"strings"
 
 	"github.com/urfave/cli/v2"
@@ -66,8 +67,69 @@ func newRoleMap(v models.Manifest) (RoleMap, error) {
 	return m, nil
 }
 
+// nameOf returns the name mapped to the given ID, or "" if not found
+func nameOf(toID map[string]string, id string) string {
+	for name, current := range toID {
+		if current == id {
+			return name
+		}
+	}
+	return ""
+}
+
+// withNames fills the missing names of the role, actor and project
+// in the assignment, looking up their IDs in the rolemap.
+func (m RoleMap) withNames(assign models.RoleAssignment) models.RoleAssignment {
+	if assign.Role.Name == "" && assign.Role.ID != "" {
+		assign.Role.Name = nameOf(m.RoleToID, assign.Role.ID)
+	}
+	if assign.User.Name == "" && assign.User.ID != "" {
+		assign.User.Name = nameOf(m.UserToID, assign.User.ID)
+	}
+	if assign.Group.Name == "" && assign.Group.ID != "" {
+		assign.Group.Name = nameOf(m.GroupToID, assign.Group.ID)
+	}
+	if assign.ScopeName == "" && assign.ProjectID != "" {
+		assign.ScopeName = nameOf(m.ProjectToID, assign.ProjectID)
+	}
+	return assign
+}
+
+// translate replaces the IDs in the assignment with the IDs of the
+// resources with the same name in the rolemap. Returns false if some
+// of them is not found.
+func (m RoleMap) translate(assign models.RoleAssignment) (models.RoleAssignment, bool) {
+	var ok bool
+	if assign.User.ID != "" || assign.User.Name != "" {
+		if assign.User.ID, ok = m.UserToID[assign.User.Name]; !ok {
+			log.Printf("User %s id not found in destination rolemap, skipping", assign.User.Name)
+			return assign, false
+		}
+	}
+	if assign.Group.ID != "" || assign.Group.Name != "" {
+		if assign.Group.ID, ok = m.GroupToID[assign.Group.Name]; !ok {
+			log.Printf("Group %s id not found in destination rolemap, skipping", assign.Group.Name)
+			return assign, false
+		}
+	}
+	if assign.Role.ID, ok = m.RoleToID[assign.Role.Name]; !ok {
+		log.Printf("Role %s id not found in destination rolemap, skipping", assign.Role.Name)
+		return assign, false
+	}
+	if assign.ProjectID != "" {
+		// Projects do not have inheritance flag
+		if assign.ProjectID, ok = m.ProjectToID[assign.ScopeName]; !ok {
+			log.Printf("Project %s id not found in destination rolemap, skipping", assign.ScopeName)
+			return assign, false
+		}
+	}
+	return assign, true
+}
+
 var canMigrate []string = []string{
 	"userroles",
+	"grouproles",
+	"projects",
 }
 
 func migrateResource(c *cli.Context, config *config.Store) error {
@@ -98,7 +160,7 @@ func migrateResource(c *cli.Context, config *config.Store) error {
 		return err
 	}
 
-	client := httpClient(verbosity(c), configuredTimeout(c))
+	client := dryRun(c, withSession(c, config, selected, httpClient(verbosity(c), configuredTimeout(c), configuredBackoff(c, selected))))
 	for _, arg := range c.Args().Slice() {
 		var k *keystone.Keystone
 		var header http.Header
@@ -110,6 +172,20 @@ func migrateResource(c *cli.Context, config *config.Store) error {
 			if err := migrateUserRoles(k, client, header, manifest, srcMap, dstMap); err != nil {
 				return err
 			}
+		case "grouproles":
+			if k, header, err = getKeystoneHeaders(c, &selected); err != nil {
+				return err
+			}
+			if err := migrateGroupRoles(k, client, header, manifest, srcMap, dstMap); err != nil {
+				return err
+			}
+		case "projects":
+			if k, header, err = getKeystoneHeaders(c, &selected); err != nil {
+				return err
+			}
+			if err := migrateProjects(k, client, header, manifest, srcMap, dstMap, c.Bool(dryRunFlag.Name)); err != nil {
+				return err
+			}
 		default:
 			return fmt.Errorf("don't know how to migrate resource %s", arg)
 		}
@@ -125,28 +201,10 @@ func migrateUserRoles(k *keystone.Keystone, client keystone.HTTPClient, header h
 	userAssignments := make([]models.RoleAssignment, 0, len(vertical.Assignments))
 	for _, assign := range vertical.Assignments {
 		if assign.User.ID != "" {
-			dstId, ok := dstRoleMap.UserToID[assign.User.Name]
-			if !ok {
-				log.Printf("User %s id not found in destination rolemap, skipping", assign.User.Name)
-				continue
-			}
-			assign.User.ID = dstId
-			dstId, ok = dstRoleMap.RoleToID[assign.Role.Name]
-			if !ok {
-				log.Printf("Role %s id not found in destination rolemap, skipping", assign.Role.Name)
-				continue
+			assign, ok := dstRoleMap.translate(assign)
+			if ok {
+				userAssignments = append(userAssignments, assign)
 			}
-			assign.Role.ID = dstId
-			if assign.ProjectID != "" {
-				// Projects do not have inheritance flag
-				dstId, ok = dstRoleMap.ProjectToID[assign.ScopeName]
-				if !ok {
-					log.Printf("Project %s id not found in destination rolemap, skipping", assign.ScopeName)
-					continue
-				}
-				assign.ProjectID = dstId
-			}
-			userAssignments = append(userAssignments, assign)
 		}
 	}
 	listMessage("Migrating roles ", userAssignments,
@@ -162,3 +220,119 @@ func migrateUserRoles(k *keystone.Keystone, client keystone.HTTPClient, header h
 	}
 	return nil
 }
+
+func migrateGroupRoles(k *keystone.Keystone, client keystone.HTTPClient, header http.Header, vertical, srcmap, dstmap models.Manifest) error {
+	srcRoleMap, err := newRoleMap(srcmap)
+	if err != nil {
+		return err
+	}
+	dstRoleMap, err := newRoleMap(dstmap)
+	if err != nil {
+		return err
+	}
+	return postGroupRoles(k, client, header, vertical.Assignments, srcRoleMap, dstRoleMap)
+}
+
+// postGroupRoles translates the group assignments from the source
+// to the destination rolemap, and posts them
+func postGroupRoles(k *keystone.Keystone, client keystone.HTTPClient, header http.Header, assignments []models.RoleAssignment, srcRoleMap, dstRoleMap RoleMap) error {
+	groupAssignments := make([]models.RoleAssignment, 0, len(assignments))
+	for _, assign := range assignments {
+		if assign.Group.ID != "" {
+			assign, ok := dstRoleMap.translate(srcRoleMap.withNames(assign))
+			if ok {
+				groupAssignments = append(groupAssignments, assign)
+			}
+		}
+	}
+	listMessage("Migrating group roles ", groupAssignments,
+		func(a models.RoleAssignment) string {
+			if a.Inherited != "" {
+				return fmt.Sprintf("%s [%s: %s] OS-INHERIT: %s", a.Group.Name, a.ScopeName, a.Role.Name, a.Inherited)
+			} else {
+				return fmt.Sprintf("%s [%s: %s]", a.Group.Name, a.ScopeName, a.Role.Name)
+			}
+		})
+	return k.PostAssignments(client, header, groupAssignments)
+}
+
+// migrateProjects creates the projects and groups of the manifest that
+// do not exist in the destination rolemap, and then migrates the group
+// assignments. Groups referenced by the assignments, but missing from
+// the manifest, are taken from the source rolemap.
+// In a dry run, new projects and groups have no ID yet, so their
+// assignments cannot be planned.
+func migrateProjects(k *keystone.Keystone, client keystone.HTTPClient, header http.Header, vertical, srcmap, dstmap models.Manifest, dryRun bool) error {
+	srcRoleMap, err := newRoleMap(srcmap)
+	if err != nil {
+		return err
+	}
+	dstRoleMap, err := newRoleMap(dstmap)
+	if err != nil {
+		return err
+	}
+
+	// Projects
+	projects := make([]models.Project, 0, len(vertical.Projects))
+	for _, project := range vertical.Projects {
+		if _, found := dstRoleMap.ProjectToID[project.Name]; found {
+			log.Printf("Project %s already exists in destination rolemap, skipping", project.Name)
+			continue
+		}
+		if !project.IsDomain {
+			projects = append(projects, project)
+		}
+	}
+	if len(projects) > 0 {
+		listMessage("Migrating projects ", projects,
+			func(p models.Project) string { return p.Name })
+		if err := k.PostProjects(client, header, projects); err != nil {
+			return err
+		}
+	}
+
+	// Groups
+	groups := make([]models.Group, 0, len(vertical.Groups))
+	for _, group := range vertical.Groups {
+		if _, found := dstRoleMap.GroupToID[group.Name]; !found {
+			groups = append(groups, group)
+		}
+	}
+	for _, assign := range vertical.Assignments {
+		name := srcRoleMap.withNames(assign).Group.Name
+		if name == "" || dstRoleMap.GroupToID[name] != "" || slices.ContainsFunc(groups, func(g models.Group) bool { return g.Name == name }) {
+			continue
+		}
+		if index := slices.IndexFunc(srcRoleMap.Groups, func(g models.Group) bool { return g.Name == name }); index >= 0 {
+			groups = append(groups, srcRoleMap.Groups[index])
+		}
+	}
+	if len(groups) > 0 {
+		listMessage("Migrating groups ", groups,
+			func(g models.Group) string { return g.Name })
+		if err := k.PostGroups(client, header, groups); err != nil {
+			return err
+		}
+	}
+
+	// New projects and groups have new IDs, read them again
+	if dryRun && (len(projects) > 0 || len(groups) > 0) {
+		log.Printf("Dry run: the assignments of new projects and groups are skipped, the plan is partial")
+	} else if len(projects) > 0 || len(groups) > 0 {
+		currentProjects, err := k.Projects(client, header)
+		if err != nil {
+			return fmt.Errorf("while reading destination projects: %w", err)
+		}
+		for _, project := range currentProjects {
+			dstRoleMap.ProjectToID[project.Name] = project.ID
+		}
+		currentGroups, err := k.Groups(client, header, "")
+		if err != nil {
+			return fmt.Errorf("while reading destination groups: %w", err)
+		}
+		for _, group := range currentGroups {
+			dstRoleMap.GroupToID[group.Name] = group.ID
+		}
+	}
+	return postGroupRoles(k, client, header, vertical.Assignments, srcRoleMap, dstRoleMap)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/warpcomdev/fiware/internal/config"
+	"github.com/warpcomdev/fiware/internal/fakeplatform"
+	"github.com/warpcomdev/fiware/keystone"
+	"github.com/warpcomdev/fiware/models"
+)
+
+// srcRoleMap is the rolemap of a source environment, with
+// IDs that do not exist in the fake platform
+func srcRoleMap() models.Manifest {
+	return models.Manifest{
+		Projects: []models.Project{{Name: "/riego", ProjectStatus: models.ProjectStatus{ID: "src-project"}}},
+		Roles:    []models.Role{{Name: "admin", RoleStatus: models.RoleStatus{ID: "src-role"}}},
+		Users:    []models.User{{Name: "alice", UserStatus: models.UserStatus{ID: "src-alice"}}},
+		Groups:   []models.Group{{Name: "operators", GroupStatus: models.GroupStatus{ID: "src-operators"}}},
+	}
+}
+
+// dstRoleMap is the rolemap of the platform, with the given IDs
+func dstRoleMap(projectID, roleID, userID, groupID string) models.Manifest {
+	return models.Manifest{
+		Projects: []models.Project{{Name: "/riego", ProjectStatus: models.ProjectStatus{ID: projectID}}},
+		Roles:    []models.Role{{Name: "admin", RoleStatus: models.RoleStatus{ID: roleID}}},
+		Users:    []models.User{{Name: "alice", UserStatus: models.UserStatus{ID: userID}}},
+		Groups:   []models.Group{{Name: "operators", GroupStatus: models.GroupStatus{ID: groupID}}},
+	}
+}
+
+// liveAssignments reads the role assignments of the users or groups
+func liveAssignments(t *testing.T, platform *fakeplatform.Platform, cfg config.Config, groups bool, ids ...string) []models.RoleAssignment {
+	t.Helper()
+	k, err := keystone.New(cfg.KeystoneURL, cfg.Username, cfg.Service)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := k.UserRoles
+	if groups {
+		read = k.GroupRoles
+	}
+	assignments, err := read(http.DefaultClient, platform.Headers(cfg.Subservice), "", ids, false)
+	if err != nil {
+		t.Fatalf("failed to read assignments: %v", err)
+	}
+	return assignments
+}
+
+func TestMigrateGroupRoles(t *testing.T) {
+	platform, cfg, store := testPlatform(t, "/riego")
+	projectID, roleID := platform.AddProject("/riego"), platform.AddRole("admin")
+	userID, groupID := platform.AddUser("alice"), platform.AddGroup("operators")
+
+	// Assignments downloaded without names, only IDs
+	vertical := models.Manifest{Assignments: []models.RoleAssignment{{
+		Role:                 models.AssignmentID{ID: "src-role"},
+		Group:                models.AssignmentID{ID: "src-operators"},
+		RoleAssignmentStatus: models.RoleAssignmentStatus{ProjectID: "src-project"},
+	}}}
+	mustRunCLI(t, store, "migrate",
+		"--srcmap", writeJSON(t, "src.json", srcRoleMap()),
+		"--dstmap", writeJSON(t, "dst.json", dstRoleMap(projectID, roleID, userID, groupID)),
+		"-d", writeJSON(t, "vertical.json", vertical), "grouproles")
+
+	live := liveAssignments(t, platform, cfg, true, groupID)
+	if len(live) != 1 || live[0].Role.ID != roleID || live[0].ProjectID != projectID {
+		t.Errorf("expected group role translated to destination IDs, got %+v", live)
+	}
+}
+
+func TestMigrateUserRoles(t *testing.T) {
+	platform, cfg, store := testPlatform(t, "/riego")
+	projectID, roleID := platform.AddProject("/riego"), platform.AddRole("admin")
+	userID, groupID := platform.AddUser("alice"), platform.AddGroup("operators")
+
+	vertical := models.Manifest{Assignments: []models.RoleAssignment{{
+		Role: models.AssignmentID{ID: "src-role", Name: "admin"},
+		User: models.AssignmentID{ID: "src-alice", Name: "alice"},
+		RoleAssignmentStatus: models.RoleAssignmentStatus{
+			ProjectID: "src-project",
+			ScopeName: "/riego",
+		},
+	}, {
+		// Not in the destination rolemap, must be skipped
+		Role: models.AssignmentID{ID: "src-role", Name: "admin"},
+		User: models.AssignmentID{ID: "src-bob", Name: "bob"},
+		RoleAssignmentStatus: models.RoleAssignmentStatus{
+			ProjectID: "src-project",
+			ScopeName: "/riego",
+		},
+	}}}
+	mustRunCLI(t, store, "migrate",
+		"--srcmap", writeJSON(t, "src.json", srcRoleMap()),
+		"--dstmap", writeJSON(t, "dst.json", dstRoleMap(projectID, roleID, userID, groupID)),
+		"-d", writeJSON(t, "vertical.json", vertical), "userroles")
+
+	live := liveAssignments(t, platform, cfg, false, userID)
+	if len(live) != 1 || live[0].Role.ID != roleID || live[0].ProjectID != projectID {
+		t.Errorf("expected user role translated to destination IDs, got %+v", live)
+	}
+}
+
+func TestMigrateProjects(t *testing.T) {
+	platform, cfg, store := testPlatform(t, "/riego")
+	roleID, userID := platform.AddRole("admin"), platform.AddUser("alice")
+
+	// Neither the project nor the group exist in the destination
+	vertical := models.Manifest{
+		Projects: []models.Project{{Name: "/riego", Enabled: true}},
+		Assignments: []models.RoleAssignment{{
+			Role:                 models.AssignmentID{ID: "src-role"},
+			Group:                models.AssignmentID{ID: "src-operators"},
+			RoleAssignmentStatus: models.RoleAssignmentStatus{ProjectID: "src-project"},
+		}},
+	}
+	dstmap := models.Manifest{
+		Roles: []models.Role{{Name: "admin", RoleStatus: models.RoleStatus{ID: roleID}}},
+		Users: []models.User{{Name: "alice", UserStatus: models.UserStatus{ID: userID}}},
+	}
+	args := []string{
+		"--srcmap", writeJSON(t, "src.json", srcRoleMap()),
+		"--dstmap", writeJSON(t, "dst.json", dstmap),
+		"-d", writeJSON(t, "vertical.json", vertical), "projects"}
+
+	k, err := keystone.New(cfg.KeystoneURL, cfg.Username, cfg.Service)
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers := platform.Headers("/riego")
+	mustRunCLI(t, store, append([]string{"migrate", "--dry-run"}, args...)...)
+	if projects, err := k.Projects(http.DefaultClient, headers); err != nil || len(projects) != 0 {
+		t.Errorf("dry run must not create projects, got %d (%v)", len(projects), err)
+	}
+
+	mustRunCLI(t, store, append([]string{"migrate"}, args...)...)
+	projects, err := k.Projects(http.DefaultClient, headers)
+	if err != nil || len(projects) != 1 {
+		t.Fatalf("expected the project to be created, got %d (%v)", len(projects), err)
+	}
+	groups, err := k.Groups(http.DefaultClient, headers, "")
+	if err != nil || len(groups) != 1 || groups[0].Name != "operators" {
+		t.Fatalf("expected the group to be created from the source rolemap, got %v (%v)", groups, err)
+	}
+	live := liveAssignments(t, platform, cfg, true, groups[0].ID)
+	if len(live) != 1 || live[0].Role.ID != roleID || live[0].ProjectID != projects[0].ID {
+		t.Errorf("expected group role in the new project, got %+v", live)
+	}
+}
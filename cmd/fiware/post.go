@@ -23,6 +23,7 @@ var canPost []string = []string{
 	"services",
 	"devices",
 	"suscriptions",
+	"registrations",
 	"rules",
 	"entities",
 	"verticals",
@@ -65,8 +66,13 @@ func postResource(c *cli.Context, config *config.Store) error {
 
 	batchSize := c.Int(batchSizeFlag.Name)
 	overrideMetadata := c.Bool(overrideMetadataFlag.Name)
+	mode := orion.UpdateMode(c.String(entityModeFlag.Name))
+	if !slices.Contains(orion.UpdateModes, mode) {
+		return fmt.Errorf("unknown entity update mode %s", mode)
+	}
 	useDescription := !c.Bool(useExactIdFlag.Name)
-	client := httpClient(verbosity(c), configuredTimeout(c))
+	update := c.Bool(updateFlag.Name)
+	client := dryRun(c, withSession(c, config, selected, httpClient(verbosity(c), configuredTimeout(c), configuredBackoff(c, selected))))
 	for _, arg := range c.Args().Slice() {
 		var u *urbo.Urbo
 		var header http.Header
@@ -75,7 +81,7 @@ func postResource(c *cli.Context, config *config.Store) error {
 			if _, header, err = getKeystoneHeaders(c, &selected); err != nil {
 				return err
 			}
-			if err := postDevices(selected, client, header, manifest); err != nil {
+			if err := postDevices(selected, client, header, manifest, update); err != nil {
 				return err
 			}
 		case "services":
@@ -84,7 +90,7 @@ func postResource(c *cli.Context, config *config.Store) error {
 			if _, header, err = getKeystoneHeaders(c, &selected); err != nil {
 				return err
 			}
-			if err := postServices(selected, client, header, manifest); err != nil {
+			if err := postServices(selected, client, header, manifest, update); err != nil {
 				return err
 			}
 		case "subscriptions":
@@ -95,14 +101,21 @@ func postResource(c *cli.Context, config *config.Store) error {
 			if _, header, err = getKeystoneHeaders(c, &selected); err != nil {
 				return err
 			}
-			if err := postSuscriptions(selected, client, header, manifest, useDescription); err != nil {
+			if err := postSuscriptions(selected, client, header, manifest, useDescription, update); err != nil {
+				return err
+			}
+		case "registrations":
+			if _, header, err = getKeystoneHeaders(c, &selected); err != nil {
+				return err
+			}
+			if err := postRegistrations(selected, client, header, manifest, useDescription, update, c.Bool(dryRunFlag.Name)); err != nil {
 				return err
 			}
 		case "rules":
 			if _, header, err = getKeystoneHeaders(c, &selected); err != nil {
 				return err
 			}
-			if err := postRules(selected, client, header, manifest); err != nil {
+			if err := postRules(selected, client, header, manifest, update); err != nil {
 				return err
 			}
 		case "entities":
@@ -113,7 +126,7 @@ func postResource(c *cli.Context, config *config.Store) error {
 			if err != nil {
 				return err
 			}
-			if err := postEntities(selected, client, header, filterManifest, batchSize, overrideMetadata); err != nil {
+			if err := postEntities(selected, client, header, filterManifest, batchSize, overrideMetadata, mode); err != nil {
 				return err
 			}
 		case "users":
@@ -154,51 +167,117 @@ func postResource(c *cli.Context, config *config.Store) error {
 	return nil
 }
 
-func postDevices(ctx config.Config, client keystone.HTTPClient, header http.Header, vertical models.Manifest) error {
+func postDevices(ctx config.Config, client keystone.HTTPClient, header http.Header, vertical models.Manifest, update bool) error {
 	api, err := iotam.New(ctx.IotamURL)
 	if err != nil {
 		return err
 	}
-	listMessage("POSTing devices with IDs", vertical.Devices,
+	devices := vertical.Devices
+	if update {
+		listMessage("PUTting devices with IDs", devices,
+			func(g models.Device) string { return g.DeviceId },
+		)
+		if devices, err = api.UpdateDevices(client, header, devices); err != nil {
+			return err
+		}
+		if len(devices) <= 0 {
+			return nil
+		}
+	}
+	listMessage("POSTing devices with IDs", devices,
 		func(g models.Device) string { return g.DeviceId },
 	)
-	return api.PostDevices(client, header, vertical.Devices)
+	return api.PostDevices(client, header, devices)
 }
 
-func postServices(ctx config.Config, client keystone.HTTPClient, header http.Header, vertical models.Manifest) error {
+func postServices(ctx config.Config, client keystone.HTTPClient, header http.Header, vertical models.Manifest, update bool) error {
 	api, err := iotam.New(ctx.IotamURL)
 	if err != nil {
 		return err
 	}
-	listMessage("POSTing device groups with API Keys", vertical.DeviceGroups,
+	groups := vertical.DeviceGroups
+	if update {
+		listMessage("PUTting device groups with API Keys", groups,
+			func(g models.DeviceGroup) string { return g.APIKey },
+		)
+		if groups, err = api.UpdateServices(client, header, groups); err != nil {
+			return err
+		}
+		if len(groups) <= 0 {
+			return nil
+		}
+	}
+	listMessage("POSTing device groups with API Keys", groups,
 		func(g models.DeviceGroup) string { return g.APIKey },
 	)
-	return api.PostServices(client, header, vertical.DeviceGroups)
+	return api.PostServices(client, header, groups)
 }
 
-func postSuscriptions(ctx config.Config, client keystone.HTTPClient, header http.Header, vertical models.Manifest, useDescription bool) error {
-	api, err := orion.New(ctx.OrionURL)
+func postSuscriptions(ctx config.Config, client keystone.HTTPClient, header http.Header, vertical models.Manifest, useDescription, update bool) error {
+	api, err := orion.NewDialect(ctx.OrionURL, ctx.NGSI, ctx.LDContext)
 	if err != nil {
 		return err
 	}
-	dictMessage("POSTing suscriptions with descriptions", vertical.Subscriptions,
+	// Mewrge configuration notificationEndpoints with vertical ones
+	ep := manifestEndpoints(ctx, vertical)
+	subs := slices.Collect(maps.Values(vertical.Subscriptions))
+	if !update {
+		dictMessage("POSTing suscriptions with descriptions", vertical.Subscriptions,
+			func(k string, v models.Subscription) string { return v.Description },
+		)
+		return api.PostSuscriptions(client, header, subs, ep, useDescription)
+	}
+	dictMessage("PATCHing suscriptions with descriptions", vertical.Subscriptions,
 		func(k string, v models.Subscription) string { return v.Description },
 	)
-	// Mewrge configuration notificationEndpoints with vertical ones
-	ep := config.FromConfig(ctx).NotificationEndpoints
-	for k, v := range vertical.Environment.NotificationEndpoints {
-		ep[k] = v
+	if subs, err = api.UpdateSubscriptions(client, header, subs, ep, useDescription); err != nil {
+		return err
 	}
-	subs := slices.Collect(maps.Values(vertical.Subscriptions))
+	if len(subs) <= 0 {
+		return nil
+	}
+	listMessage("POSTing new suscriptions with descriptions", subs,
+		func(v models.Subscription) string { return v.Description },
+	)
 	return api.PostSuscriptions(client, header, subs, ep, useDescription)
 }
 
-func postRules(ctx config.Config, client keystone.HTTPClient, header http.Header, vertical models.Manifest) error {
+func postRegistrations(ctx config.Config, client keystone.HTTPClient, header http.Header, vertical models.Manifest, useDescription, update, dryRun bool) error {
+	api, err := orion.NewDialect(ctx.OrionURL, ctx.NGSI, ctx.LDContext)
+	if err != nil {
+		return err
+	}
+	regs := vertical.Registrations
+	if update {
+		// Orion cannot update registrations, so they are replaced
+		listMessage("DELETing registrations to replace, with descriptions", regs,
+			func(r models.Registration) string { return r.Description },
+		)
+		if err := api.DeleteRegistrations(client, header, regs, useDescription); err != nil {
+			return err
+		}
+		// In a dry run the registrations were not deleted,
+		// so they would fail the check for duplicate descriptions.
+		if dryRun {
+			useDescription = false
+		}
+	}
+	listMessage("POSTing registrations with descriptions", regs,
+		func(r models.Registration) string { return r.Description },
+	)
+	return api.PostRegistrations(client, header, regs, useDescription)
+}
+
+func postRules(ctx config.Config, client keystone.HTTPClient, header http.Header, vertical models.Manifest, update bool) error {
 	api, err := perseo.New(ctx.PerseoURL)
 	if err != nil {
 		return err
 	}
-	dictMessage("POSTing rules with names", vertical.Rules,
+	verb := "POSTing"
+	if update {
+		verb = "Upserting"
+	}
+	dictMessage(verb+" rules with names", vertical.Rules,
 		func(k string, v models.Rule) string {
 			if v.Name != "" {
 				return v.Name
@@ -206,7 +285,22 @@ func postRules(ctx config.Config, client keystone.HTTPClient, header http.Header
 			return k
 		},
 	)
-	return api.PostRules(client, header, slices.Collect(maps.Values(vertical.Rules)))
+	rules := make([]models.Rule, 0, len(vertical.Rules))
+	for _, k := range slices.Sorted(maps.Keys(vertical.Rules)) {
+		rules = append(rules, vertical.Rules[k])
+	}
+	if !update {
+		return api.PostRules(client, header, rules)
+	}
+	results, err := api.UpsertRules(client, header, rules)
+	for _, result := range results {
+		if result.Err != nil {
+			fmt.Printf("rule %s: %s (failed)\n", result.Name, result.Action)
+		} else {
+			fmt.Printf("rule %s: %s\n", result.Name, result.Action)
+		}
+	}
+	return err
 }
 
 func postUsers(k *keystone.Keystone, client keystone.HTTPClient, header http.Header, vertical models.Manifest) error {
@@ -227,8 +321,8 @@ func postProjects(k *keystone.Keystone, client keystone.HTTPClient, header http.
 	return k.PostProjects(client, header, vertical.Projects)
 }
 
-func postEntities(ctx config.Config, client keystone.HTTPClient, header http.Header, vertical models.Manifest, batchSize int, overrideMetadata bool) error {
-	api, err := orion.New(ctx.OrionURL)
+func postEntities(ctx config.Config, client keystone.HTTPClient, header http.Header, vertical models.Manifest, batchSize int, overrideMetadata bool, mode orion.UpdateMode) error {
+	api, err := orion.NewDialect(ctx.OrionURL, ctx.NGSI, ctx.LDContext)
 	if err != nil {
 		return err
 	}
@@ -236,7 +330,18 @@ func postEntities(ctx config.Config, client keystone.HTTPClient, header http.Hea
 	listMessage("POSTing entities with names", merged,
 		func(g orion.Entity) string { return fmt.Sprintf("%s/%s", g.Type(), g.ID()) },
 	)
-	return api.UpdateEntities(client, header, merged, batchSize, overrideMetadata)
+	if mode != orion.ModeAuto {
+		return api.UpdateEntitiesMode(client, header, merged, batchSize, overrideMetadata, mode)
+	}
+	results, err := api.UpsertEntities(client, header, merged, batchSize, overrideMetadata)
+	for _, result := range results {
+		if result.Err != nil {
+			fmt.Printf("entity %s/%s: %s (failed)\n", result.Type, result.ID, result.Action)
+		} else {
+			fmt.Printf("entity %s/%s: %s\n", result.Type, result.ID, result.Action)
+		}
+	}
+	return err
 }
 
 func postVerticals(ctx config.Config, client keystone.HTTPClient, u *urbo.Urbo, header http.Header, vertical models.Manifest) error {
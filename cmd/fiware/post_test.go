@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/warpcomdev/fiware/internal/perseo"
+	"github.com/warpcomdev/fiware/models"
+	"github.com/warpcomdev/fiware/orion"
+)
+
+func TestPostEntities(t *testing.T) {
+	platform, cfg, store := testPlatform(t, "/riego")
+	manifest := models.Manifest{
+		EntityTypes: []models.EntityType{testEntityType("Sensor", "temperature")},
+		Entities: []models.Entity{
+			testEntity("Sensor", "s1", map[string]float64{"temperature": 20}),
+			testEntity("Sensor", "s2", map[string]float64{"temperature": 25}),
+		},
+	}
+	mustRunCLI(t, store, "post", "-d", writeJSON(t, "manifest.json", manifest), "entities")
+
+	live := liveEntities(t, cfg, platform.Headers("/riego"))
+	if len(live) != 2 {
+		t.Fatalf("expected 2 entities, got %d", len(live))
+	}
+	if got := string(live["s2"].Attrs["temperature"]); got != "25" {
+		t.Errorf("expected s2 temperature 25, got %s", got)
+	}
+	if others := liveEntities(t, cfg, platform.Headers("/otro")); len(others) != 0 {
+		t.Errorf("expected no entities in other subservices, got %d", len(others))
+	}
+}
+
+func TestPostDryRun(t *testing.T) {
+	platform, cfg, store := testPlatform(t, "/riego")
+	manifest := models.Manifest{
+		EntityTypes: []models.EntityType{testEntityType("Sensor", "temperature")},
+		Entities:    []models.Entity{testEntity("Sensor", "s1", map[string]float64{"temperature": 20})},
+	}
+	mustRunCLI(t, store, "post", "--dry-run", "-d", writeJSON(t, "manifest.json", manifest), "entities")
+	if live := liveEntities(t, cfg, platform.Headers("/riego")); len(live) != 0 {
+		t.Errorf("dry run must not create entities, got %d", len(live))
+	}
+}
+
+func TestPostSubscriptionsUpdate(t *testing.T) {
+	platform, cfg, store := testPlatform(t, "/riego")
+	sub := models.Subscription{
+		Description: "lastdata sensors",
+		Subject: models.Subject{
+			Entities: []models.SubjectEntity{{IdPattern: ".*", Type: "Sensor"}},
+		},
+		Notification: models.Notification{
+			Attrs:      []string{"temperature"},
+			HTTPCustom: models.NotificationCustom{URL: "LASTDATA"},
+		},
+	}
+	manifest := models.Manifest{
+		Environment:   models.Environment{NotificationEndpoints: map[string]string{"LASTDATA": "http://cygnus:5051/notify"}},
+		Subscriptions: map[string]models.Subscription{"lastdata": sub},
+	}
+	mustRunCLI(t, store, "post", "-d", writeJSON(t, "manifest.json", manifest), "subscriptions")
+
+	sub.Notification.Attrs = []string{"temperature", "humidity"}
+	manifest.Subscriptions["lastdata"] = sub
+	mustRunCLI(t, store, "post", "--update", "-d", writeJSON(t, "manifest.json", manifest), "subscriptions")
+
+	api, err := orion.New(cfg.OrionURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	endpoints := make(map[string]string)
+	live, err := api.Subscriptions(http.DefaultClient, platform.Headers("/riego"), endpoints)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(live) != 1 {
+		t.Fatalf("expected the subscription to be updated in place, got %d subscriptions", len(live))
+	}
+	attrs := slices.Sorted(slices.Values(live[0].Notification.Attrs))
+	if got := strings.Join(attrs, ","); got != "humidity,temperature" {
+		t.Errorf("expected updated attrs, got %s", got)
+	}
+	if got := endpoints[live[0].Notification.HTTPCustom.URL]; got != "http://cygnus:5051/notify" {
+		t.Errorf("expected notification URL resolved from the environment, got %s", got)
+	}
+}
+
+func TestPostRulesUpdate(t *testing.T) {
+	platform, cfg, store := testPlatform(t, "/riego")
+	rule := func(text string) models.Rule {
+		return models.Rule{
+			Name:   "alarm",
+			Text:   text,
+			Action: json.RawMessage(`[{"type":"update","parameters":{"attributes":[{"name":"alarm","value":"true"}]}}]`),
+		}
+	}
+	manifest := models.Manifest{Rules: map[string]models.Rule{"alarm": rule(`select * from iotEvent where type="Sensor" and temperature? > 30`)}}
+	mustRunCLI(t, store, "post", "-d", writeJSON(t, "manifest.json", manifest), "rules")
+
+	manifest.Rules["alarm"] = rule(`select * from iotEvent where type="Sensor" and temperature? > 35`)
+	mustRunCLI(t, store, "post", "--update", "-d", writeJSON(t, "manifest.json", manifest), "rules")
+
+	api, err := perseo.New(cfg.PerseoURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	live, err := api.Rules(http.DefaultClient, platform.Headers("/riego"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(live) != 1 {
+		t.Fatalf("expected one rule, got %d", len(live))
+	}
+	if !strings.Contains(live[0].Text, "> 35") {
+		t.Errorf("expected rule text to be updated, got %s", live[0].Text)
+	}
+}
+
+func TestPostRegistrationsUpdateDryRun(t *testing.T) {
+	platform, cfg, store := testPlatform(t, "/riego")
+	manifest := models.Manifest{Registrations: []models.Registration{{
+		Description:  "weather provider",
+		DataProvided: json.RawMessage(`{"entities":[{"idPattern":".*","type":"Weather"}],"attrs":["temperature"]}`),
+		Provider:     json.RawMessage(`{"http":{"url":"http://provider:8080"}}`),
+	}}}
+	datafile := writeJSON(t, "manifest.json", manifest)
+	mustRunCLI(t, store, "post", "-d", datafile, "registrations")
+
+	api, err := orion.New(cfg.OrionURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, err := api.Registrations(http.DefaultClient, platform.Headers("/riego"))
+	if err != nil || len(before) != 1 {
+		t.Fatalf("expected one registration, got %d (%v)", len(before), err)
+	}
+
+	// The delete is not sent, so the post must not fail the duplicate check
+	mustRunCLI(t, store, "post", "--update", "--dry-run", "-d", datafile, "registrations")
+	after, err := api.Registrations(http.DefaultClient, platform.Headers("/riego"))
+	if err != nil || len(after) != 1 || after[0].ID != before[0].ID {
+		t.Errorf("dry run must not replace the registration, got %v (%v)", after, err)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/warpcomdev/fiware/internal/importer"
+	"github.com/warpcomdev/fiware/internal/refactor"
+)
+
+// renameAttr renames an attribute everywhere in the manifest, writes
+// the updated manifest and reports every change to stderr
+func renameAttr(c *cli.Context, params map[string]string) error {
+	datapath, libpath := c.String(dataFlag.Name), c.String(libFlag.Name)
+	manifest, err := importer.Load(datapath, params, libpath)
+	if err != nil {
+		return err
+	}
+	entityType, from, to := c.String(entityTypeFlag.Name), c.String(fromAttrFlag.Name), c.String(toAttrFlag.Name)
+	changes, err := refactor.RenameAttr(&manifest, entityType, from, to)
+	if err != nil {
+		return err
+	}
+	for _, change := range changes {
+		fmt.Fprintln(os.Stderr, change.String())
+	}
+	if len(changes) <= 0 {
+		fmt.Fprintf(os.Stderr, "no references to attribute %s of type %s found\n", from, entityType)
+	} else {
+		fmt.Fprintf(os.Stderr, "renamed %s to %s in %d places\n", from, to, len(changes))
+	}
+
+	output := outputFile(c.String(outputFlag.Name))
+	outFile, err := output.Create()
+	if err != nil {
+		return err
+	}
+	defer outFile.Close()
+	return output.Encode(outFile, &manifest, params)
+}
@@ -6,13 +6,11 @@ import (
 	"io/fs"
 	"net/http"
 	"os"
-	"path/filepath"
 	"time"
 
 	"github.com/urfave/cli/v2"
 	"github.com/warpcomdev/fiware/internal/config"
 	"github.com/warpcomdev/fiware/internal/snapshots"
-	"github.com/warpcomdev/fiware/internal/storage"
 	"github.com/warpcomdev/fiware/internal/urbo"
 	"github.com/warpcomdev/fiware/keystone"
 )
@@ -23,18 +21,18 @@ var staticFS embed.FS
 // prepare Server and address to start http rest api
 func prepareServer(currentStore *config.Store, c *cli.Context, backoff keystone.ExponentialBackoff) (http.Handler, string, error) {
 
-	client := httpClient(0, 15*time.Second)
+	client := httpClient(0, 15*time.Second, backoff)
 	mux := &http.ServeMux{}
-	configDir, err := currentStore.GetConfigDir()
+	snapStore, err := snapshotStore(currentStore)
 	if err != nil {
 		return nil, "", err
 	}
-	storageDir := filepath.Join(configDir, "storage")
 	mux.Handle("/api/auth", cors(authServe(client, currentStore, backoff)))
 	mux.Handle("/api/contexts/", cors(http.StripPrefix("/api/contexts", currentStore.Server())))
 	mux.Handle("/api/snaps/", cors(http.StripPrefix("/api/snaps", snapshots.Serve(client, currentStore))))
 	mux.Handle("/api/urbo/", cors(http.StripPrefix("/api/urbo", urbo.Serve(client, currentStore))))
-	mux.Handle("/api/storage/", cors(http.StripPrefix("/api/storage", storage.New(storageDir).Serve())))
+	snapStore.Restore = snapshots.Restorer(client, currentStore)
+	mux.Handle("/api/storage/", cors(http.StripPrefix("/api/storage", snapStore.Serve())))
 	mux.Handle("/legacy", legacyHandler())
 	var serveFS fs.FS
 	if c.NArg() > 0 {
@@ -47,6 +45,9 @@ func prepareServer(currentStore *config.Store, c *cli.Context, backoff keystone.
 		}
 	}
 	mux.Handle("/", http.FileServer(http.FS(serveFS)))
+	if interval := c.Duration(pruneIntervalFlag.Name); interval > 0 {
+		go backgroundPrune(snapStore, interval)
+	}
 	port := c.Int(portFlag.Name)
 	var addr string
 	if port <= 0 {
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/warpcomdev/fiware/internal/config"
+	"github.com/warpcomdev/fiware/keystone"
+)
+
+const (
+	// passwordEnvVar holds the password used to login again when the token expires
+	passwordEnvVar = "FIWARE_PASSWORD"
+	// expiryMargin is how long before expiration the token is renewed or a warning printed
+	expiryMargin = 10 * time.Minute
+)
+
+// storedPassword returns the password for the context, from the environment
+// or the secretHelper context setting. Returns "" if none is available.
+func storedPassword(selected config.Config) (string, error) {
+	if password := os.Getenv(passwordEnvVar); password != "" {
+		return password, nil
+	}
+	if selected.SecretHelper == "" {
+		return "", nil
+	}
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", selected.SecretHelper)
+	} else {
+		cmd = exec.Command("sh", "-c", selected.SecretHelper)
+	}
+	cmd.Env = append(os.Environ(),
+		"FIWARE_CONTEXT_NAME="+selected.Name,
+		"FIWARE_SERVICE="+selected.Service,
+		"FIWARE_USERNAME="+selected.Username,
+	)
+	cmd.Stderr = os.Stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("while running secret helper for context %s: %w", selected.Name, err)
+	}
+	return strings.TrimRight(string(output), "\r\n"), nil
+}
+
+// loginAgain gets new tokens for the selected context, using the stored
+// password. If cache is true, the new tokens are saved in the store.
+func loginAgain(client keystone.HTTPClient, store *config.Store, selected *config.Config, backoff keystone.Backoff, cache bool) error {
+	password, err := storedPassword(*selected)
+	if err != nil {
+		return err
+	}
+	if password == "" {
+		return fmt.Errorf("no credentials to login again, please set %s or the secretHelper context setting", passwordEnvVar)
+	}
+	k, err := keystone.New(selected.KeystoneURL, selected.Username, selected.Service)
+	if err != nil {
+		return err
+	}
+	fiwareToken, urboToken, _, expiry, err := getTokens(client, k, selected, password, backoff, false)
+	if err != nil {
+		return err
+	}
+	selected.SetCredentials(fiwareToken, urboToken, expiry)
+	if !cache {
+		return nil
+	}
+	// Read the context again, selected might have been
+	// modified by command line flags (e.g. subservice)
+	saved, err := store.Info(selected.Name)
+	if err != nil {
+		return err
+	}
+	saved.SetCredentials(fiwareToken, urboToken, expiry)
+	return store.Save(saved)
+}
+
+// checkExpiry renews the cached token if it is about to expire and there
+// are credentials available. Otherwise, it prints a warning.
+func checkExpiry(c *cli.Context, store *config.Store, selected *config.Config) {
+	if c.String(tokenFlag.Name) != "" || selected.HasToken() == "" || selected.TokenExpiry.IsZero() {
+		return
+	}
+	remaining := time.Until(selected.TokenExpiry)
+	if remaining > expiryMargin {
+		return
+	}
+	password, err := storedPassword(*selected)
+	if err != nil {
+		log.Printf("Failed to get credentials: %v", err)
+	}
+	if password != "" {
+		client := httpClient(verbosity(c), configuredTimeout(c), configuredBackoff(c, *selected))
+		if err := loginAgain(client, store, selected, configuredBackoff(c, *selected), true); err != nil {
+			log.Printf("Failed to renew token for context %s: %v", selected.Name, err)
+		} else {
+			log.Printf("Token for context %s renewed", selected.Name)
+		}
+		return
+	}
+	if remaining <= 0 {
+		log.Printf("Token for context %s expired at %s, please login again", selected.Name, selected.TokenExpiry.Local().Format(time.DateTime))
+	} else {
+		log.Printf("Token for context %s expires in %s, please login again", selected.Name, remaining.Round(time.Second))
+	}
+}
+
+// session keeps the latest tokens of a context, shared by all requests
+type session struct {
+	mu       sync.Mutex
+	store    *config.Store
+	selected config.Config
+	backoff  keystone.Backoff
+	cache    bool // save renewed tokens in the store
+	failed   error
+}
+
+// tokens returns the current tokens
+func (s *session) tokens() (string, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.selected.Token, s.selected.UrboToken
+}
+
+// refresh logs in again, unless the request was sent with an outdated
+// token, and returns the current tokens.
+func (s *session) refresh(client keystone.HTTPClient, usedToken string) (string, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failed != nil {
+		return "", "", s.failed
+	}
+	if usedToken == s.selected.Token || usedToken == s.selected.UrboToken {
+		if err := loginAgain(client, s.store, &s.selected, s.backoff, s.cache); err != nil {
+			s.failed = fmt.Errorf("while renewing token for context %s: %w", s.selected.Name, err)
+			return "", "", s.failed
+		}
+		log.Printf("Token for context %s renewed", s.selected.Name)
+	}
+	return s.selected.Token, s.selected.UrboToken, nil
+}
+
+// sessionClient sends every request with the current tokens of the
+// session, instead of those the request was built with. It renews the
+// tokens and retries the request once, when it fails with 401 Unauthorized.
+type sessionClient struct {
+	client  keystone.HTTPClient
+	session *session
+}
+
+// withTokens returns a copy of the request, with the given tokens
+// replacing the ones it carries. Requests without tokens are not changed.
+func withTokens(req *http.Request, body []byte, token, urboToken string) *http.Request {
+	req = req.Clone(req.Context())
+	if token != "" && req.Header.Get("X-Auth-Token") != "" {
+		req.Header.Set("X-Auth-Token", token)
+	}
+	if urboToken != "" && strings.HasPrefix(req.Header.Get("Authorization"), "Bearer ") {
+		req.Header.Set("Authorization", "Bearer "+urboToken)
+	}
+	if body != nil {
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	return req
+}
+
+func (sc sessionClient) Do(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+	}
+	currentToken, currentUrboToken := sc.session.tokens()
+	req = withTokens(req, body, currentToken, currentUrboToken)
+	resp, err := sc.client.Do(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	token := req.Header.Get("X-Auth-Token")
+	urboToken, isUrbo := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if token == "" && !isUrbo {
+		// login requests, nothing to renew
+		return resp, err
+	}
+	usedToken := token
+	if isUrbo {
+		usedToken = urboToken
+	}
+	newToken, newUrboToken, refreshErr := sc.session.refresh(sc.client, usedToken)
+	if refreshErr != nil {
+		log.Print(refreshErr)
+		return resp, err
+	}
+	keystone.Exhaust(resp)
+	return sc.client.Do(withTokens(req, body, newToken, newUrboToken))
+}
+
+// Backoff implements keystone.RetryPolicy
+func (sc sessionClient) Backoff() keystone.Backoff {
+	if policy, ok := sc.client.(keystone.RetryPolicy); ok {
+		return policy.Backoff()
+	}
+	return nil
+}
+
+// withSession wraps the client in a sessionClient for the selected context.
+// Renewed tokens are cached only if the context already had cached tokens.
+func withSession(c *cli.Context, store *config.Store, selected config.Config, client keystone.HTTPClient) keystone.HTTPClient {
+	cache := selected.HasToken() != ""
+	if token := c.String(tokenFlag.Name); token != "" {
+		selected.Token = token
+	}
+	if token := c.String(urboTokenFlag.Name); token != "" {
+		selected.UrboToken = token
+	}
+	return sessionClient{
+		client: client,
+		session: &session{
+			store:    store,
+			selected: selected,
+			backoff:  configuredBackoff(c, selected),
+			cache:    cache,
+		},
+	}
+}
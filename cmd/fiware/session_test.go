@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/warpcomdev/fiware/internal/fakeplatform"
+)
+
+// countingClient counts the responses by status code
+type countingClient struct {
+	mu       sync.Mutex
+	statuses map[int]int
+}
+
+func (cc *countingClient) Do(req *http.Request) (*http.Response, error) {
+	resp, err := http.DefaultClient.Do(req)
+	if err == nil {
+		cc.mu.Lock()
+		cc.statuses[resp.StatusCode] += 1
+		cc.mu.Unlock()
+	}
+	return resp, err
+}
+
+func TestSessionClientRenewedToken(t *testing.T) {
+	platform := fakeplatform.New()
+	t.Cleanup(platform.Close)
+	t.Setenv(passwordEnvVar, platform.Password)
+	selected := platform.Config("/riego")
+	oldHeaders := platform.Headers("/riego")
+	platform.RotateToken()
+
+	counter := &countingClient{statuses: make(map[int]int)}
+	client := sessionClient{client: counter, session: &session{selected: selected}}
+	for range 3 {
+		// Requests are built with the expired token
+		req, err := http.NewRequest(http.MethodGet, selected.OrionURL+"v2/entities", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header = oldHeaders.Clone()
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected the request to succeed, got %d", resp.StatusCode)
+		}
+	}
+	if got := counter.statuses[http.StatusUnauthorized]; got != 1 {
+		t.Errorf("expected a single 401 before the token is renewed, got %d", got)
+	}
+}
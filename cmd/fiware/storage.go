@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"github.com/warpcomdev/fiware/internal/config"
+	"github.com/warpcomdev/fiware/internal/storage"
+)
+
+// snapshotStore returns the storage of snapshots, in the config dir
+func snapshotStore(currentStore *config.Store) (*storage.Store, error) {
+	configDir, err := currentStore.GetConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	return storage.New(filepath.Join(configDir, "storage")), nil
+}
+
+// pruneStorage removes the snapshots not kept by the retention policies
+func pruneStorage(c *cli.Context, currentStore *config.Store) error {
+	store, err := snapshotStore(currentStore)
+	if err != nil {
+		return err
+	}
+	policies, err := store.LoadPolicies()
+	if err != nil {
+		return err
+	}
+	if len(policies) <= 0 {
+		return fmt.Errorf("no retention policies in %s", filepath.Join(store.Path, storage.RetentionFile))
+	}
+	dryRun := c.Bool(dryRunFlag.Name)
+	pruned, err := store.Prune(policies, time.Now(), dryRun)
+	for _, item := range pruned {
+		if dryRun {
+			fmt.Printf("would remove %s\n", item)
+		} else {
+			fmt.Printf("removed %s\n", item)
+		}
+	}
+	return err
+}
+
+// backgroundPrune applies the retention policies of the store
+// every interval. Policies are read again on each run.
+func backgroundPrune(store *storage.Store, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		policies, err := store.LoadPolicies()
+		if err != nil {
+			log.Printf("failed to load retention policies: %s", err)
+			continue
+		}
+		if len(policies) <= 0 {
+			continue
+		}
+		pruned, err := store.Prune(policies, time.Now(), false)
+		if err != nil {
+			log.Printf("failed to prune storage: %s", err)
+		}
+		if len(pruned) > 0 {
+			log.Printf("pruned %d snapshots from storage", len(pruned))
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/warpcomdev/fiware/internal/config"
+	"github.com/warpcomdev/fiware/orion"
+	"github.com/warpcomdev/fiware/serialize"
+)
+
+// streamEntities writes the entities to outfile as each page is read from
+// orion, instead of collecting them all in a manifest. The output is CSV
+// if the file has .csv extension, or JSON Lines otherwise.
+func streamEntities(c *cli.Context, store *config.Store, selected config.Config, output outputFile, outfile serialize.Writer) error {
+	_, header, err := getKeystoneHeaders(c, &selected)
+	if err != nil {
+		return err
+	}
+	api, err := orion.NewDialect(selected.OrionURL, selected.NGSI, selected.LDContext)
+	if err != nil {
+		return err
+	}
+	client := withSession(c, store, selected, httpClient(verbosity(c), configuredTimeout(c), configuredBackoff(c, selected)))
+	filterId := c.String(filterIdFlag.Name)
+	filterType := c.String(filterTypeFlag.Name)
+	simpleQuery := c.String(simpleQueryFlag.Name)
+
+	var (
+		rows      *serialize.RowSerializer
+		keyValues bool
+	)
+	if strings.HasSuffix(strings.ToLower(string(output)), ".csv") {
+		// CSV needs the columns in advance, take them from the entity types
+		attrTypes, err := api.AttrTypes(client, header, filterType)
+		if err != nil {
+			return err
+		}
+		columns := []string{"id", "type"}
+		headers := []string{"entityID", "entityType"}
+		for _, name := range slices.Sorted(maps.Keys(attrTypes)) {
+			columns = append(columns, name)
+			headers = append(headers, fmt.Sprintf("%s<%s>", name, attrTypes[name]))
+		}
+		rows, keyValues = serialize.NewCSV(outfile, columns, headers), true
+	} else {
+		rows = serialize.NewJSONLines(outfile)
+	}
+	count := 0
+	err = api.StreamEntities(client, header, filterId, filterType, simpleQuery, c.Int(maxFlag.Name), func(ent orion.Entity) error {
+		if keyValues {
+			ent = ent.KeyValues()
+		}
+		rows.BeginBlock("")
+		ent.Serialize(rows)
+		rows.EndBlock()
+		count += 1
+		return rows.Error()
+	})
+	if err != nil {
+		return fmt.Errorf("while streaming entities (%d written): %w", count, err)
+	}
+	return nil
+}
@@ -1,12 +1,17 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"io/fs"
+	"maps"
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 
 	"github.com/urfave/cli/v2"
 
@@ -31,29 +36,110 @@ func uploadResource(c *cli.Context, store *config.Store) error {
 		return err
 	}
 
-	client := httpClient(verbosity(c), configuredTimeout(c))
+	client := dryRun(c, withSession(c, store, selected, httpClient(verbosity(c), configuredTimeout(c), configuredBackoff(c, selected))))
+	uploaded := make(map[string]struct{})
 	for _, target := range c.Args().Slice() {
 		fullpath, err := filepath.Abs(target)
 		if err != nil {
 			return err
 		}
+		info, err := os.Stat(fullpath)
+		if err != nil {
+			return err
+		}
+		// Folders are uploaded as a whole, including all their json files
+		if info.IsDir() {
+			if err := uploadFolder(u, client, header, os.DirFS(fullpath), uploaded); err != nil {
+				return err
+			}
+			continue
+		}
 		dirname, filename := filepath.Split(fullpath)
-		if err := uploadPanel(u, client, header, os.DirFS(dirname), filename); err != nil {
+		slug, err := uploadPanel(u, client, header, os.DirFS(dirname), filename)
+		if err != nil {
 			return err
 		}
+		uploaded[slug] = struct{}{}
+	}
+	if c.Bool(prunePanelsFlag.Name) {
+		return prunePanels(c, u, client, header, uploaded)
 	}
 	return nil
 }
 
-func uploadPanel(u *urbo.Urbo, client keystone.HTTPClient, header http.Header, fsys fs.FS, path string) error {
+// uploadFolder uploads all the json files in the folder
+func uploadFolder(u *urbo.Urbo, client keystone.HTTPClient, header http.Header, fsys fs.FS, uploaded map[string]struct{}) error {
+	return fs.WalkDir(fsys, ".", func(filename string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.EqualFold(filepath.Ext(filename), ".json") {
+			return nil
+		}
+		slug, err := uploadPanel(u, client, header, fsys, filename)
+		if err != nil {
+			return fmt.Errorf("while uploading %s: %w", filename, err)
+		}
+		uploaded[slug] = struct{}{}
+		return nil
+	})
+}
+
+// uploadPanel uploads the panel in the file and returns its slug
+func uploadPanel(u *urbo.Urbo, client keystone.HTTPClient, header http.Header, fsys fs.FS, path string) (string, error) {
 	file, err := fsys.Open(path)
 	if err != nil {
-		return err
+		return "", err
 	}
 	defer file.Close()
 	bytes, err := io.ReadAll(file)
 	if err != nil {
+		return "", err
+	}
+	var panel struct {
+		Slug string `json:"slug"`
+	}
+	if err := json.Unmarshal(bytes, &panel); err != nil {
+		return "", err
+	}
+	return panel.Slug, u.UploadPanel(client, header, bytes)
+}
+
+// prunePanels deletes the panels of the verticals being uploaded that
+// have not been uploaded. A vertical is being uploaded if any of its
+// panels was uploaded. Panels of other verticals are never deleted.
+func prunePanels(c *cli.Context, u *urbo.Urbo, client keystone.HTTPClient, header http.Header, uploaded map[string]struct{}) error {
+	verticals, err := u.GetVerticals(client, header)
+	if err != nil {
+		return err
+	}
+	var pruned, stale []string
+	for _, slug := range slices.Sorted(maps.Keys(verticals)) {
+		panels := verticals[slug].AllPanels()
+		if !slices.ContainsFunc(panels, func(panel string) bool { _, ok := uploaded[panel]; return ok }) {
+			continue
+		}
+		pruned = append(pruned, slug)
+		for _, panel := range panels {
+			if _, ok := uploaded[panel]; !ok && !slices.Contains(stale, panel) {
+				stale = append(stale, panel)
+			}
+		}
+	}
+	if len(stale) <= 0 {
+		return nil
+	}
+	slices.Sort(stale)
+	question := fmt.Sprintf("About to delete %d panels of verticals %s that were not uploaded", len(stale), strings.Join(pruned, ", "))
+	if err := confirmDeletion(c, question); err != nil {
 		return err
 	}
-	return u.UploadPanel(client, header, bytes)
+	fmt.Printf("DELETing panels with slugs '%s'\n", strings.Join(stale, "','"))
+	errList := make([]error, 0, len(stale))
+	for _, slug := range stale {
+		if err := u.DeletePanel(client, header, slug); err != nil {
+			errList = append(errList, fmt.Errorf("while deleting panel %s: %w", slug, err))
+		}
+	}
+	return errors.Join(errList...)
 }
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/warpcomdev/fiware/internal/config"
+	"github.com/warpcomdev/fiware/internal/importer"
+	"github.com/warpcomdev/fiware/internal/validate"
+)
+
+// validateManifest checks the manifest offline, and fails if any
+// problem is found. Subscription endpoints are resolved the same
+// way post and apply do, with the endpoints of the selected context.
+func validateManifest(c *cli.Context, selected config.Config) error {
+	var params map[string]string
+	if selected.Name != "" && len(selected.Params) > 0 {
+		params = selected.Params
+	}
+	datapath, libpath := c.String(dataFlag.Name), c.String(libFlag.Name)
+	manifest, err := importer.Load(datapath, params, libpath)
+	if err != nil {
+		return err
+	}
+	findings := validate.Manifest(manifest, manifestEndpoints(selected, manifest))
+	for _, finding := range findings {
+		fmt.Println(finding.String())
+	}
+	if len(findings) > 0 {
+		return fmt.Errorf("%d problems found in %s", len(findings), datapath)
+	}
+	fmt.Printf("%s is valid\n", datapath)
+	return nil
+}
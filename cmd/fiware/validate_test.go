@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/warpcomdev/fiware/internal/config"
+	"github.com/warpcomdev/fiware/models"
+)
+
+func TestValidateContextEndpoints(t *testing.T) {
+	_, _, store := testPlatform(t, "/riego", func(cfg *config.Config) {
+		cfg.Params = map[string]string{"lastdata_url": "http://cygnus:5051/notify"}
+	})
+	manifest := models.Manifest{
+		EntityTypes: []models.EntityType{testEntityType("Sensor", "temperature")},
+		Subscriptions: map[string]models.Subscription{"lastdata": {
+			Description: "lastdata",
+			Subject:     models.Subject{Entities: []models.SubjectEntity{{IdPattern: ".*", Type: "Sensor"}}},
+			Notification: models.Notification{
+				HTTP: models.NotificationHTTP{URL: "LASTDATA"},
+			},
+		}},
+	}
+	datafile := writeJSON(t, "manifest.json", manifest)
+	mustRunCLI(t, store, "validate", "-d", datafile)
+
+	// Endpoints not in the context nor the manifest are reported
+	sub := manifest.Subscriptions["lastdata"]
+	sub.Notification.HTTP.URL = "HISTORIC"
+	manifest.Subscriptions["lastdata"] = sub
+	if err := runCLI(t, store, "validate", "-d", writeJSON(t, "manifest.json", manifest)); err == nil {
+		t.Error("expected the HISTORIC endpoint to be reported")
+	}
+}
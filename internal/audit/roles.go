@@ -0,0 +1,310 @@
+// Package audit checks the keystone role assignments of one or more
+// domains, and reports anomalies such as users without roles, or roles
+// granted directly to users instead of through groups.
+package audit
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/warpcomdev/fiware/keystone"
+	"github.com/warpcomdev/fiware/models"
+)
+
+// Anomaly is the kind of problem found in the role assignments
+type Anomaly string
+
+const (
+	AssignmentsFailed  Anomaly = "assignments_failed"   // could not read the assignments of a user or group
+	EmptyAssignments   Anomaly = "empty_assignments"    // group without any role assignment
+	UserWithoutRoles   Anomaly = "user_without_roles"   // user without roles, either direct or through groups
+	DirectGrant        Anomaly = "direct_grant"         // role granted to the user, and not through any group
+	MissingGenericRole Anomaly = "missing_generic_role" // component specific role without the generic one
+)
+
+// Actor kinds
+const (
+	User  = "user"
+	Group = "group"
+)
+
+// genericRoles maps each generic role to the component specific roles
+// that are expected to be granted along with it. Any of the generic
+// roles in the key (separated by "|") is enough.
+var genericRoles = map[string][]string{
+	"admin|ServiceAdmin": componentRoles("ServiceAdmin"),
+	"ServiceCustomer":    componentRoles("ServiceCustomer"),
+	"SubServiceAdmin":    componentRoles("SubServiceAdmin"),
+	"SubServiceCustomer": componentRoles("SubServiceCustomer"),
+}
+
+func componentRoles(prefix string) []string {
+	components := []string{"IOTAGENT", "ORION", "PERSEO", "STH"}
+	result := make([]string, 0, len(components))
+	for _, component := range components {
+		result = append(result, prefix+component)
+	}
+	return result
+}
+
+// Finding is an anomaly found for a user or group
+type Finding struct {
+	Domain  string   `json:"domain"`
+	Anomaly Anomaly  `json:"anomaly"`
+	Kind    string   `json:"kind"`
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`
+	Scope   string   `json:"scope,omitempty"`
+	Roles   []string `json:"roles,omitempty"`
+	Detail  string   `json:"detail,omitempty"`
+}
+
+// DomainSummary counts the resources audited in a domain
+type DomainSummary struct {
+	Name        string `json:"name"`
+	Users       int    `json:"users"`
+	Groups      int    `json:"groups"`
+	Roles       int    `json:"roles"`
+	Assignments int    `json:"assignments"`
+	Findings    int    `json:"findings"`
+	Error       string `json:"error,omitempty"`
+}
+
+// Report collects the findings of all the audited domains
+type Report struct {
+	Domains  []DomainSummary `json:"domains"`
+	Findings []Finding       `json:"findings"`
+}
+
+// Domain holds the keystone role data of a domain
+type Domain struct {
+	Name       string
+	Users      []models.User
+	Groups     []models.Group
+	Roles      []models.Role
+	UserRoles  map[string][]models.RoleAssignment // by user ID
+	GroupRoles map[string][]models.RoleAssignment // by group ID
+	Failed     map[string]error                   // by user or group ID
+}
+
+// Collect reads the users, groups, roles and assignments of the domain.
+// Failures reading the assignments of a particular user or group are
+// not fatal, they are kept in Domain.Failed.
+func Collect(client keystone.HTTPClient, k *keystone.Keystone, headers http.Header, domain string) (Domain, error) {
+	result := Domain{
+		Name:       domain,
+		UserRoles:  make(map[string][]models.RoleAssignment),
+		GroupRoles: make(map[string][]models.RoleAssignment),
+		Failed:     make(map[string]error),
+	}
+	var err error
+	if result.Users, err = k.Users(client, headers, domain); err != nil {
+		return result, fmt.Errorf("while reading users: %w", err)
+	}
+	if result.Groups, err = k.Groups(client, headers, domain); err != nil {
+		return result, fmt.Errorf("while reading groups: %w", err)
+	}
+	if result.Roles, err = k.Roles(client, headers, domain); err != nil {
+		return result, fmt.Errorf("while reading roles: %w", err)
+	}
+	for _, user := range result.Users {
+		assignments, err := k.UserRoles(client, headers, domain, []string{user.ID}, false)
+		if err != nil {
+			log.Printf("while reading assignments of user %s: %v", user.Name, err)
+			result.Failed[user.ID] = err
+			continue
+		}
+		result.UserRoles[user.ID] = assignments
+	}
+	for _, group := range result.Groups {
+		assignments, err := k.GroupRoles(client, headers, domain, []string{group.ID}, false)
+		if err != nil {
+			log.Printf("while reading assignments of group %s: %v", group.Name, err)
+			result.Failed[group.ID] = err
+			continue
+		}
+		result.GroupRoles[group.ID] = assignments
+	}
+	return result, nil
+}
+
+// scopeRoles groups the role names of the assignments by scope
+func scopeRoles(assignments []models.RoleAssignment) map[string][]string {
+	result := make(map[string][]string)
+	for _, assign := range assignments {
+		scope := assign.ScopeName
+		if assign.Inherited != "" {
+			scope = fmt.Sprintf("%s (inherited to %s)", scope, assign.Inherited)
+		}
+		if !slices.Contains(result[scope], assign.Role.Name) {
+			result[scope] = append(result[scope], assign.Role.Name)
+		}
+	}
+	for _, roles := range result {
+		slices.Sort(roles)
+	}
+	return result
+}
+
+// missingGeneric returns the generic roles that are missing
+// from the list, but have some component specific role granted.
+func missingGeneric(roles []string) []string {
+	var missing []string
+	for _, generic := range slices.Sorted(maps.Keys(genericRoles)) {
+		if !slices.ContainsFunc(strings.Split(generic, "|"), func(r string) bool { return slices.Contains(roles, r) }) &&
+			slices.ContainsFunc(genericRoles[generic], func(r string) bool { return slices.Contains(roles, r) }) {
+			missing = append(missing, generic)
+		}
+	}
+	return missing
+}
+
+// Check finds the anomalies in the domain role data
+func (d Domain) Check() []Finding {
+	var findings []Finding
+	finding := func(anomaly Anomaly, kind, id, name string) Finding {
+		return Finding{Domain: d.Name, Anomaly: anomaly, Kind: kind, ID: id, Name: name}
+	}
+	checkGeneric := func(kind, id, name string, assignments []models.RoleAssignment) {
+		byScope := scopeRoles(assignments)
+		for _, scope := range slices.Sorted(maps.Keys(byScope)) {
+			if missing := missingGeneric(byScope[scope]); len(missing) > 0 {
+				f := finding(MissingGenericRole, kind, id, name)
+				f.Scope, f.Roles = scope, byScope[scope]
+				f.Detail = fmt.Sprintf("missing %s", strings.Join(missing, ", "))
+				findings = append(findings, f)
+			}
+		}
+	}
+
+	// Groups
+	withRoles := make(map[string]bool)                 // users with roles granted through groups
+	groupRoles := make(map[string]map[string][]string) // roles by scope granted through groups, by user
+	for _, group := range d.Groups {
+		if err, failed := d.Failed[group.ID]; failed {
+			f := finding(AssignmentsFailed, Group, group.ID, group.Name)
+			f.Detail = err.Error()
+			findings = append(findings, f)
+		} else if len(d.GroupRoles[group.ID]) <= 0 {
+			f := finding(EmptyAssignments, Group, group.ID, group.Name)
+			f.Detail = fmt.Sprintf("group has %d users", len(group.Users))
+			findings = append(findings, f)
+			continue
+		}
+		// If the group could not be read, give its users the benefit of doubt
+		byScope := scopeRoles(d.GroupRoles[group.ID])
+		for _, user := range group.Users {
+			withRoles[user] = true
+			if groupRoles[user] == nil {
+				groupRoles[user] = make(map[string][]string)
+			}
+			for scope, roles := range byScope {
+				groupRoles[user][scope] = append(groupRoles[user][scope], roles...)
+			}
+		}
+		checkGeneric(Group, group.ID, group.Name, d.GroupRoles[group.ID])
+	}
+
+	// Users
+	for _, user := range d.Users {
+		if err, failed := d.Failed[user.ID]; failed {
+			f := finding(AssignmentsFailed, User, user.ID, user.Name)
+			f.Detail = err.Error()
+			findings = append(findings, f)
+			continue
+		}
+		assignments := d.UserRoles[user.ID]
+		if len(assignments) <= 0 {
+			if !withRoles[user.ID] {
+				findings = append(findings, finding(UserWithoutRoles, User, user.ID, user.Name))
+			}
+			continue
+		}
+		// Direct grants of roles also granted through some group are harmless
+		byScope := scopeRoles(assignments)
+		for _, scope := range slices.Sorted(maps.Keys(byScope)) {
+			direct := slices.DeleteFunc(slices.Clone(byScope[scope]), func(role string) bool {
+				return slices.Contains(groupRoles[user.ID][scope], role)
+			})
+			if len(direct) > 0 {
+				f := finding(DirectGrant, User, user.ID, user.Name)
+				f.Scope, f.Roles = scope, direct
+				findings = append(findings, f)
+			}
+		}
+		checkGeneric(User, user.ID, user.Name, assignments)
+	}
+	return findings
+}
+
+// Summary counts the resources in the domain
+func (d Domain) Summary() DomainSummary {
+	summary := DomainSummary{
+		Name:   d.Name,
+		Users:  len(d.Users),
+		Groups: len(d.Groups),
+		Roles:  len(d.Roles),
+	}
+	for _, assignments := range d.UserRoles {
+		summary.Assignments += len(assignments)
+	}
+	for _, assignments := range d.GroupRoles {
+		summary.Assignments += len(assignments)
+	}
+	return summary
+}
+
+// Roles audits the role assignments of all the given domains. Domains that
+// cannot be read are reported in the summary, and do not stop the audit.
+func Roles(client keystone.HTTPClient, k *keystone.Keystone, headers http.Header, domains []string) Report {
+	report := Report{
+		Domains:  make([]DomainSummary, 0, len(domains)),
+		Findings: make([]Finding, 0, 64),
+	}
+	for _, name := range domains {
+		log.Printf("Auditing domain %s", name)
+		domain, err := Collect(client, k, headers, name)
+		summary := domain.Summary()
+		if err != nil {
+			summary.Error = err.Error()
+		} else {
+			findings := domain.Check()
+			summary.Findings = len(findings)
+			report.Findings = append(report.Findings, findings...)
+		}
+		report.Domains = append(report.Domains, summary)
+	}
+	return report
+}
+
+// WriteJSON writes the report as indented JSON
+func (r Report) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+// WriteCSV writes the findings as CSV, one line per finding. Roles are
+// separated by spaces. Domains that failed are reported as findings
+// with an empty kind.
+func (r Report) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"domain", "anomaly", "kind", "id", "name", "scope", "roles", "detail"})
+	for _, domain := range r.Domains {
+		if domain.Error != "" {
+			writer.Write([]string{domain.Name, string(AssignmentsFailed), "", "", "", "", "", domain.Error})
+		}
+	}
+	for _, f := range r.Findings {
+		writer.Write([]string{f.Domain, string(f.Anomaly), f.Kind, f.ID, f.Name, f.Scope, strings.Join(f.Roles, " "), f.Detail})
+	}
+	writer.Flush()
+	return writer.Error()
+}
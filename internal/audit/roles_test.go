@@ -0,0 +1,136 @@
+package audit
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/warpcomdev/fiware/models"
+)
+
+func testUser(id string) models.User {
+	return models.User{Name: id, UserStatus: models.UserStatus{ID: id}}
+}
+
+func testGroup(id string, users ...string) models.Group {
+	return models.Group{Name: id, GroupStatus: models.GroupStatus{ID: id, Users: users}}
+}
+
+func testAssignment(scope string, roles ...string) []models.RoleAssignment {
+	result := make([]models.RoleAssignment, 0, len(roles))
+	for _, role := range roles {
+		result = append(result, models.RoleAssignment{
+			Role:                 models.AssignmentID{Name: role},
+			RoleAssignmentStatus: models.RoleAssignmentStatus{ScopeName: scope},
+		})
+	}
+	return result
+}
+
+// summary describes the finding in a single line, for comparison
+func summary(f Finding) string {
+	return fmt.Sprintf("%s %s %s %s %v %s", f.Anomaly, f.Kind, f.ID, f.Scope, f.Roles, f.Detail)
+}
+
+func TestDomainCheck(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		domain   Domain
+		findings []string
+	}{
+		{
+			name: "roles through groups",
+			domain: Domain{
+				Users:      []models.User{testUser("alice")},
+				Groups:     []models.Group{testGroup("operators", "alice")},
+				GroupRoles: map[string][]models.RoleAssignment{"operators": testAssignment("/riego", "SubServiceCustomer")},
+			},
+		},
+		{
+			name: "assignments failed",
+			domain: Domain{
+				Users:  []models.User{testUser("alice")},
+				Groups: []models.Group{testGroup("operators", "alice")},
+				Failed: map[string]error{"alice": errors.New("timeout"), "operators": errors.New("forbidden")},
+			},
+			findings: []string{
+				"assignments_failed group operators  [] forbidden",
+				"assignments_failed user alice  [] timeout",
+			},
+		},
+		{
+			name: "empty assignments",
+			domain: Domain{
+				Users:     []models.User{testUser("alice")},
+				Groups:    []models.Group{testGroup("operators", "alice")},
+				UserRoles: map[string][]models.RoleAssignment{"alice": testAssignment("/riego", "SubServiceCustomer")},
+			},
+			findings: []string{
+				"empty_assignments group operators  [] group has 1 users",
+				"direct_grant user alice /riego [SubServiceCustomer] ",
+			},
+		},
+		{
+			name: "user without roles",
+			domain: Domain{
+				Users: []models.User{testUser("alice")},
+			},
+			findings: []string{"user_without_roles user alice  [] "},
+		},
+		{
+			name: "direct grant",
+			domain: Domain{
+				Users:      []models.User{testUser("alice")},
+				Groups:     []models.Group{testGroup("operators", "alice")},
+				UserRoles:  map[string][]models.RoleAssignment{"alice": testAssignment("/riego", "SubServiceAdmin", "SubServiceCustomer")},
+				GroupRoles: map[string][]models.RoleAssignment{"operators": testAssignment("/riego", "SubServiceCustomer")},
+			},
+			findings: []string{"direct_grant user alice /riego [SubServiceAdmin] "},
+		},
+		{
+			name: "direct grant covered by a group",
+			domain: Domain{
+				Users:      []models.User{testUser("alice")},
+				Groups:     []models.Group{testGroup("operators", "alice")},
+				UserRoles:  map[string][]models.RoleAssignment{"alice": testAssignment("/riego", "SubServiceCustomer")},
+				GroupRoles: map[string][]models.RoleAssignment{"operators": testAssignment("/riego", "SubServiceCustomer")},
+			},
+		},
+		{
+			name: "direct grant covered in another scope",
+			domain: Domain{
+				Users:      []models.User{testUser("alice")},
+				Groups:     []models.Group{testGroup("operators", "alice")},
+				UserRoles:  map[string][]models.RoleAssignment{"alice": testAssignment("/other", "SubServiceCustomer")},
+				GroupRoles: map[string][]models.RoleAssignment{"operators": testAssignment("/riego", "SubServiceCustomer")},
+			},
+			findings: []string{"direct_grant user alice /other [SubServiceCustomer] "},
+		},
+		{
+			name: "missing generic role",
+			domain: Domain{
+				Groups:     []models.Group{testGroup("operators")},
+				GroupRoles: map[string][]models.RoleAssignment{"operators": testAssignment("/riego", "SubServiceAdminORION", "SubServiceCustomer")},
+			},
+			findings: []string{"missing_generic_role group operators /riego [SubServiceAdminORION SubServiceCustomer] missing SubServiceAdmin"},
+		},
+		{
+			name: "generic role alternatives",
+			domain: Domain{
+				Groups:     []models.Group{testGroup("admins")},
+				GroupRoles: map[string][]models.RoleAssignment{"admins": testAssignment("/", "admin", "ServiceAdminORION")},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var got []string
+			for _, f := range tc.domain.Check() {
+				got = append(got, summary(f))
+			}
+			if !slices.Equal(got, tc.findings) {
+				t.Errorf("expected findings %q, got %q", tc.findings, got)
+			}
+		})
+	}
+}
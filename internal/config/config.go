@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"maps"
 	"slices"
+	"time"
 )
 
 type stringError string
@@ -43,7 +44,13 @@ type Config struct {
 	JenkinsLabel  string            `json:"jenkinsLabel"`
 	JenkinsFolder string            `json:"jenkinsFolder"`
 	BIConnection  string            `json:"biConnection"`
+	Retries       string            `json:"retries,omitempty"`
+	RetryDelay    string            `json:"retryDelay,omitempty"`
+	SecretHelper  string            `json:"secretHelper,omitempty"`
+	NGSI          string            `json:"ngsi,omitempty"`
+	LDContext     string            `json:"ldContext,omitempty"`
 	Token         string            `json:"token,omitempty"`
+	TokenExpiry   time.Time         `json:"tokenExpiry,omitzero"`
 	UrboToken     string            `json:"urbotoken,omitempty"`
 	Params        map[string]string `json:"params,omitempty"`
 	ProjectCache  []string          `json:"projects,omitempty"`
@@ -110,6 +117,11 @@ func (c *Config) pairs() map[string]*string {
 		"jenkinsFolder": &c.JenkinsFolder,
 		"biConnection":  &c.BIConnection,
 		"username":      &c.Username,
+		"retries":       &c.Retries,
+		"retryDelay":    &c.RetryDelay,
+		"secretHelper":  &c.SecretHelper,
+		"ngsi":          &c.NGSI,
+		"ldContext":     &c.LDContext,
 	}
 	return p
 }
@@ -183,7 +195,10 @@ func (c *Config) HasUrboToken() string {
 	return c.UrboToken
 }
 
-func (c *Config) SetCredentials(token, urboToken string) {
+// SetCredentials updates the tokens and the keystone token expiration.
+// The expiry can be zero if unknown.
+func (c *Config) SetCredentials(token, urboToken string, expiry time.Time) {
 	c.Token = token
 	c.UrboToken = urboToken
+	c.TokenExpiry = expiry
 }
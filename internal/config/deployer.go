@@ -69,3 +69,13 @@ func EndpointsFromParams(cfgParams map[string]string) map[string]string {
 	}
 	return result
 }
+
+// NotificationEndpoints merges the notification endpoints of the
+// context with those of a manifest, which take precedence.
+func NotificationEndpoints(cfg Config, manifestEndpoints map[string]string) map[string]string {
+	ep := FromConfig(cfg).NotificationEndpoints
+	for k, v := range manifestEndpoints {
+		ep[k] = v
+	}
+	return ep
+}
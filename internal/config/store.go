@@ -9,6 +9,7 @@ import (
 	"runtime"
 	"sort"
 	"strings"
+	"time"
 )
 
 // Store can manage several configs
@@ -334,6 +335,7 @@ func (s *Store) Set(contextName string, strPairs map[string]string) ([]string, e
 				value = ""
 			}
 			cfg.Token = value
+			cfg.TokenExpiry = time.Time{} // unknown for manually set tokens
 		case "urbotoken":
 			fallthrough
 		case "urboToken":
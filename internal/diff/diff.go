@@ -0,0 +1,405 @@
+// Package diff compares two manifests resource by resource, ignoring
+// the status sub-structures that the platform adds to every resource.
+package diff
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/warpcomdev/fiware/models"
+)
+
+// Action describes what happened to a resource between two manifests
+type Action string
+
+const (
+	Added   Action = "added"   // resource only in the desired manifest
+	Removed Action = "removed" // resource only in the current manifest
+	Changed Action = "changed" // resource in both manifests, but different
+)
+
+// Resource kinds supported by the diff. The names match the
+// asset names used by snapshots.Project.
+const (
+	Subscriptions = "subscriptions"
+	Rules         = "rules"
+	DeviceGroups  = "services"
+	Devices       = "devices"
+	Entities      = "entities"
+)
+
+// Kinds lists all the resource kinds supported, in output order
+var Kinds = []string{Subscriptions, Rules, DeviceGroups, Devices, Entities}
+
+// ManifestKinds returns the kinds of resources that are present in the manifest
+func ManifestKinds(m models.Manifest) []string {
+	kinds := make([]string, 0, len(Kinds))
+	if len(m.Subscriptions) > 0 {
+		kinds = append(kinds, Subscriptions)
+	}
+	if len(m.Rules) > 0 {
+		kinds = append(kinds, Rules)
+	}
+	if len(m.DeviceGroups) > 0 {
+		kinds = append(kinds, DeviceGroups)
+	}
+	if len(m.Devices) > 0 {
+		kinds = append(kinds, Devices)
+	}
+	if len(m.Entities) > 0 {
+		kinds = append(kinds, Entities)
+	}
+	return kinds
+}
+
+// Change is a single field that differs between two versions of a resource
+type Change struct {
+	Path string          `json:"path"`
+	Old  json.RawMessage `json:"old,omitempty"`
+	New  json.RawMessage `json:"new,omitempty"`
+}
+
+// Resource describes the differences found for a single resource
+type Resource struct {
+	Kind    string   `json:"kind"`
+	Key     string   `json:"key"`
+	Action  Action   `json:"action"`
+	Changes []Change `json:"changes,omitempty"`
+	// Current and Desired versions of the resource, as found in each
+	// manifest, for callers that need to act on the diff. Current is
+	// nil for Added resources, and Desired is nil for Removed ones.
+	Current any `json:"-"`
+	Desired any `json:"-"`
+}
+
+// Report collects the differences between two manifests
+type Report struct {
+	Resources []Resource `json:"resources"`
+}
+
+// Empty is true if no differences were found
+func (r Report) Empty() bool {
+	return len(r.Resources) <= 0
+}
+
+// Count the resources in the report with the given action
+func (r Report) Count(action Action) int {
+	count := 0
+	for _, res := range r.Resources {
+		if res.Action == action {
+			count += 1
+		}
+	}
+	return count
+}
+
+// Write a human readable version of the report
+func (r Report) Write(w io.Writer) error {
+	var buf strings.Builder
+	if r.Empty() {
+		buf.WriteString("no differences found\n")
+	} else {
+		lastKind := ""
+		for _, res := range r.Resources {
+			if res.Kind != lastKind {
+				fmt.Fprintf(&buf, "%s:\n", res.Kind)
+				lastKind = res.Kind
+			}
+			switch res.Action {
+			case Added:
+				fmt.Fprintf(&buf, "  + %s\n", res.Key)
+			case Removed:
+				fmt.Fprintf(&buf, "  - %s\n", res.Key)
+			default:
+				fmt.Fprintf(&buf, "  ~ %s\n", res.Key)
+				for _, change := range res.Changes {
+					fmt.Fprintf(&buf, "      %s: %s => %s\n", change.Path, rawOrNone(change.Old), rawOrNone(change.New))
+				}
+			}
+		}
+		fmt.Fprintf(&buf, "%d added, %d removed, %d changed\n", r.Count(Added), r.Count(Removed), r.Count(Changed))
+	}
+	_, err := io.WriteString(w, buf.String())
+	return err
+}
+
+func rawOrNone(raw json.RawMessage) string {
+	if len(raw) <= 0 {
+		return "<none>"
+	}
+	return string(raw)
+}
+
+// Manifests compares the current and desired manifests. Only the given
+// kinds of resources are compared. The notification endpoints are used
+// to resolve subscription URLs in both manifests before comparing them,
+// so that "HISTORIC" and the actual URL it stands for are considered equal.
+//
+// Entities are only compared for the entity types present in the desired
+// manifest, so that a manifest with a single type does not report every
+// other entity in the subservice as removed.
+func Manifests(current, desired models.Manifest, kinds []string, endpoints map[string]string) (Report, error) {
+	report := Report{Resources: make([]Resource, 0, 16)}
+	for _, kind := range Kinds {
+		if !slices.Contains(kinds, kind) {
+			continue
+		}
+		var err error
+		switch kind {
+		case Subscriptions:
+			err = compare(&report, kind,
+				slices.Collect(maps.Values(current.Subscriptions)),
+				slices.Collect(maps.Values(desired.Subscriptions)),
+				SubscriptionKey, subscriptionNormalizer(endpoints))
+		case Rules:
+			err = compare(&report, kind, rules(current.Rules), rules(desired.Rules), RuleKey, normalizeRule)
+		case DeviceGroups:
+			err = compare(&report, kind, current.DeviceGroups, desired.DeviceGroups, DeviceGroupKey, normalizeDeviceGroup)
+		case Devices:
+			err = compare(&report, kind, current.Devices, desired.Devices, DeviceKey, normalizeDevice)
+		case Entities:
+			err = compare(&report, kind, modelledEntities(current.Entities, desired), desired.Entities, EntityKey, nil)
+		}
+		if err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// SubscriptionKey identifies a subscription by description, or ID if missing
+func SubscriptionKey(sub models.Subscription) string {
+	if sub.Description != "" {
+		return sub.Description
+	}
+	return sub.ID
+}
+
+// RuleKey identifies a rule by name
+func RuleKey(rule models.Rule) string {
+	return rule.Name
+}
+
+// DeviceGroupKey identifies a device group by protocol, resource and apikey
+func DeviceGroupKey(group models.DeviceGroup) string {
+	return fmt.Sprintf("%s:%s:%s", group.Protocol, group.Resource, group.APIKey)
+}
+
+// DeviceKey identifies a device by device ID
+func DeviceKey(device models.Device) string {
+	return device.DeviceId
+}
+
+// EntityKey identifies an entity by type and ID
+func EntityKey(entity models.Entity) string {
+	return entity.Type + "/" + entity.ID
+}
+
+// The normalizers below clear the same status fields as
+// models.Manifest.ClearStatus, one resource at a time.
+
+// subscriptionNormalizer clears status, resolves notification URLs
+// and fills the same defaults that Orion.PostSuscriptions does.
+// The top-level status is not part of SubscriptionStatus, because it
+// can be set by the user: it defaults to "active" in Orion, which
+// also reports "failed" and "expired" for active subscriptions.
+func subscriptionNormalizer(endpoints map[string]string) func(models.Subscription) models.Subscription {
+	resolve := func(url *string) {
+		if ep, ok := endpoints[*url]; ok && *url != "" {
+			*url = ep
+		}
+	}
+	return func(sub models.Subscription) models.Subscription {
+		sub.SubscriptionStatus = models.SubscriptionStatus{}
+		sub.Notification.NotificationStatus = models.NotificationStatus{}
+		switch sub.Status {
+		case "", "failed", "expired":
+			sub.Status = "active"
+		}
+		if sub.Notification.AttrsFormat == "" {
+			sub.Notification.AttrsFormat = "normalized"
+		}
+		resolve(&sub.Notification.HTTP.URL)
+		resolve(&sub.Notification.HTTPCustom.URL)
+		resolve(&sub.Notification.MQTT.URL)
+		resolve(&sub.Notification.MQTTCustom.URL)
+		return sub
+	}
+}
+
+func normalizeRule(rule models.Rule) models.Rule {
+	rule.RuleStatus = models.RuleStatus{}
+	return rule
+}
+
+func normalizeDeviceGroup(group models.DeviceGroup) models.DeviceGroup {
+	group.ServiceStatus = models.ServiceStatus{}
+	return group
+}
+
+func normalizeDevice(device models.Device) models.Device {
+	device.DeviceStatus = models.DeviceStatus{}
+	return device
+}
+
+// rules turns the map into a list, naming rules after their key if needed
+func rules(rules map[string]models.Rule) []models.Rule {
+	result := make([]models.Rule, 0, len(rules))
+	for name, rule := range rules {
+		if rule.Name == "" {
+			rule.Name = name
+		}
+		result = append(result, rule)
+	}
+	return result
+}
+
+// modelledEntities filters the entities whose type is in the manifest
+func modelledEntities(entities []models.Entity, manifest models.Manifest) []models.Entity {
+	types := make(map[string]struct{})
+	for _, entity := range manifest.Entities {
+		types[entity.Type] = struct{}{}
+	}
+	result := make([]models.Entity, 0, len(entities))
+	for _, entity := range entities {
+		if _, ok := types[entity.Type]; ok {
+			result = append(result, entity)
+		}
+	}
+	return result
+}
+
+// compare two lists of resources and add the differences to the report.
+// Resources are normalized before comparing, but the report keeps the
+// original versions.
+func compare[T any](report *Report, kind string, current, desired []T, key func(T) string, normalize func(T) T) error {
+	currentMap := make(map[string]T, len(current))
+	for _, item := range current {
+		currentMap[key(item)] = item
+	}
+	desiredMap := make(map[string]T, len(desired))
+	for _, item := range desired {
+		desiredMap[key(item)] = item
+	}
+	keys := slices.Sorted(maps.Keys(currentMap))
+	for k := range desiredMap {
+		if _, ok := currentMap[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		c, inCurrent := currentMap[k]
+		d, inDesired := desiredMap[k]
+		switch {
+		case !inCurrent:
+			report.Resources = append(report.Resources, Resource{Kind: kind, Key: k, Action: Added, Desired: d})
+		case !inDesired:
+			report.Resources = append(report.Resources, Resource{Kind: kind, Key: k, Action: Removed, Current: c})
+		default:
+			nc, nd := c, d
+			if normalize != nil {
+				nc, nd = normalize(c), normalize(d)
+			}
+			changes, err := Fields(nc, nd)
+			if err != nil {
+				return fmt.Errorf("failed to compare %s %s: %w", kind, k, err)
+			}
+			if len(changes) > 0 {
+				report.Resources = append(report.Resources, Resource{Kind: kind, Key: k, Action: Changed, Changes: changes, Current: c, Desired: d})
+			}
+		}
+	}
+	return nil
+}
+
+// Fields compares the JSON representation of two objects, and
+// returns the list of paths with different values.
+func Fields(current, desired any) ([]Change, error) {
+	c, err := generic(current)
+	if err != nil {
+		return nil, err
+	}
+	d, err := generic(desired)
+	if err != nil {
+		return nil, err
+	}
+	changes := make([]Change, 0, 4)
+	walk("", c, d, &changes)
+	return changes, nil
+}
+
+// generic turns an object into the generic JSON representation
+func generic(v any) (any, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var result any
+	if err := decoder.Decode(&result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// walk both values in parallel, collecting changes.
+// Objects are compared field by field, and lists item
+// by item as long as they have the same length.
+func walk(path string, current, desired any, changes *[]Change) {
+	switch c := current.(type) {
+	case map[string]any:
+		if d, ok := desired.(map[string]any); ok {
+			keys := slices.Sorted(maps.Keys(c))
+			for k := range d {
+				if _, ok := c[k]; !ok {
+					keys = append(keys, k)
+				}
+			}
+			slices.Sort(keys)
+			for _, k := range keys {
+				walk(joinPath(path, k), c[k], d[k], changes)
+			}
+			return
+		}
+	case []any:
+		if d, ok := desired.([]any); ok && len(c) == len(d) {
+			for i := range c {
+				walk(fmt.Sprintf("%s[%d]", path, i), c[i], d[i], changes)
+			}
+			return
+		}
+	}
+	oldRaw, newRaw := rawValue(current), rawValue(desired)
+	if !bytes.Equal(oldRaw, newRaw) {
+		if path == "" {
+			path = "."
+		}
+		*changes = append(*changes, Change{Path: path, Old: oldRaw, New: newRaw})
+	}
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// rawValue marshals a generic value, returns nil for missing values
+func rawValue(v any) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return json.RawMessage(fmt.Sprintf("%q", err.Error()))
+	}
+	return raw
+}
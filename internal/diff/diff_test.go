@@ -0,0 +1,144 @@
+package diff
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/warpcomdev/fiware/models"
+)
+
+func testSubscription(description, url string, attrs ...string) models.Subscription {
+	return models.Subscription{
+		Description: description,
+		Subject: models.Subject{
+			Entities: []models.SubjectEntity{{IdPattern: ".*", Type: "Sensor"}},
+		},
+		Notification: models.Notification{
+			Attrs:      attrs,
+			HTTPCustom: models.NotificationCustom{URL: url},
+		},
+	}
+}
+
+func TestManifestsActions(t *testing.T) {
+	current := models.Manifest{Rules: map[string]models.Rule{
+		"kept":    {Name: "kept", Text: "select 1"},
+		"changed": {Name: "changed", Text: "select 2"},
+		"removed": {Name: "removed", Text: "select 3"},
+	}}
+	desired := models.Manifest{Rules: map[string]models.Rule{
+		"kept":    {Text: "select 1"},
+		"changed": {Text: "select 22"},
+		"added":   {Text: "select 4"},
+	}}
+	report, err := Manifests(current, desired, []string{Rules}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]Action)
+	for _, res := range report.Resources {
+		got[res.Key] = res.Action
+	}
+	want := map[string]Action{"added": Added, "removed": Removed, "changed": Changed}
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for key, action := range want {
+		if got[key] != action {
+			t.Errorf("expected rule %s to be %s, got %s", key, action, got[key])
+		}
+	}
+	for _, res := range report.Resources {
+		if res.Key == "changed" && (len(res.Changes) != 1 || res.Changes[0].Path != "text") {
+			t.Errorf("expected only the text to change, got %+v", res.Changes)
+		}
+	}
+}
+
+func TestManifestsIgnoresStatus(t *testing.T) {
+	live := testSubscription("lastdata", "http://cygnus:5051/notify", "temperature")
+	live.ID = "5f0000000000000000000001"
+	live.Status = "failed"
+	live.Notification.TimesSent = 10
+	desired := testSubscription("lastdata", "LASTDATA", "temperature")
+	endpoints := map[string]string{"LASTDATA": "http://cygnus:5051/notify"}
+
+	report, err := Manifests(
+		models.Manifest{Subscriptions: map[string]models.Subscription{live.ID: live}},
+		models.Manifest{Subscriptions: map[string]models.Subscription{"lastdata": desired}},
+		[]string{Subscriptions}, endpoints)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Empty() {
+		t.Errorf("expected no differences, got %+v", report.Resources)
+	}
+
+	// An explicit inactive status is a real difference
+	desired.Status = "inactive"
+	report, err = Manifests(
+		models.Manifest{Subscriptions: map[string]models.Subscription{live.ID: live}},
+		models.Manifest{Subscriptions: map[string]models.Subscription{"lastdata": desired}},
+		[]string{Subscriptions}, endpoints)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Count(Changed) != 1 || report.Resources[0].Changes[0].Path != "status" {
+		t.Errorf("expected a status change, got %+v", report.Resources)
+	}
+}
+
+func TestManifestsOnlyModelledEntities(t *testing.T) {
+	entity := func(entityType, id, value string) models.Entity {
+		return models.Entity{ID: id, Type: entityType, Attrs: map[string]json.RawMessage{"value": json.RawMessage(value)}}
+	}
+	current := models.Manifest{Entities: []models.Entity{
+		entity("Sensor", "s1", "1"),
+		entity("Pump", "p1", "2"),
+	}}
+	desired := models.Manifest{Entities: []models.Entity{entity("Sensor", "s1", "3")}}
+	report, err := Manifests(current, desired, []string{Entities}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Resources) != 1 || report.Resources[0].Key != "Sensor/s1" || report.Resources[0].Action != Changed {
+		t.Errorf("expected only Sensor/s1 changed, got %+v", report.Resources)
+	}
+}
+
+func TestFieldsLists(t *testing.T) {
+	changes, err := Fields(
+		map[string]any{"attrs": []string{"a", "b"}, "big": json.Number("9007199254740993")},
+		map[string]any{"attrs": []string{"a", "c"}, "big": json.Number("9007199254740992")},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := make([]string, 0, len(changes))
+	for _, change := range changes {
+		paths = append(paths, change.Path)
+	}
+	if got := strings.Join(paths, ","); got != "attrs[1],big" {
+		t.Errorf("expected changes in attrs[1] and big, got %s", got)
+	}
+}
+
+func TestReportWrite(t *testing.T) {
+	var buf strings.Builder
+	if err := (Report{}).Write(&buf); err != nil || buf.String() != "no differences found\n" {
+		t.Errorf("unexpected empty report %q (%v)", buf.String(), err)
+	}
+	buf.Reset()
+	report := Report{Resources: []Resource{
+		{Kind: Rules, Key: "a", Action: Added},
+		{Kind: Rules, Key: "b", Action: Changed, Changes: []Change{{Path: "text", Old: json.RawMessage(`"x"`)}}},
+	}}
+	if err := report.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := "rules:\n  + a\n  ~ b\n      text: \"x\" => <none>\n1 added, 0 removed, 1 changed\n"
+	if buf.String() != want {
+		t.Errorf("expected %q, got %q", want, buf.String())
+	}
+}
@@ -0,0 +1,188 @@
+// Package fakeplatform serves a fake FIWARE platform (Keystone, Orion v2
+// and NGSI-LD, Perseo, IoTA manager and Urbo) from in-memory state, using
+// httptest servers. It is meant for testing any keystone.HTTPClient
+// consumer without a real environment:
+//
+//	platform := fakeplatform.New()
+//	defer platform.Close()
+//	selected := platform.Config()
+//	api, _ := orion.New(selected.OrionURL)
+//	types, entities, err := api.Entities(http.DefaultClient, platform.Headers("/"), "", "", "", 0)
+//
+// Resources are stored per Fiware-ServicePath. Only one service (keystone
+// domain) is supported, and every request must carry the platform token.
+package fakeplatform
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+
+	"github.com/warpcomdev/fiware/internal/config"
+	"github.com/warpcomdev/fiware/keystone"
+)
+
+// Platform is a fake FIWARE platform with in-memory state
+type Platform struct {
+	Service   string // Service (keystone domain) name
+	Username  string // Username accepted by keystone and urbo login
+	Password  string // Password accepted by keystone and urbo login
+	Token     string // Token issued by keystone, required by every API
+	UrboToken string // Token issued by urbo, required by the urbo API
+
+	Keystone *httptest.Server
+	Orion    *httptest.Server
+	Perseo   *httptest.Server
+	Iotam    *httptest.Server
+	Urbo     *httptest.Server
+
+	mu       sync.Mutex
+	lastID   int
+	keystone keystoneState
+	orion    map[string]*orionState
+	perseo   map[string]*perseoState
+	iotam    map[string]*iotamState
+	urbo     urboState
+}
+
+// New starts a fake platform with an empty state, and a domain
+// named "service" with a single user "admin".
+func New() *Platform {
+	p := &Platform{
+		Service:   "service",
+		Username:  "admin",
+		Password:  "password",
+		Token:     "fake-keystone-token",
+		UrboToken: "fake-urbo-token",
+		orion:     make(map[string]*orionState),
+		perseo:    make(map[string]*perseoState),
+		iotam:     make(map[string]*iotamState),
+	}
+	p.keystone = newKeystoneState(p)
+	p.urbo = newUrboState()
+	p.Keystone = httptest.NewServer(p.keystoneHandler())
+	p.Orion = httptest.NewServer(p.requireToken(p.orionHandler()))
+	p.Perseo = httptest.NewServer(p.requireToken(p.perseoHandler()))
+	p.Iotam = httptest.NewServer(p.requireToken(p.iotamHandler()))
+	p.Urbo = httptest.NewServer(p.urboHandler())
+	return p
+}
+
+// Close shuts down all the servers
+func (p *Platform) Close() {
+	p.Keystone.Close()
+	p.Orion.Close()
+	p.Perseo.Close()
+	p.Iotam.Close()
+	p.Urbo.Close()
+}
+
+// Config returns a context configured to use the fake platform,
+// already logged in, and with the given subservice selected.
+func (p *Platform) Config(subservice string) config.Config {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return config.Config{
+		Name:        "fake",
+		Type:        "DEV",
+		Customer:    "fake",
+		KeystoneURL: p.Keystone.URL + "/",
+		OrionURL:    p.Orion.URL + "/",
+		IotamURL:    p.Iotam.URL + "/",
+		PerseoURL:   p.Perseo.URL + "/",
+		UrboURL:     p.Urbo.URL + "/",
+		Service:     p.Service,
+		Subservice:  subservice,
+		Username:    p.Username,
+		Token:       p.Token,
+		UrboToken:   p.UrboToken,
+	}
+}
+
+// Headers returns the headers needed to query the subservice
+func (p *Platform) Headers(subservice string) http.Header {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	k := keystone.Keystone{Service: p.Service}
+	return k.Headers(subservice, p.Token)
+}
+
+// RotateToken invalidates the current keystone and urbo tokens, as if
+// they had expired. Next logins will get the new tokens.
+func (p *Platform) RotateToken() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Token = "fake-keystone-token-" + p.nextID()
+	p.UrboToken = "fake-urbo-token-" + p.nextID()
+}
+
+// nextID generates a new unique ID. Must be called with the lock held.
+func (p *Platform) nextID() string {
+	p.lastID += 1
+	return fmt.Sprintf("%024x", p.lastID)
+}
+
+// requireToken rejects requests without the keystone token
+func (p *Platform) requireToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		token := p.Token
+		p.mu.Unlock()
+		if r.Header.Get("X-Auth-Token") != token {
+			writeError(w, http.StatusUnauthorized, "invalid token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// servicePath returns the subservice of the request
+func servicePath(r *http.Request) string {
+	if path := r.Header.Get("Fiware-ServicePath"); path != "" {
+		return path
+	}
+	return "/"
+}
+
+// readJSON decodes the request body
+func readJSON(r *http.Request, data any) error {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, data)
+}
+
+// writeJSON encodes the reply
+func writeJSON(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
+
+// writeError replies with an error in orion format
+func writeError(w http.ResponseWriter, status int, description string) {
+	writeJSON(w, status, map[string]string{
+		"error":       http.StatusText(status),
+		"description": description,
+	})
+}
+
+// writePage writes a page of items, following orion pagination
+// conventions (offset, limit and Fiware-Total-Count header)
+func writePage[T any](w http.ResponseWriter, r *http.Request, items []T) {
+	query := r.URL.Query()
+	offset, _ := strconv.Atoi(query.Get("offset"))
+	limit, err := strconv.Atoi(query.Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 20
+	}
+	offset = min(max(offset, 0), len(items))
+	top := min(offset+limit, len(items))
+	w.Header().Set("Fiware-Total-Count", strconv.Itoa(len(items)))
+	writeJSON(w, http.StatusOK, items[offset:top])
+}
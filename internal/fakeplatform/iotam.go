@@ -0,0 +1,189 @@
+package fakeplatform
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+
+	"github.com/warpcomdev/fiware/models"
+)
+
+type iotamState struct {
+	services []models.DeviceGroup
+	devices  []models.Device
+}
+
+// iotamPath returns the state of the request subservice. Must hold the lock.
+func (p *Platform) iotamPath(r *http.Request) *iotamState {
+	path := servicePath(r)
+	state, ok := p.iotam[path]
+	if !ok {
+		state = &iotamState{}
+		p.iotam[path] = state
+	}
+	return state
+}
+
+// patch overlays the fields in the request body over the item
+func patch[T any](item *T, r *http.Request) error {
+	var fields object
+	if err := readJSON(r, &fields); err != nil {
+		return err
+	}
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	var current object
+	if err := json.Unmarshal(data, &current); err != nil {
+		return err
+	}
+	for key, value := range fields {
+		current[key] = value
+	}
+	if data, err = json.Marshal(current); err != nil {
+		return err
+	}
+	return json.Unmarshal(data, item)
+}
+
+func (p *Platform) iotamHandler() http.Handler {
+	mux := http.NewServeMux()
+	findService := func(state *iotamState, r *http.Request) int {
+		query := r.URL.Query()
+		return slices.IndexFunc(state.services, func(g models.DeviceGroup) bool {
+			return g.Resource == query.Get("resource") && g.APIKey == query.Get("apikey") && g.Protocol == query.Get("protocol")
+		})
+	}
+	findDevice := func(state *iotamState, r *http.Request) int {
+		return slices.IndexFunc(state.devices, func(d models.Device) bool {
+			return d.DeviceId == r.PathValue("id") && d.Protocol == r.URL.Query().Get("protocol")
+		})
+	}
+
+	// Services (device groups)
+	mux.HandleFunc("GET /iot/services", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		services := p.iotamPath(r).services
+		writeJSON(w, http.StatusOK, map[string]any{"count": len(services), "services": services})
+	})
+	mux.HandleFunc("POST /iot/services", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Services []models.DeviceGroup `json:"services"`
+		}
+		if err := readJSON(r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		state := p.iotamPath(r)
+		for _, service := range req.Services {
+			if slices.ContainsFunc(state.services, func(g models.DeviceGroup) bool {
+				return g.Resource == service.Resource && g.APIKey == service.APIKey && g.Protocol == service.Protocol
+			}) {
+				writeError(w, http.StatusConflict, "duplicated group")
+				return
+			}
+		}
+		for _, service := range req.Services {
+			service.ServiceStatus = models.ServiceStatus{
+				ID:          p.nextID(),
+				Service:     r.Header.Get("Fiware-Service"),
+				ServicePath: servicePath(r),
+			}
+			state.services = append(state.services, service)
+		}
+		w.WriteHeader(http.StatusCreated)
+	})
+	mux.HandleFunc("PUT /iot/services", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		state := p.iotamPath(r)
+		index := findService(state, r)
+		if index < 0 {
+			writeError(w, http.StatusNotFound, "group not found")
+			return
+		}
+		if err := patch(&state.services[index], r); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("DELETE /iot/services", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		state := p.iotamPath(r)
+		index := findService(state, r)
+		if index < 0 {
+			writeError(w, http.StatusNotFound, "group not found")
+			return
+		}
+		state.services = slices.Delete(state.services, index, index+1)
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	// Devices
+	mux.HandleFunc("GET /iot/devices", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		devices := p.iotamPath(r).devices
+		writeJSON(w, http.StatusOK, map[string]any{"count": len(devices), "devices": devices})
+	})
+	mux.HandleFunc("POST /iot/devices", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Devices []models.Device `json:"devices"`
+		}
+		if err := readJSON(r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		state := p.iotamPath(r)
+		for _, device := range req.Devices {
+			if slices.ContainsFunc(state.devices, func(d models.Device) bool { return d.DeviceId == device.DeviceId }) {
+				writeError(w, http.StatusConflict, "duplicated device")
+				return
+			}
+		}
+		for _, device := range req.Devices {
+			device.DeviceStatus = models.DeviceStatus{
+				Service:     r.Header.Get("Fiware-Service"),
+				ServicePath: servicePath(r),
+			}
+			state.devices = append(state.devices, device)
+		}
+		w.WriteHeader(http.StatusCreated)
+	})
+	mux.HandleFunc("PUT /iot/devices/{id}", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		state := p.iotamPath(r)
+		index := findDevice(state, r)
+		if index < 0 {
+			writeError(w, http.StatusNotFound, "device not found")
+			return
+		}
+		if err := patch(&state.devices[index], r); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("DELETE /iot/devices/{id}", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		state := p.iotamPath(r)
+		index := findDevice(state, r)
+		if index < 0 {
+			writeError(w, http.StatusNotFound, "device not found")
+			return
+		}
+		state.devices = slices.Delete(state.devices, index, index+1)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return mux
+}
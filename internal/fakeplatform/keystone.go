@@ -0,0 +1,466 @@
+package fakeplatform
+
+import (
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/warpcomdev/fiware/models"
+)
+
+// assignment of a role to a user or group, at project or domain scope
+type assignment struct {
+	RoleID    string
+	Kind      string // "users" or "groups"
+	ActorID   string
+	ScopeKind string // "projects" or "domains"
+	ScopeID   string
+	Inherited bool
+}
+
+type keystoneState struct {
+	domain      models.Domain
+	projects    []models.Project
+	users       []models.User
+	groups      []models.Group
+	members     map[string][]string // group ID to user IDs
+	roles       []models.Role
+	assignments []assignment
+}
+
+func newKeystoneState(p *Platform) keystoneState {
+	domainID := p.nextID()
+	return keystoneState{
+		domain: models.Domain{
+			Name:         p.Service,
+			Enabled:      true,
+			DomainStatus: models.DomainStatus{ID: domainID},
+		},
+		users: []models.User{{
+			Name:       p.Username,
+			Enabled:    true,
+			DomainID:   domainID,
+			UserStatus: models.UserStatus{ID: p.nextID()},
+		}},
+		members: make(map[string][]string),
+	}
+}
+
+// AddProject adds a project (subservice) to keystone, returns its ID
+func (p *Platform) AddProject(name string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	id := p.nextID()
+	p.keystone.projects = append(p.keystone.projects, models.Project{
+		Name:          name,
+		Enabled:       true,
+		DomainId:      p.keystone.domain.ID,
+		ParentId:      p.keystone.domain.ID,
+		ProjectStatus: models.ProjectStatus{ID: id},
+	})
+	return id
+}
+
+// AddUser adds a user to keystone, returns its ID
+func (p *Platform) AddUser(name string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	id := p.nextID()
+	p.keystone.users = append(p.keystone.users, models.User{
+		Name:       name,
+		Enabled:    true,
+		DomainID:   p.keystone.domain.ID,
+		UserStatus: models.UserStatus{ID: id},
+	})
+	return id
+}
+
+// AddGroup adds a group with the given members to keystone, returns its ID
+func (p *Platform) AddGroup(name string, userIDs ...string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	id := p.nextID()
+	p.keystone.groups = append(p.keystone.groups, models.Group{
+		Name:        name,
+		DomainID:    p.keystone.domain.ID,
+		GroupStatus: models.GroupStatus{ID: id},
+	})
+	p.keystone.members[id] = append([]string{}, userIDs...)
+	return id
+}
+
+// AddRole adds a role to keystone, returns its ID
+func (p *Platform) AddRole(name string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	id := p.nextID()
+	p.keystone.roles = append(p.keystone.roles, models.Role{
+		Name:       name,
+		DomainID:   p.keystone.domain.ID,
+		RoleStatus: models.RoleStatus{ID: id},
+	})
+	return id
+}
+
+// byID finds the index of the item with the given id
+func byID[T any](items []T, id string, getID func(T) string) int {
+	return slices.IndexFunc(items, func(item T) bool { return getID(item) == id })
+}
+
+func projectID(p models.Project) string { return p.ID }
+func userID(u models.User) string       { return u.ID }
+func groupID(g models.Group) string     { return g.ID }
+func roleID(r models.Role) string       { return r.ID }
+
+func (p *Platform) keystoneHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v3/auth/tokens", p.keystoneLogin)
+	auth := http.NewServeMux()
+	mux.Handle("/", p.requireToken(auth))
+
+	// Domains
+	domains := func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		domains := []models.Domain{p.keystone.domain}
+		if r.URL.Query().Get("enabled") == "false" {
+			domains = []models.Domain{}
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"domains": domains})
+	}
+	auth.HandleFunc("GET /v3/auth/domains", domains)
+	auth.HandleFunc("GET /v3/domains", domains)
+
+	// Projects
+	projects := func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		writeJSON(w, http.StatusOK, map[string]any{"projects": p.keystone.projects})
+	}
+	auth.HandleFunc("GET /v3/auth/projects", projects)
+	auth.HandleFunc("GET /v3/projects", projects)
+	auth.HandleFunc("POST /v3/projects", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Project models.Project `json:"project"`
+		}
+		if err := readJSON(r, &body); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if slices.ContainsFunc(p.keystone.projects, func(v models.Project) bool { return v.Name == body.Project.Name }) {
+			writeError(w, http.StatusConflict, "project already exists")
+			return
+		}
+		project := body.Project
+		project.ID = p.nextID()
+		project.DomainId = p.keystone.domain.ID
+		project.ParentId = p.keystone.domain.ID
+		p.keystone.projects = append(p.keystone.projects, project)
+		writeJSON(w, http.StatusCreated, map[string]any{"project": project})
+	})
+	auth.HandleFunc("PATCH /v3/projects/{id}", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Project struct {
+				Enabled     *bool   `json:"enabled"`
+				Description *string `json:"description"`
+			} `json:"project"`
+		}
+		if err := readJSON(r, &body); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		index := byID(p.keystone.projects, r.PathValue("id"), projectID)
+		if index < 0 {
+			writeError(w, http.StatusNotFound, "project not found")
+			return
+		}
+		project := &p.keystone.projects[index]
+		if body.Project.Enabled != nil {
+			project.Enabled = *body.Project.Enabled
+		}
+		if body.Project.Description != nil {
+			project.Description = *body.Project.Description
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"project": project})
+	})
+	auth.HandleFunc("DELETE /v3/projects/{id}", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		index := byID(p.keystone.projects, r.PathValue("id"), projectID)
+		if index < 0 {
+			writeError(w, http.StatusNotFound, "project not found")
+			return
+		}
+		if p.keystone.projects[index].Enabled {
+			writeError(w, http.StatusForbidden, "cannot delete an enabled project")
+			return
+		}
+		p.keystone.projects = slices.Delete(p.keystone.projects, index, index+1)
+		p.dropAssignments(func(a assignment) bool { return a.ScopeKind == "projects" && a.ScopeID == r.PathValue("id") })
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	// Users
+	auth.HandleFunc("GET /v3/users", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		writeJSON(w, http.StatusOK, map[string]any{"users": p.keystone.users})
+	})
+	auth.HandleFunc("POST /v3/users", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			User models.User `json:"user"`
+		}
+		if err := readJSON(r, &body); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if slices.ContainsFunc(p.keystone.users, func(v models.User) bool { return v.Name == body.User.Name }) {
+			writeError(w, http.StatusConflict, "user already exists")
+			return
+		}
+		user := body.User
+		user.ID = p.nextID()
+		user.Options = nil
+		p.keystone.users = append(p.keystone.users, user)
+		writeJSON(w, http.StatusCreated, map[string]any{"user": user})
+	})
+	auth.HandleFunc("DELETE /v3/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		id := r.PathValue("id")
+		index := byID(p.keystone.users, id, userID)
+		if index < 0 {
+			writeError(w, http.StatusNotFound, "user not found")
+			return
+		}
+		p.keystone.users = slices.Delete(p.keystone.users, index, index+1)
+		for group, members := range p.keystone.members {
+			p.keystone.members[group] = slices.DeleteFunc(members, func(m string) bool { return m == id })
+		}
+		p.dropAssignments(func(a assignment) bool { return a.Kind == "users" && a.ActorID == id })
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	// Groups
+	auth.HandleFunc("GET /v3/groups", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		writeJSON(w, http.StatusOK, map[string]any{"groups": p.keystone.groups})
+	})
+	auth.HandleFunc("POST /v3/groups", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Group models.Group `json:"group"`
+		}
+		if err := readJSON(r, &body); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if slices.ContainsFunc(p.keystone.groups, func(v models.Group) bool { return v.Name == body.Group.Name }) {
+			writeError(w, http.StatusConflict, "group already exists")
+			return
+		}
+		group := body.Group
+		group.GroupStatus = models.GroupStatus{ID: p.nextID()}
+		p.keystone.groups = append(p.keystone.groups, group)
+		writeJSON(w, http.StatusCreated, map[string]any{"group": group})
+	})
+	auth.HandleFunc("DELETE /v3/groups/{id}", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		id := r.PathValue("id")
+		index := byID(p.keystone.groups, id, groupID)
+		if index < 0 {
+			writeError(w, http.StatusNotFound, "group not found")
+			return
+		}
+		p.keystone.groups = slices.Delete(p.keystone.groups, index, index+1)
+		delete(p.keystone.members, id)
+		p.dropAssignments(func(a assignment) bool { return a.Kind == "groups" && a.ActorID == id })
+		w.WriteHeader(http.StatusNoContent)
+	})
+	auth.HandleFunc("GET /v3/groups/{id}/users", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		users := make([]models.User, 0, 8)
+		for _, member := range p.keystone.members[r.PathValue("id")] {
+			if index := byID(p.keystone.users, member, userID); index >= 0 {
+				users = append(users, p.keystone.users[index])
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"users": users})
+	})
+	auth.HandleFunc("PUT /v3/groups/{id}/users/{user}", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		id, user := r.PathValue("id"), r.PathValue("user")
+		if byID(p.keystone.groups, id, groupID) < 0 || byID(p.keystone.users, user, userID) < 0 {
+			writeError(w, http.StatusNotFound, "group or user not found")
+			return
+		}
+		if !slices.Contains(p.keystone.members[id], user) {
+			p.keystone.members[id] = append(p.keystone.members[id], user)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	// Roles and assignments
+	auth.HandleFunc("GET /v3/roles", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		writeJSON(w, http.StatusOK, map[string]any{"roles": p.keystone.roles})
+	})
+	auth.HandleFunc("GET /v3/role_assignments", p.keystoneAssignments)
+	assign := func(scopeKind string, inherited bool) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			p.updateAssignment(w, r, scopeKind, inherited)
+		}
+	}
+	for _, method := range []string{http.MethodPut, http.MethodDelete} {
+		auth.HandleFunc(method+" /v3/projects/{scope}/{kind}/{actor}/roles/{role}", assign("projects", false))
+		auth.HandleFunc(method+" /v3/domains/{scope}/{kind}/{actor}/roles/{role}", assign("domains", false))
+		auth.HandleFunc(method+" /v3/OS-INHERIT/domains/{scope}/{kind}/{actor}/roles/{role}/inherited_to_projects", assign("domains", true))
+	}
+	return mux
+}
+
+// keystoneLogin authenticates the platform user
+func (p *Platform) keystoneLogin(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Auth struct {
+			Identity struct {
+				Password struct {
+					User struct {
+						Name     string `json:"name"`
+						Password string `json:"password"`
+						Domain   struct {
+							Name string `json:"name"`
+						} `json:"domain"`
+					} `json:"user"`
+				} `json:"password"`
+			} `json:"identity"`
+		} `json:"auth"`
+	}
+	if err := readJSON(r, &body); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	user := body.Auth.Identity.Password.User
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if user.Name != p.Username || user.Password != p.Password || user.Domain.Name != p.Service {
+		writeError(w, http.StatusUnauthorized, "invalid credentials")
+		return
+	}
+	w.Header().Set("X-Subject-Token", p.Token)
+	writeJSON(w, http.StatusCreated, map[string]any{
+		"token": map[string]any{
+			"user": map[string]string{
+				"id":   p.keystone.users[0].ID,
+				"name": p.Username,
+			},
+			"expires_at": time.Now().Add(time.Hour).UTC().Format("2006-01-02T15:04:05.000000Z"),
+		},
+	})
+}
+
+// dropAssignments removes the matching assignments. Must hold the lock.
+func (p *Platform) dropAssignments(match func(assignment) bool) {
+	p.keystone.assignments = slices.DeleteFunc(p.keystone.assignments, match)
+}
+
+// updateAssignment grants (PUT) or revokes (DELETE) a role
+func (p *Platform) updateAssignment(w http.ResponseWriter, r *http.Request, scopeKind string, inherited bool) {
+	a := assignment{
+		RoleID:    r.PathValue("role"),
+		Kind:      r.PathValue("kind"),
+		ActorID:   r.PathValue("actor"),
+		ScopeKind: scopeKind,
+		ScopeID:   r.PathValue("scope"),
+		Inherited: inherited,
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var actorFound bool
+	switch a.Kind {
+	case "users":
+		actorFound = byID(p.keystone.users, a.ActorID, userID) >= 0
+	case "groups":
+		actorFound = byID(p.keystone.groups, a.ActorID, groupID) >= 0
+	}
+	scopeFound := a.ScopeID == p.keystone.domain.ID
+	if scopeKind == "projects" {
+		scopeFound = byID(p.keystone.projects, a.ScopeID, projectID) >= 0
+	}
+	if !actorFound || !scopeFound || byID(p.keystone.roles, a.RoleID, roleID) < 0 {
+		writeError(w, http.StatusNotFound, "role, actor or scope not found")
+		return
+	}
+	index := slices.Index(p.keystone.assignments, a)
+	if r.Method == http.MethodDelete {
+		if index < 0 {
+			writeError(w, http.StatusNotFound, "assignment not found")
+			return
+		}
+		p.keystone.assignments = slices.Delete(p.keystone.assignments, index, index+1)
+	} else if index < 0 {
+		p.keystone.assignments = append(p.keystone.assignments, a)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// keystoneAssignments lists role assignments, filtered by user.id,
+// group.id, role.id, scope.project.id or scope.domain.id
+func (p *Platform) keystoneAssignments(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	result := make([]map[string]any, 0, len(p.keystone.assignments))
+	for _, a := range p.keystone.assignments {
+		if id := query.Get("user.id"); id != "" && (a.Kind != "users" || a.ActorID != id) {
+			continue
+		}
+		if id := query.Get("group.id"); id != "" && (a.Kind != "groups" || a.ActorID != id) {
+			continue
+		}
+		if id := query.Get("role.id"); id != "" && a.RoleID != id {
+			continue
+		}
+		if id := query.Get("scope.project.id"); id != "" && (a.ScopeKind != "projects" || a.ScopeID != id) {
+			continue
+		}
+		if id := query.Get("scope.domain.id"); id != "" && (a.ScopeKind != "domains" || a.ScopeID != id) {
+			continue
+		}
+		item := make(map[string]any)
+		role := p.keystone.roles[byID(p.keystone.roles, a.RoleID, roleID)]
+		item["role"] = models.AssignmentID{ID: role.ID, Name: role.Name}
+		if a.Kind == "users" {
+			user := p.keystone.users[byID(p.keystone.users, a.ActorID, userID)]
+			item["user"] = models.AssignmentID{ID: user.ID, Name: user.Name}
+		} else {
+			group := p.keystone.groups[byID(p.keystone.groups, a.ActorID, groupID)]
+			item["group"] = models.AssignmentID{ID: group.ID, Name: group.Name}
+		}
+		scope := make(map[string]any)
+		if a.ScopeKind == "projects" {
+			project := p.keystone.projects[byID(p.keystone.projects, a.ScopeID, projectID)]
+			scope["project"] = models.AssignmentID{ID: project.ID, Name: project.Name}
+		} else {
+			scope["domain"] = models.AssignmentID{ID: p.keystone.domain.ID, Name: p.keystone.domain.Name}
+		}
+		if a.Inherited {
+			scope["OS-INHERIT:inherited_to"] = "projects"
+		}
+		item["scope"] = scope
+		result = append(result, item)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"role_assignments": result})
+}
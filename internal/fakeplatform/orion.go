@@ -0,0 +1,350 @@
+package fakeplatform
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// object is a JSON object, as received from the client
+type object map[string]json.RawMessage
+
+// entity stored in orion. Attributes are kept as received.
+type entity struct {
+	ID    string
+	Type  string
+	Attrs object
+}
+
+// MarshalJSON implements json.Marshaler
+func (e entity) MarshalJSON() ([]byte, error) {
+	result := make(map[string]any, len(e.Attrs)+2)
+	for name, attr := range e.Attrs {
+		result[name] = attr
+	}
+	result["id"] = e.ID
+	result["type"] = e.Type
+	return json.Marshal(result)
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (e *entity) UnmarshalJSON(data []byte) error {
+	var attrs object
+	if err := json.Unmarshal(data, &attrs); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(attrs["id"], &e.ID); err != nil {
+		return fmt.Errorf("entity without id: %w", err)
+	}
+	if err := json.Unmarshal(attrs["type"], &e.Type); err != nil {
+		return fmt.Errorf("entity %s without type: %w", e.ID, err)
+	}
+	delete(attrs, "id")
+	delete(attrs, "type")
+	e.Attrs = attrs
+	return nil
+}
+
+type orionState struct {
+	entities        []entity
+	subscriptions   []object
+	registrations   []object
+	ldEntities      []entity
+	ldSubscriptions []object
+}
+
+// orionPath returns the state of the request subservice. Must hold the lock.
+func (p *Platform) orionPath(r *http.Request) *orionState {
+	path := servicePath(r)
+	state, ok := p.orion[path]
+	if !ok {
+		state = &orionState{}
+		p.orion[path] = state
+	}
+	return state
+}
+
+// AddEntity stores an entity (in NGSIv2 normalized format) in the subservice
+func (p *Platform) AddEntity(subservice string, data json.RawMessage) error {
+	var ent entity
+	if err := json.Unmarshal(data, &ent); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	state, ok := p.orion[subservice]
+	if !ok {
+		state = &orionState{}
+		p.orion[subservice] = state
+	}
+	state.entities = append(state.entities, ent)
+	return nil
+}
+
+func (p *Platform) orionHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v2/entities", p.orionEntities)
+	mux.HandleFunc("GET /v2/types", p.orionTypes)
+	mux.Handle("/ngsi-ld/", p.orionLDHandler())
+	mux.HandleFunc("POST /v2/op/update", p.orionUpdate)
+	for _, collection := range []string{"subscriptions", "registrations"} {
+		items := func(state *orionState) *[]object {
+			if collection == "subscriptions" {
+				return &state.subscriptions
+			}
+			return &state.registrations
+		}
+		mux.HandleFunc("GET /v2/"+collection, func(w http.ResponseWriter, r *http.Request) {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			writePage(w, r, *items(p.orionPath(r)))
+		})
+		mux.HandleFunc("POST /v2/"+collection, func(w http.ResponseWriter, r *http.Request) {
+			var item object
+			if err := readJSON(r, &item); err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			id := p.nextID()
+			item["id"], _ = json.Marshal(id)
+			item["status"] = json.RawMessage(`"active"`)
+			list := items(p.orionPath(r))
+			*list = append(*list, item)
+			w.Header().Set("Location", fmt.Sprintf("/v2/%s/%s", collection, id))
+			w.WriteHeader(http.StatusCreated)
+		})
+		mux.HandleFunc("PATCH /v2/"+collection+"/{id}", func(w http.ResponseWriter, r *http.Request) {
+			var patch object
+			if err := readJSON(r, &patch); err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			list := *items(p.orionPath(r))
+			index := slices.IndexFunc(list, func(item object) bool { return hasID(item, r.PathValue("id")) })
+			if index < 0 {
+				writeError(w, http.StatusNotFound, "The requested subscription has not been found")
+				return
+			}
+			for key, value := range patch {
+				if key != "id" {
+					list[index][key] = value
+				}
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+		mux.HandleFunc("DELETE /v2/"+collection+"/{id}", func(w http.ResponseWriter, r *http.Request) {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			list := items(p.orionPath(r))
+			index := slices.IndexFunc(*list, func(item object) bool { return hasID(item, r.PathValue("id")) })
+			if index < 0 {
+				writeError(w, http.StatusNotFound, "The requested resource has not been found")
+				return
+			}
+			*list = slices.Delete(*list, index, index+1)
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+	return mux
+}
+
+// hasID checks the id of a subscription or registration
+func hasID(item object, id string) bool {
+	var current string
+	return json.Unmarshal(item["id"], &current) == nil && current == id
+}
+
+// orionEntities lists entities, with type, idPattern and q filters
+func (p *Platform) orionEntities(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var idPattern *regexp.Regexp
+	if pattern := query.Get("idPattern"); pattern != "" {
+		var err error
+		if idPattern, err = regexp.Compile(pattern); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	var types, ids []string
+	if entityType := query.Get("type"); entityType != "" {
+		types = strings.Split(entityType, ",")
+	}
+	if id := query.Get("id"); id != "" {
+		ids = strings.Split(id, ",")
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	matches := make([]entity, 0, 16)
+	for _, ent := range p.orionPath(r).entities {
+		if types != nil && !slices.Contains(types, ent.Type) {
+			continue
+		}
+		if ids != nil && !slices.Contains(ids, ent.ID) {
+			continue
+		}
+		if idPattern != nil && !idPattern.MatchString(ent.ID) {
+			continue
+		}
+		if !simpleQuery(ent, query.Get("q")) {
+			continue
+		}
+		matches = append(matches, ent)
+	}
+	writePage(w, r, matches)
+}
+
+// orionTypes lists the entity types, with the types of their attributes
+func (p *Platform) orionTypes(w http.ResponseWriter, r *http.Request) {
+	type attrInfo struct {
+		Types []string `json:"types"`
+	}
+	type typeInfo struct {
+		Type  string              `json:"type"`
+		Attrs map[string]attrInfo `json:"attrs"`
+		Count int                 `json:"count"`
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	types := make([]typeInfo, 0, 8)
+	for _, ent := range p.orionPath(r).entities {
+		index := slices.IndexFunc(types, func(t typeInfo) bool { return t.Type == ent.Type })
+		if index < 0 {
+			types = append(types, typeInfo{Type: ent.Type, Attrs: make(map[string]attrInfo)})
+			index = len(types) - 1
+		}
+		types[index].Count += 1
+		for name, raw := range ent.Attrs {
+			var attr struct {
+				Type string `json:"type"`
+			}
+			json.Unmarshal(raw, &attr)
+			info := types[index].Attrs[name]
+			if !slices.Contains(info.Types, attr.Type) {
+				info.Types = append(info.Types, attr.Type)
+			}
+			types[index].Attrs[name] = info
+		}
+	}
+	slices.SortFunc(types, func(a, b typeInfo) int { return strings.Compare(a.Type, b.Type) })
+	writePage(w, r, types)
+}
+
+// simpleQuery supports a subset of the orion simple query language:
+// a list of `attr`, `!attr`, `attr==value` or `attr!=value` separated by `;`.
+func simpleQuery(ent entity, q string) bool {
+	if q == "" {
+		return true
+	}
+	for _, term := range strings.Split(q, ";") {
+		if name, ok := strings.CutPrefix(term, "!"); ok {
+			if _, found := ent.Attrs[name]; found {
+				return false
+			}
+			continue
+		}
+		name, value, equals := term, "", true
+		if before, after, ok := strings.Cut(term, "!="); ok {
+			name, value, equals = before, after, false
+		} else if before, after, ok := strings.Cut(term, "=="); ok {
+			name, value = before, after
+		}
+		attr, found := ent.Attrs[name]
+		if !found {
+			return false
+		}
+		if value == "" && equals {
+			continue
+		}
+		var current struct {
+			Value json.RawMessage `json:"value"`
+		}
+		json.Unmarshal(attr, &current)
+		text := string(current.Value)
+		var str string
+		if json.Unmarshal(current.Value, &str) == nil {
+			text = str
+		}
+		if (text == strings.Trim(value, "'")) != equals {
+			return false
+		}
+	}
+	return true
+}
+
+// orionUpdate implements the batch update operation
+func (p *Platform) orionUpdate(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ActionType string   `json:"actionType"`
+		Entities   []entity `json:"entities"`
+	}
+	if err := readJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	state := p.orionPath(r)
+	find := func(ent entity) int {
+		return slices.IndexFunc(state.entities, func(e entity) bool { return e.ID == ent.ID && e.Type == ent.Type })
+	}
+	// Check preconditions first, so that the operation is atomic
+	for _, ent := range req.Entities {
+		index := find(ent)
+		switch req.ActionType {
+		case "append", "appendStrict":
+			if index < 0 || req.ActionType == "append" {
+				continue
+			}
+			for name := range ent.Attrs {
+				if _, found := state.entities[index].Attrs[name]; found {
+					writeError(w, http.StatusUnprocessableEntity, fmt.Sprintf("attribute %s of entity %s already exists", name, ent.ID))
+					return
+				}
+			}
+		case "update", "replace", "delete":
+			if index < 0 {
+				writeError(w, http.StatusNotFound, fmt.Sprintf("entity %s not found", ent.ID))
+				return
+			}
+			if req.ActionType == "replace" {
+				continue
+			}
+			for name := range ent.Attrs {
+				if _, found := state.entities[index].Attrs[name]; !found {
+					writeError(w, http.StatusNotFound, fmt.Sprintf("attribute %s of entity %s not found", name, ent.ID))
+					return
+				}
+			}
+		default:
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("unsupported actionType %s", req.ActionType))
+			return
+		}
+	}
+	for _, ent := range req.Entities {
+		index := find(ent)
+		switch {
+		case req.ActionType == "replace":
+			state.entities[index].Attrs = ent.Attrs
+		case req.ActionType == "delete" && len(ent.Attrs) <= 0:
+			state.entities = slices.Delete(state.entities, index, index+1)
+		case req.ActionType == "delete":
+			for name := range ent.Attrs {
+				delete(state.entities[index].Attrs, name)
+			}
+		case index < 0:
+			state.entities = append(state.entities, ent)
+		default:
+			for name, attr := range ent.Attrs {
+				state.entities[index].Attrs[name] = attr
+			}
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
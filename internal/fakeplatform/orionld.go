@@ -0,0 +1,269 @@
+package fakeplatform
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// orionLDHandler serves a subset of the NGSI-LD API: entity queries,
+// batch operations and attribute deletion, types, attributes and
+// subscriptions. LD entities and subscriptions are stored apart from
+// the NGSIv2 ones.
+func (p *Platform) orionLDHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /ngsi-ld/v1/entities", p.orionLDEntities)
+	mux.HandleFunc("POST /ngsi-ld/v1/entityOperations/{op}", p.orionLDOperation)
+	mux.HandleFunc("DELETE /ngsi-ld/v1/entities/{id}/attrs/{attr}", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		state := p.orionPath(r)
+		index := slices.IndexFunc(state.ldEntities, func(e entity) bool { return e.ID == r.PathValue("id") })
+		if index < 0 {
+			writeError(w, http.StatusNotFound, "entity not found")
+			return
+		}
+		if _, found := state.ldEntities[index].Attrs[r.PathValue("attr")]; !found {
+			writeError(w, http.StatusNotFound, "attribute not found")
+			return
+		}
+		delete(state.ldEntities[index].Attrs, r.PathValue("attr"))
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("GET /ngsi-ld/v1/types", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		types := make([]string, 0, 8)
+		for _, ent := range p.orionPath(r).ldEntities {
+			if !slices.Contains(types, ent.Type) {
+				types = append(types, ent.Type)
+			}
+		}
+		slices.Sort(types)
+		writeJSON(w, http.StatusOK, map[string]any{
+			"id":       "urn:ngsi-ld:EntityTypeList:" + p.nextID(),
+			"type":     "EntityTypeList",
+			"typeList": types,
+		})
+	})
+	mux.HandleFunc("GET /ngsi-ld/v1/attributes", func(w http.ResponseWriter, r *http.Request) {
+		type attrInfo struct {
+			Name      string   `json:"attributeName"`
+			Types     []string `json:"attributeTypes"`
+			TypeNames []string `json:"typeNames"`
+		}
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		attrs := make(map[string]*attrInfo)
+		for _, ent := range p.orionPath(r).ldEntities {
+			for name, raw := range ent.Attrs {
+				var attr struct {
+					Type string `json:"type"`
+				}
+				json.Unmarshal(raw, &attr)
+				info, ok := attrs[name]
+				if !ok {
+					info = &attrInfo{Name: name}
+					attrs[name] = info
+				}
+				if !slices.Contains(info.Types, attr.Type) {
+					info.Types = append(info.Types, attr.Type)
+				}
+				if !slices.Contains(info.TypeNames, ent.Type) {
+					info.TypeNames = append(info.TypeNames, ent.Type)
+				}
+			}
+		}
+		result := make([]attrInfo, 0, len(attrs))
+		for _, name := range slices.Sorted(maps.Keys(attrs)) {
+			result = append(result, *attrs[name])
+		}
+		writeJSON(w, http.StatusOK, result)
+	})
+
+	// Subscriptions
+	mux.HandleFunc("GET /ngsi-ld/v1/subscriptions", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		writeLDPage(w, r, p.orionPath(r).ldSubscriptions)
+	})
+	mux.HandleFunc("POST /ngsi-ld/v1/subscriptions", func(w http.ResponseWriter, r *http.Request) {
+		var item object
+		if err := readJSON(r, &item); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		id := "urn:ngsi-ld:Subscription:" + p.nextID()
+		item["id"], _ = json.Marshal(id)
+		item["status"] = json.RawMessage(`"active"`)
+		state := p.orionPath(r)
+		state.ldSubscriptions = append(state.ldSubscriptions, item)
+		w.Header().Set("Location", "/ngsi-ld/v1/subscriptions/"+id)
+		w.WriteHeader(http.StatusCreated)
+	})
+	mux.HandleFunc("PATCH /ngsi-ld/v1/subscriptions/{id}", func(w http.ResponseWriter, r *http.Request) {
+		var patch object
+		if err := readJSON(r, &patch); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		list := p.orionPath(r).ldSubscriptions
+		index := slices.IndexFunc(list, func(item object) bool { return hasID(item, r.PathValue("id")) })
+		if index < 0 {
+			writeError(w, http.StatusNotFound, "subscription not found")
+			return
+		}
+		for key, value := range patch {
+			if key != "id" {
+				list[index][key] = value
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("DELETE /ngsi-ld/v1/subscriptions/{id}", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		state := p.orionPath(r)
+		index := slices.IndexFunc(state.ldSubscriptions, func(item object) bool { return hasID(item, r.PathValue("id")) })
+		if index < 0 {
+			writeError(w, http.StatusNotFound, "subscription not found")
+			return
+		}
+		state.ldSubscriptions = slices.Delete(state.ldSubscriptions, index, index+1)
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	// Every NGSI-LD request must carry the @context
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Link"), "json-ld#context") {
+			writeError(w, http.StatusBadRequest, "missing @context Link header")
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// writeLDPage writes a page of items, following NGSI-LD pagination
+// conventions (offset, limit and NGSILD-Results-Count header)
+func writeLDPage[T any](w http.ResponseWriter, r *http.Request, items []T) {
+	query := r.URL.Query()
+	offset, _ := strconv.Atoi(query.Get("offset"))
+	limit, err := strconv.Atoi(query.Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 20
+	}
+	offset = min(max(offset, 0), len(items))
+	top := min(offset+limit, len(items))
+	if query.Get("count") == "true" {
+		w.Header().Set("NGSILD-Results-Count", strconv.Itoa(len(items)))
+	}
+	writeJSON(w, http.StatusOK, items[offset:top])
+}
+
+// orionLDEntities lists entities, with type, id and idPattern filters
+func (p *Platform) orionLDEntities(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("type") == "" && query.Get("id") == "" && query.Get("q") == "" {
+		writeError(w, http.StatusBadRequest, "too broad query")
+		return
+	}
+	var idPattern *regexp.Regexp
+	if pattern := query.Get("idPattern"); pattern != "" {
+		var err error
+		if idPattern, err = regexp.Compile(pattern); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	var types, ids []string
+	if entityType := query.Get("type"); entityType != "" {
+		types = strings.Split(entityType, ",")
+	}
+	if id := query.Get("id"); id != "" {
+		ids = strings.Split(id, ",")
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	matches := make([]entity, 0, 16)
+	for _, ent := range p.orionPath(r).ldEntities {
+		if types != nil && !slices.Contains(types, ent.Type) {
+			continue
+		}
+		if ids != nil && !slices.Contains(ids, ent.ID) {
+			continue
+		}
+		if idPattern != nil && !idPattern.MatchString(ent.ID) {
+			continue
+		}
+		matches = append(matches, ent)
+	}
+	writeLDPage(w, r, matches)
+}
+
+// orionLDOperation runs a batch create, upsert, update or delete
+func (p *Platform) orionLDOperation(w http.ResponseWriter, r *http.Request) {
+	type batchError struct {
+		EntityID string            `json:"entityId"`
+		Error    map[string]string `json:"error"`
+	}
+	var (
+		ents   []entity
+		errors []batchError
+		op     = r.PathValue("op")
+	)
+	if op == "delete" {
+		var ids []string
+		if err := readJSON(r, &ids); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		for _, id := range ids {
+			ents = append(ents, entity{ID: id})
+		}
+	} else if err := readJSON(r, &ents); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	state := p.orionPath(r)
+	for _, ent := range ents {
+		index := slices.IndexFunc(state.ldEntities, func(e entity) bool { return e.ID == ent.ID })
+		fail := func(title string) {
+			errors = append(errors, batchError{EntityID: ent.ID, Error: map[string]string{"title": title}})
+		}
+		switch {
+		case op == "create" && index >= 0:
+			fail("Entity already exists")
+		case op == "create", op == "upsert" && index < 0:
+			state.ldEntities = append(state.ldEntities, ent)
+		case index < 0:
+			fail("Entity not found")
+		case op == "delete":
+			state.ldEntities = slices.Delete(state.ldEntities, index, index+1)
+		case op == "upsert" && r.URL.Query().Get("options") != "update":
+			state.ldEntities[index].Attrs = ent.Attrs
+		case op == "upsert", op == "update":
+			for name, attr := range ent.Attrs {
+				state.ldEntities[index].Attrs[name] = attr
+			}
+		default:
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("unsupported operation %s", op))
+			return
+		}
+	}
+	if len(errors) > 0 {
+		writeJSON(w, http.StatusMultiStatus, map[string]any{"success": []string{}, "errors": errors})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
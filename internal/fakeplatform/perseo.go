@@ -0,0 +1,91 @@
+package fakeplatform
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/warpcomdev/fiware/models"
+)
+
+type perseoState struct {
+	rules []models.Rule
+}
+
+// perseoPath returns the state of the request subservice. Must hold the lock.
+func (p *Platform) perseoPath(r *http.Request) *perseoState {
+	path := servicePath(r)
+	state, ok := p.perseo[path]
+	if !ok {
+		state = &perseoState{}
+		p.perseo[path] = state
+	}
+	return state
+}
+
+func (p *Platform) perseoHandler() http.Handler {
+	mux := http.NewServeMux()
+	findRule := func(state *perseoState, name string) int {
+		return slices.IndexFunc(state.rules, func(rule models.Rule) bool { return rule.Name == name })
+	}
+	mux.HandleFunc("GET /rules", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		rules := p.perseoPath(r).rules
+		writeJSON(w, http.StatusOK, map[string]any{
+			"count": len(rules),
+			"data":  rules,
+			"error": nil,
+		})
+	})
+	mux.HandleFunc("POST /rules", func(w http.ResponseWriter, r *http.Request) {
+		var rule models.Rule
+		if err := readJSON(r, &rule); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		state := p.perseoPath(r)
+		if findRule(state, rule.Name) >= 0 {
+			writeError(w, http.StatusBadRequest, "rule exists")
+			return
+		}
+		rule.RuleStatus = models.RuleStatus{
+			ID:         p.nextID(),
+			Service:    r.Header.Get("Fiware-Service"),
+			Subservice: servicePath(r),
+		}
+		state.rules = append(state.rules, rule)
+		writeJSON(w, http.StatusOK, map[string]any{"error": nil, "data": rule})
+	})
+	mux.HandleFunc("PUT /rules/{name}", func(w http.ResponseWriter, r *http.Request) {
+		var rule models.Rule
+		if err := readJSON(r, &rule); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		state := p.perseoPath(r)
+		index := findRule(state, r.PathValue("name"))
+		if index < 0 {
+			writeError(w, http.StatusNotFound, "rule not found")
+			return
+		}
+		rule.Name = r.PathValue("name")
+		rule.RuleStatus = state.rules[index].RuleStatus
+		state.rules[index] = rule
+		writeJSON(w, http.StatusOK, map[string]any{"error": nil, "data": rule})
+	})
+	mux.HandleFunc("DELETE /rules/{name}", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		state := p.perseoPath(r)
+		// perseo does not complain when deleting missing rules
+		if index := findRule(state, r.PathValue("name")); index >= 0 {
+			state.rules = slices.Delete(state.rules, index, index+1)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return mux
+}
@@ -0,0 +1,229 @@
+package fakeplatform
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/warpcomdev/fiware/models"
+)
+
+// panel stored in urbo, kept as received
+type panel struct {
+	Slug string
+	Data object
+}
+
+type urboState struct {
+	verticals []models.Vertical
+	panels    []panel
+}
+
+func newUrboState() urboState {
+	return urboState{}
+}
+
+// summary returns the panel fields listed by the API
+func (p panel) summary() models.UrboPanel {
+	var result models.UrboPanel
+	data, _ := json.Marshal(p.Data)
+	json.Unmarshal(data, &result)
+	result.Slug = p.Slug
+	return result
+}
+
+func (p *Platform) urboHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /auth/sso/login", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Service  string `json:"service"`
+			Username string `json:"username"`
+			Password string `json:"password"`
+		}
+		if err := readJSON(r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if req.Service != p.Service || req.Username != p.Username || req.Password != p.Password {
+			writeError(w, http.StatusUnauthorized, "invalid credentials")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"token": p.UrboToken})
+	})
+	api := http.NewServeMux()
+	mux.Handle("/api/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		token := p.UrboToken
+		p.mu.Unlock()
+		if r.Header.Get("Authorization") != "Bearer "+token {
+			writeError(w, http.StatusUnauthorized, "invalid token")
+			return
+		}
+		api.ServeHTTP(w, r)
+	}))
+	findVertical := func(slug string) int {
+		return slices.IndexFunc(p.urbo.verticals, func(v models.Vertical) bool { return v.Slug == slug })
+	}
+	findPanel := func(slug string) int {
+		// Updates address the panel as "service:slug"
+		if _, after, found := strings.Cut(slug, ":"); found {
+			slug = after
+		}
+		return slices.IndexFunc(p.urbo.panels, func(item panel) bool { return item.Slug == slug })
+	}
+	panelObjects := func(slugs []string) []models.UrboPanel {
+		result := make([]models.UrboPanel, 0, len(slugs))
+		for _, slug := range slugs {
+			if index := findPanel(slug); index >= 0 {
+				result = append(result, p.urbo.panels[index].summary())
+			}
+		}
+		return result
+	}
+
+	// Verticals
+	api.HandleFunc("GET /api/verticals", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		result := make([]map[string]any, 0, len(p.urbo.verticals))
+		for _, vertical := range p.urbo.verticals {
+			result = append(result, map[string]any{
+				"slug":    vertical.Slug,
+				"name":    vertical.Name,
+				"service": p.Service,
+				"panels":  panelObjects(vertical.AllPanels()),
+			})
+		}
+		writeJSON(w, http.StatusOK, result)
+	})
+	api.HandleFunc("GET /api/verticals/{slug}", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		index := findVertical(r.PathValue("slug"))
+		if index < 0 {
+			writeError(w, http.StatusNotFound, "vertical not found")
+			return
+		}
+		vertical := p.urbo.verticals[index]
+		vertical.PanelsObjects = panelObjects(vertical.Panels)
+		vertical.ShadowPanelsObjects = panelObjects(vertical.ShadowPanels)
+		writeJSON(w, http.StatusOK, vertical)
+	})
+	api.HandleFunc("POST /api/verticals", func(w http.ResponseWriter, r *http.Request) {
+		var vertical models.Vertical
+		if err := readJSON(r, &vertical); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if findVertical(vertical.Slug) >= 0 {
+			writeError(w, http.StatusBadRequest, "vertical already exists")
+			return
+		}
+		vertical.UrboVerticalStatus = models.UrboVerticalStatus{}
+		p.urbo.verticals = append(p.urbo.verticals, vertical)
+		writeJSON(w, http.StatusCreated, vertical)
+	})
+	api.HandleFunc("PUT /api/verticals/{slug}", func(w http.ResponseWriter, r *http.Request) {
+		var vertical models.Vertical
+		if err := readJSON(r, &vertical); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		index := findVertical(r.PathValue("slug"))
+		if index < 0 {
+			writeError(w, http.StatusNotFound, "vertical not found")
+			return
+		}
+		vertical.Slug = r.PathValue("slug")
+		vertical.UrboVerticalStatus = models.UrboVerticalStatus{}
+		p.urbo.verticals[index] = vertical
+		writeJSON(w, http.StatusOK, vertical)
+	})
+	api.HandleFunc("DELETE /api/verticals/{slug}", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		index := findVertical(r.PathValue("slug"))
+		if index < 0 {
+			writeError(w, http.StatusNotFound, "vertical not found")
+			return
+		}
+		p.urbo.verticals = slices.Delete(p.urbo.verticals, index, index+1)
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	// Panels
+	api.HandleFunc("GET /api/panels", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		result := make([]models.UrboPanel, 0, len(p.urbo.panels))
+		for _, item := range p.urbo.panels {
+			result = append(result, item.summary())
+		}
+		writeJSON(w, http.StatusOK, result)
+	})
+	api.HandleFunc("GET /api/panels/{slug}", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		index := findPanel(r.PathValue("slug"))
+		if index < 0 {
+			writeError(w, http.StatusNotFound, "panel not found")
+			return
+		}
+		writeJSON(w, http.StatusOK, p.urbo.panels[index].Data)
+	})
+	api.HandleFunc("POST /api/panels", func(w http.ResponseWriter, r *http.Request) {
+		var data object
+		if err := readJSON(r, &data); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		var slug string
+		if err := json.Unmarshal(data["slug"], &slug); err != nil || slug == "" {
+			writeError(w, http.StatusBadRequest, "panel without slug")
+			return
+		}
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if findPanel(slug) >= 0 {
+			writeError(w, http.StatusBadRequest, "panel already exists")
+			return
+		}
+		p.urbo.panels = append(p.urbo.panels, panel{Slug: slug, Data: data})
+		writeJSON(w, http.StatusCreated, data)
+	})
+	api.HandleFunc("PUT /api/panels/{slug}", func(w http.ResponseWriter, r *http.Request) {
+		var data object
+		if err := readJSON(r, &data); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		index := findPanel(r.PathValue("slug"))
+		if index < 0 {
+			writeError(w, http.StatusNotFound, "panel not found")
+			return
+		}
+		p.urbo.panels[index].Data = data
+		writeJSON(w, http.StatusOK, data)
+	})
+	api.HandleFunc("DELETE /api/panels/{slug}", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		index := findPanel(r.PathValue("slug"))
+		if index < 0 {
+			writeError(w, http.StatusNotFound, "panel not found")
+			return
+		}
+		p.urbo.panels = slices.Delete(p.urbo.panels, index, index+1)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return mux
+}
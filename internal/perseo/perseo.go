@@ -81,80 +81,188 @@ func (o *Perseo) Rules(client keystone.HTTPClient, headers http.Header) ([]model
 	return response.Data, nil
 }
 
-// PostRules posts a list of rules to Perseo
-func (o *Perseo) PostRules(client keystone.HTTPClient, headers http.Header, rules []models.Rule) error {
-	var errList []error
-	for _, rule := range rules {
-		// HACK: No quiero que se añada a las acciones el servicio y el subservicio,
-		// a menos que use variables (contenga "${}").
-		// Así que decodifico la acción y compruebo si tiene los campos
-		// "service" y "subservice", y de ser así los omito.
-		actionList := rule.ActionList()
-		replaced := false // indica si hemos reemplazado alguna accion
-		if len(actionList) > 0 {
-			// Para prever el caso en que descargamos reglas de
-			// un servicio, y queremos aplicarlas a otro.
-			keys := map[string]string{
-				"service":    rule.Service,
-				"subservice": rule.Subservice,
-			}
-			for index, current := range actionList {
-				switch current := current.(type) {
-				case map[string]interface{}:
-					// Preservamos todas las claves si al menos una es variable
-					preserve := false
-					for key, defValue := range keys {
-						if k, ok := current[key]; ok {
-							if s, ok := k.(string); ok {
-								if s != defValue {
-									preserve = true
-								}
+// cleanRule prepares a rule to be sent to Perseo. If verbose is true,
+// prints a message for every attribute removed from the actions.
+func cleanRule(rule models.Rule, verbose bool) (models.Rule, error) {
+	// HACK: No quiero que se añada a las acciones el servicio y el subservicio,
+	// a menos que use variables (contenga "${}").
+	// Así que decodifico la acción y compruebo si tiene los campos
+	// "service" y "subservice", y de ser así los omito.
+	actionList := rule.ActionList()
+	replaced := false // indica si hemos reemplazado alguna accion
+	if len(actionList) > 0 {
+		// Para prever el caso en que descargamos reglas de
+		// un servicio, y queremos aplicarlas a otro.
+		keys := map[string]string{
+			"service":    rule.Service,
+			"subservice": rule.Subservice,
+		}
+		for index, current := range actionList {
+			switch current := current.(type) {
+			case map[string]interface{}:
+				// Preservamos todas las claves si al menos una es variable
+				preserve := false
+				for key, defValue := range keys {
+					if k, ok := current[key]; ok {
+						if s, ok := k.(string); ok {
+							if s != defValue {
+								preserve = true
 							}
 						}
 					}
-					if !preserve {
-						for key := range keys {
-							if _, ok := current[key]; ok {
-								delete(current, key)
-								replaced = true
+				}
+				if !preserve {
+					for key := range keys {
+						if _, ok := current[key]; ok {
+							delete(current, key)
+							replaced = true
+							if verbose {
 								fmt.Printf("Removing attribute %s from action %d in rule %s\n", key, index, rule.Name)
 							}
 						}
-						actionList[index] = current
 					}
+					actionList[index] = current
 				}
 			}
 		}
-		if replaced {
-			if newBytes, err := json.Marshal(actionList); err == nil {
-				rule.Action = newBytes
-			}
-		}
-		// FIN DE HACK
-		rule.RuleStatus = models.RuleStatus{}
-		if rule.Name == "" {
-			return errors.New("All rules must have name")
+	}
+	if replaced {
+		if newBytes, err := json.Marshal(actionList); err == nil {
+			rule.Action = newBytes
 		}
-		if rule.Text != "" {
-			// HACK 2: no voy a subir el ruleName, voy a dejar que lo ponga perseo
-			rule.Text = rulenameRegexp.ReplaceAllLiteralString(rule.Text, "select ")
-			// FIN DE HACK 2
-			if len(rule.NoSignal) > 0 && !bytes.Equal(rule.NoSignal, []byte("\"\"")) {
-				return fmt.Errorf("both rule.Text and rule.NoSignal defined for rule %s", rule.Name)
-			}
-			rule.NoSignal = nil // those two are mutually exclusive
+	}
+	// FIN DE HACK
+	rule.RuleStatus = models.RuleStatus{}
+	if rule.Name == "" {
+		return rule, errors.New("All rules must have name")
+	}
+	if rule.Text != "" {
+		// HACK 2: no voy a subir el ruleName, voy a dejar que lo ponga perseo
+		rule.Text = rulenameRegexp.ReplaceAllLiteralString(rule.Text, "select ")
+		// FIN DE HACK 2
+		if len(rule.NoSignal) > 0 && !bytes.Equal(rule.NoSignal, []byte("\"\"")) {
+			return rule, fmt.Errorf("both rule.Text and rule.NoSignal defined for rule %s", rule.Name)
 		}
-		path, err := o.URL.Parse("rules")
+		rule.NoSignal = nil // those two are mutually exclusive
+	}
+	return rule, nil
+}
+
+// PostRules posts a list of rules to Perseo
+func (o *Perseo) PostRules(client keystone.HTTPClient, headers http.Header, rules []models.Rule) error {
+	var errList []error
+	for _, rule := range rules {
+		rule, err := cleanRule(rule, true)
 		if err != nil {
 			return err
 		}
-		if _, _, err := keystone.Update(client, http.MethodPost, headers, path, rule); err != nil {
+		if err := o.postRule(client, headers, rule); err != nil {
 			errList = append(errList, err)
 		}
 	}
 	return errors.Join(errList...)
 }
 
+// postRule posts a rule already prepared by cleanRule
+func (o *Perseo) postRule(client keystone.HTTPClient, headers http.Header, rule models.Rule) error {
+	path, err := o.URL.Parse("rules")
+	if err != nil {
+		return err
+	}
+	_, _, err = keystone.Update(client, http.MethodPost, headers, path, rule)
+	return err
+}
+
+// UpsertAction is the outcome of upserting a rule
+type UpsertAction string
+
+const (
+	RuleCreated   UpsertAction = "created"
+	RuleUpdated   UpsertAction = "updated"
+	RuleUnchanged UpsertAction = "unchanged"
+)
+
+// UpsertResult describes what happened to a rule during UpsertRules
+type UpsertResult struct {
+	Name   string
+	Action UpsertAction
+	Err    error
+}
+
+// UpsertRules creates the rules that do not exist in Perseo, and replaces
+// those that exist with a different content. Rules are replaced with a
+// PUT to /rules/{name}; if the Perseo version does not support it, the
+// rule is deleted and posted again.
+func (o *Perseo) UpsertRules(client keystone.HTTPClient, headers http.Header, rules []models.Rule) ([]UpsertResult, error) {
+	current, err := o.Rules(client, headers)
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]models.Rule, len(current))
+	for _, rule := range current {
+		byName[rule.Name] = rule
+	}
+	var errList []error
+	results := make([]UpsertResult, 0, len(rules))
+	for _, rule := range rules {
+		rule, err := cleanRule(rule, true)
+		if err != nil {
+			return results, err
+		}
+		result := UpsertResult{Name: rule.Name}
+		if existing, ok := byName[rule.Name]; !ok {
+			result.Action = RuleCreated
+			result.Err = o.postRule(client, headers, rule)
+		} else if existing, err = cleanRule(existing, false); err == nil && sameRule(existing, rule) {
+			result.Action = RuleUnchanged
+		} else {
+			result.Action = RuleUpdated
+			result.Err = o.putRule(client, headers, rule)
+		}
+		if result.Err != nil {
+			errList = append(errList, fmt.Errorf("while upserting rule %s: %w", rule.Name, result.Err))
+		}
+		results = append(results, result)
+	}
+	return results, errors.Join(errList...)
+}
+
+// sameRule compares the JSON representation of both rules
+func sameRule(current, desired models.Rule) bool {
+	currentJSON, err := json.Marshal(current)
+	if err != nil {
+		return false
+	}
+	desiredJSON, err := json.Marshal(desired)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(currentJSON, desiredJSON)
+}
+
+// putRule replaces a rule, falling back to delete and post
+// if the Perseo version does not support PUT. A 404 is not
+// a reason to fall back, it means the rule is gone.
+func (o *Perseo) putRule(client keystone.HTTPClient, headers http.Header, rule models.Rule) error {
+	path, err := o.URL.Parse(fmt.Sprintf("rules/%s", rule.Name))
+	if err != nil {
+		return err
+	}
+	_, _, err = keystone.PutJSON(client, headers, path, rule)
+	var netErr keystone.NetError
+	if err == nil || !errors.As(err, &netErr) {
+		return err
+	}
+	switch netErr.StatusCode {
+	case http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		if err := o.DeleteRules(client, headers, []models.Rule{rule}); err != nil {
+			return err
+		}
+		return o.postRule(client, headers, rule)
+	}
+	return err
+}
+
 // DeleteRules deletes a list of rules from Perseo
 func (o *Perseo) DeleteRules(client keystone.HTTPClient, headers http.Header, rules []models.Rule) error {
 	var errList []error
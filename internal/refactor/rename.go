@@ -0,0 +1,392 @@
+// Package refactor rewrites the resources of a manifest after a change
+// in the data model, such as renaming an attribute, so that the result
+// can be posted or applied back to the platform.
+package refactor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/warpcomdev/fiware/models"
+)
+
+// Change is a place of the manifest rewritten by a refactor
+type Change struct {
+	Resource string `json:"resource"` // kind of resource (entityType, subscription, rule...)
+	Name     string `json:"name"`     // id, name or description of the resource
+	Field    string `json:"field"`    // field of the resource that was changed
+}
+
+// String implements fmt.Stringer
+func (c Change) String() string {
+	return fmt.Sprintf("%s %s: %s", c.Resource, c.Name, c.Field)
+}
+
+// renamer renames an attribute of an entity type, and keeps track of
+// every change made to the manifest
+type renamer struct {
+	entityType string
+	from       string
+	to         string
+	changes    []Change
+}
+
+func (r *renamer) changed(resource, name, field string) {
+	r.changes = append(r.changes, Change{Resource: resource, Name: name, Field: field})
+}
+
+// RenameAttr renames the attribute `from` to `to`, in every resource of
+// the manifest that refers to entities of type entityType:
+//
+//   - entity types and entities, including metadata.
+//   - subscriptions: notification and condition attrs, the q expression,
+//     and ${attr} macros or attribute names in custom payloads.
+//   - perseo rules: attribute references (attr?) in the EPL text, macros
+//     in the actions and the attribute of nosignal rules.
+//   - IoTA groups and devices: attributes, lazy, static attributes,
+//     commands and explicitAttrs.
+//   - cygnus service mappings: the original attribute name, so that
+//     the attribute keeps being persisted with the same name.
+//   - registrations: the attrs in dataProvided.
+//
+// Returns the list of changes made. Fails without changing anything if
+// some entity type or entity already has an attribute named `to`.
+func RenameAttr(manifest *models.Manifest, entityType, from, to string) ([]Change, error) {
+	if entityType == "" || from == "" || to == "" {
+		return nil, errors.New("entity type and attribute names must not be empty")
+	}
+	if from == to {
+		return nil, fmt.Errorf("attribute %s would be renamed to itself", from)
+	}
+	r := &renamer{entityType: entityType, from: from, to: to}
+	if err := r.checkConflicts(manifest); err != nil {
+		return nil, err
+	}
+	r.entityTypes(manifest.EntityTypes)
+	r.entities(manifest.Entities)
+	r.subscriptions(manifest.Subscriptions)
+	r.rules(manifest.Rules)
+	for i := range manifest.DeviceGroups {
+		group := &manifest.DeviceGroups[i]
+		name := group.Resource + "/" + group.APIKey
+		r.deviceAttrs("deviceGroup", name, group.EntityType, map[string][]models.DeviceAttribute{
+			"attributes":          group.Attributes,
+			"lazy":                group.Lazy,
+			"static_attributes":   group.StaticAttributes,
+			"internal_attributes": group.InternalAttributes,
+		})
+		r.deviceCommands("deviceGroup", name, group.EntityType, group.Commands)
+		group.ExplicitAttrs = r.explicitAttrs("deviceGroup", name, group.EntityType, group.ExplicitAttrs)
+	}
+	for i := range manifest.Devices {
+		device := &manifest.Devices[i]
+		r.deviceAttrs("device", device.DeviceId, device.EntityType, map[string][]models.DeviceAttribute{
+			"attributes":        device.Attributes,
+			"lazy":              device.Lazy,
+			"static_attributes": device.StaticAttributes,
+		})
+		r.deviceCommands("device", device.DeviceId, device.EntityType, device.Commands)
+		device.ExplicitAttrs = r.explicitAttrs("device", device.DeviceId, device.EntityType, device.ExplicitAttrs)
+	}
+	r.serviceMappings(manifest.ServiceMappings)
+	r.registrations(manifest.Registrations)
+	return r.changes, nil
+}
+
+// checkConflicts makes sure the new attribute name is not already in use
+func (r *renamer) checkConflicts(manifest *models.Manifest) error {
+	var errList []error
+	for _, et := range manifest.EntityTypes {
+		if et.Type != r.entityType {
+			continue
+		}
+		if slices.ContainsFunc(et.Attrs, func(attr models.Attribute) bool { return attr.Name == r.to }) {
+			errList = append(errList, fmt.Errorf("entity type %s already has attribute %s", et.Type, r.to))
+		}
+	}
+	for _, ent := range manifest.Entities {
+		if ent.Type != r.entityType {
+			continue
+		}
+		_, hasFrom := ent.Attrs[r.from]
+		if _, hasTo := ent.Attrs[r.to]; hasFrom && hasTo {
+			errList = append(errList, fmt.Errorf("entity %s already has attribute %s", ent.ID, r.to))
+		}
+	}
+	return errors.Join(errList...)
+}
+
+func (r *renamer) entityTypes(entityTypes []models.EntityType) {
+	for _, et := range entityTypes {
+		if et.Type != r.entityType {
+			continue
+		}
+		for i := range et.Attrs {
+			if et.Attrs[i].Name == r.from {
+				et.Attrs[i].Name = r.to
+				r.changed("entityType", et.Type, "attrs")
+			}
+		}
+	}
+}
+
+func (r *renamer) entities(entities []models.Entity) {
+	for _, ent := range entities {
+		if ent.Type != r.entityType {
+			continue
+		}
+		if renameKey(ent.Attrs, r.from, r.to) {
+			r.changed("entity", ent.ID, "attrs")
+		}
+		if renameKey(ent.MetaDatas, r.from, r.to) {
+			r.changed("entity", ent.ID, "metadatas")
+		}
+	}
+}
+
+func (r *renamer) subscriptions(subs map[string]models.Subscription) {
+	for _, key := range slices.Sorted(maps.Keys(subs)) {
+		sub := subs[key]
+		if !slices.ContainsFunc(sub.Subject.Entities, func(e models.SubjectEntity) bool { return e.Type == r.entityType }) {
+			continue
+		}
+		name := sub.Description
+		if name == "" {
+			name = key
+		}
+		if r.renameList(sub.Notification.Attrs) {
+			r.changed("subscription", name, "notification.attrs")
+		}
+		if r.renameList(sub.Notification.ExceptAttrs) {
+			r.changed("subscription", name, "notification.exceptAttrs")
+		}
+		if r.renameList(sub.Subject.Condition.Attrs) {
+			r.changed("subscription", name, "subject.condition.attrs")
+		}
+		if q, ok := r.renameQ(sub.Subject.Condition.Expression.Q); ok {
+			sub.Subject.Condition.Expression.Q = q
+			r.changed("subscription", name, "subject.condition.expression.q")
+		}
+		custom := &sub.Notification.HTTPCustom
+		custom.Payload = r.renamePayload("subscription", name, "notification.httpCustom.payload", custom.Payload, false)
+		custom.Json = r.renamePayload("subscription", name, "notification.httpCustom.json", custom.Json, false)
+		custom.NGSI = r.renamePayload("subscription", name, "notification.httpCustom.ngsi", custom.NGSI, true)
+		mqtt := &sub.Notification.MQTTCustom
+		mqtt.Payload = r.renamePayload("subscription", name, "notification.mqttCustom.payload", mqtt.Payload, false)
+		mqtt.Json = r.renamePayload("subscription", name, "notification.mqttCustom.json", mqtt.Json, false)
+		mqtt.NGSI = r.renamePayload("subscription", name, "notification.mqttCustom.ngsi", mqtt.NGSI, true)
+		subs[key] = sub
+	}
+}
+
+// renameQ renames the attribute in each statement of a simple query.
+// Statements are separated by ";", and start with the attribute name,
+// optionally preceded by "!".
+func (r *renamer) renameQ(q string) (string, bool) {
+	if q == "" {
+		return q, false
+	}
+	statements := strings.Split(q, ";")
+	changed := false
+	for i, statement := range statements {
+		negate := strings.HasPrefix(statement, "!")
+		rest := strings.TrimPrefix(statement, "!")
+		if !strings.HasPrefix(rest, r.from) {
+			continue
+		}
+		tail := rest[len(r.from):]
+		if tail != "" && !strings.ContainsAny(tail[:1], "=!<>~.:") {
+			continue
+		}
+		statements[i] = r.to + tail
+		if negate {
+			statements[i] = "!" + statements[i]
+		}
+		changed = true
+	}
+	return strings.Join(statements, ";"), changed
+}
+
+// renamePayload renames ${attr} macros in a custom payload. If keys is
+// true, the payload is an NGSI patch and its keys are renamed too.
+func (r *renamer) renamePayload(resource, name, field string, payload json.RawMessage, keys bool) json.RawMessage {
+	if len(payload) <= 0 {
+		return payload
+	}
+	changed := false
+	if keys {
+		var attrs map[string]json.RawMessage
+		if err := json.Unmarshal(payload, &attrs); err == nil && renameKey(attrs, r.from, r.to) {
+			if data, err := json.Marshal(attrs); err == nil {
+				payload, changed = data, true
+			}
+		}
+	}
+	if macro := []byte("${" + r.from + "}"); strings.Contains(string(payload), string(macro)) {
+		payload = json.RawMessage(strings.ReplaceAll(string(payload), string(macro), "${"+r.to+"}"))
+		changed = true
+	}
+	if changed {
+		r.changed(resource, name, field)
+	}
+	return payload
+}
+
+func (r *renamer) rules(rules map[string]models.Rule) {
+	// EPL refers to attributes as "attr?" or "ev.attr?"
+	pattern := regexp.MustCompile(`(^|[^\w])` + regexp.QuoteMeta(r.from) + `\?`)
+	replacement := "${1}" + strings.ReplaceAll(r.to, "$", "$$") + "?"
+	for _, key := range slices.Sorted(maps.Keys(rules)) {
+		rule := rules[key]
+		name := rule.Name
+		if name == "" {
+			name = key
+		}
+		var nosignal map[string]json.RawMessage
+		if len(rule.NoSignal) > 0 {
+			json.Unmarshal(rule.NoSignal, &nosignal)
+		}
+		var nosignalType string
+		json.Unmarshal(nosignal["type"], &nosignalType)
+		mentionsType := strings.Contains(rule.Text, `"`+r.entityType+`"`) || strings.Contains(rule.Text, `'`+r.entityType+`'`)
+		if !mentionsType && nosignalType != r.entityType {
+			continue
+		}
+		if text := pattern.ReplaceAllString(rule.Text, replacement); text != rule.Text {
+			rule.Text = text
+			r.changed("rule", name, "text")
+		}
+		rule.Action = r.renamePayload("rule", name, "action", rule.Action, false)
+		if nosignalType == r.entityType {
+			var attr string
+			if json.Unmarshal(nosignal["attribute"], &attr) == nil && attr == r.from {
+				nosignal["attribute"], _ = json.Marshal(r.to)
+				if data, err := json.Marshal(nosignal); err == nil {
+					rule.NoSignal = data
+					r.changed("rule", name, "nosignal.attribute")
+				}
+			}
+		}
+		rules[key] = rule
+	}
+}
+
+// deviceAttrs renames the attributes of IoTA groups and devices. Each
+// attribute can be mapped to an entity type other than the default.
+func (r *renamer) deviceAttrs(resource, name, entityType string, lists map[string][]models.DeviceAttribute) {
+	for _, field := range slices.Sorted(maps.Keys(lists)) {
+		for i, attr := range lists[field] {
+			attrType := attr.EntityType
+			if attrType == "" {
+				attrType = entityType
+			}
+			if attrType == r.entityType && attr.Name == r.from {
+				lists[field][i].Name = r.to
+				r.changed(resource, name, field)
+			}
+		}
+	}
+}
+
+func (r *renamer) deviceCommands(resource, name, entityType string, commands []models.DeviceCommand) {
+	if entityType != r.entityType {
+		return
+	}
+	for i := range commands {
+		if commands[i].Name == r.from {
+			commands[i].Name = r.to
+			r.changed(resource, name, "commands")
+		}
+	}
+}
+
+// explicitAttrs renames the attribute in explicitAttrs, when it is a
+// list of attribute names. Expressions are kept as they are.
+func (r *renamer) explicitAttrs(resource, name, entityType string, explicit json.RawMessage) json.RawMessage {
+	if entityType != r.entityType || len(explicit) <= 0 {
+		return explicit
+	}
+	var attrs []string
+	if err := json.Unmarshal(explicit, &attrs); err != nil || !r.renameList(attrs) {
+		return explicit
+	}
+	data, err := json.Marshal(attrs)
+	if err != nil {
+		return explicit
+	}
+	r.changed(resource, name, "explicitAttrs")
+	return data
+}
+
+func (r *renamer) serviceMappings(mappings []models.ServiceMapping) {
+	for _, sm := range mappings {
+		for _, spm := range sm.ServicePathMappings {
+			for _, em := range spm.EntityMappings {
+				if em.OriginalEntityType != r.entityType {
+					continue
+				}
+				for i := range em.AttributeMappings {
+					if em.AttributeMappings[i].OriginalAttributeName == r.from {
+						em.AttributeMappings[i].OriginalAttributeName = r.to
+						r.changed("serviceMapping", spm.OriginalServicePath, "attributeMappings")
+					}
+				}
+			}
+		}
+	}
+}
+
+func (r *renamer) registrations(regs []models.Registration) {
+	for i, reg := range regs {
+		var provided map[string]json.RawMessage
+		if len(reg.DataProvided) <= 0 || json.Unmarshal(reg.DataProvided, &provided) != nil {
+			continue
+		}
+		var entities []models.SubjectEntity
+		json.Unmarshal(provided["entities"], &entities)
+		if !slices.ContainsFunc(entities, func(e models.SubjectEntity) bool { return e.Type == r.entityType }) {
+			continue
+		}
+		var attrs []string
+		if json.Unmarshal(provided["attrs"], &attrs) != nil || !r.renameList(attrs) {
+			continue
+		}
+		provided["attrs"], _ = json.Marshal(attrs)
+		if data, err := json.Marshal(provided); err == nil {
+			regs[i].DataProvided = data
+			name := reg.Description
+			if name == "" {
+				name = reg.ID
+			}
+			r.changed("registration", name, "dataProvided.attrs")
+		}
+	}
+}
+
+// renameList renames the attribute in a list of names, in place
+func (r *renamer) renameList(names []string) bool {
+	changed := false
+	for i, name := range names {
+		if name == r.from {
+			names[i] = r.to
+			changed = true
+		}
+	}
+	return changed
+}
+
+// renameKey renames a key of the map, in place
+func renameKey[V any](m map[string]V, from, to string) bool {
+	value, ok := m[from]
+	if !ok {
+		return false
+	}
+	delete(m, from)
+	m[to] = value
+	return true
+}
@@ -0,0 +1,202 @@
+package refactor
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/warpcomdev/fiware/models"
+)
+
+// testManifest has resources of type Sensor that refer to "temp",
+// and resources of type Pump that must be left alone
+func testManifest() models.Manifest {
+	return models.Manifest{
+		EntityTypes: []models.EntityType{
+			{Type: "Sensor", Attrs: []models.Attribute{{Name: "temp", Type: "Number"}}},
+			{Type: "Pump", Attrs: []models.Attribute{{Name: "temp", Type: "Number"}}},
+		},
+		Entities: []models.Entity{
+			{ID: "s1", Type: "Sensor", Attrs: map[string]json.RawMessage{"temp": json.RawMessage(`20`)}},
+			{ID: "p1", Type: "Pump", Attrs: map[string]json.RawMessage{"temp": json.RawMessage(`30`)}},
+		},
+		Subscriptions: map[string]models.Subscription{
+			"alerts": {
+				Description: "alerts",
+				Subject: models.Subject{
+					Entities: []models.SubjectEntity{{IdPattern: ".*", Type: "Sensor"}},
+					Condition: models.SubjectCondition{
+						Attrs:      []string{"temp"},
+						Expression: models.SubjectExpression{Q: "temp>30;!tempMax;temp.unit==CEL"},
+					},
+				},
+				Notification: models.Notification{
+					Attrs: []string{"temp", "humidity"},
+					HTTPCustom: models.NotificationCustom{
+						URL:  "http://alerts",
+						Json: json.RawMessage(`{"value":"${temp}"}`),
+						NGSI: json.RawMessage(`{"temp":{"type":"Number","value":"${temp}"}}`),
+					},
+				},
+			},
+			"pumps": {
+				Description: "pumps",
+				Subject: models.Subject{
+					Entities: []models.SubjectEntity{{IdPattern: ".*", Type: "Pump"}},
+				},
+				Notification: models.Notification{Attrs: []string{"temp"}},
+			},
+		},
+		Rules: map[string]models.Rule{
+			"hot": {
+				Name:   "hot",
+				Text:   `select *, ev.temp? as t from iotEvent as ev where type="Sensor" and temp? > 30 and tempMax? > 40`,
+				Action: json.RawMessage(`{"type":"email","template":"temperature ${temp}"}`),
+			},
+			"silent": {
+				Name:     "silent",
+				NoSignal: json.RawMessage(`{"checkInterval":"5","type":"Sensor","attribute":"temp","reportInterval":"60"}`),
+			},
+		},
+		DeviceGroups: []models.DeviceGroup{{
+			Resource:   "/iot/json",
+			APIKey:     "key",
+			EntityType: "Sensor",
+			Attributes: []models.DeviceAttribute{
+				{ObjectId: "t", Name: "temp", Type: "Number"},
+				{ObjectId: "pt", Name: "temp", Type: "Number", EntityType: "Pump"},
+			},
+			ExplicitAttrs: json.RawMessage(`["temp","humidity"]`),
+		}},
+		Devices: []models.Device{{
+			DeviceId:   "d1",
+			EntityType: "Pump",
+			Attributes: []models.DeviceAttribute{{ObjectId: "t", Name: "temp", Type: "Number", EntityType: "Sensor"}},
+			Commands:   []models.DeviceCommand{{Name: "temp"}},
+		}},
+		ServiceMappings: []models.ServiceMapping{{
+			ServicePathMappings: []models.ServicePathMapping{{
+				OriginalServicePath: "/riego",
+				EntityMappings: []models.EntityMapping{{
+					OriginalEntityType: "Sensor",
+					AttributeMappings:  []models.AttributeMapping{{OriginalAttributeName: "temp", NewAttributeName: "temperature"}},
+				}},
+			}},
+		}},
+		Registrations: []models.Registration{{
+			Description:  "weather",
+			DataProvided: json.RawMessage(`{"entities":[{"idPattern":".*","type":"Sensor"}],"attrs":["temp"]}`),
+		}},
+	}
+}
+
+func TestRenameAttr(t *testing.T) {
+	manifest := testManifest()
+	changes, err := RenameAttr(&manifest, "Sensor", "temp", "temperature")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if manifest.EntityTypes[0].Attrs[0].Name != "temperature" || manifest.EntityTypes[1].Attrs[0].Name != "temp" {
+		t.Errorf("expected only the Sensor type renamed, got %+v", manifest.EntityTypes)
+	}
+	if _, found := manifest.Entities[0].Attrs["temperature"]; !found {
+		t.Errorf("expected entity s1 renamed, got %v", manifest.Entities[0].Attrs)
+	}
+	if _, found := manifest.Entities[1].Attrs["temp"]; !found {
+		t.Errorf("expected entity p1 unchanged, got %v", manifest.Entities[1].Attrs)
+	}
+
+	sub := manifest.Subscriptions["alerts"]
+	if got := sub.Subject.Condition.Expression.Q; got != "temperature>30;!tempMax;temperature.unit==CEL" {
+		t.Errorf("unexpected q %s", got)
+	}
+	if !slices.Equal(sub.Notification.Attrs, []string{"temperature", "humidity"}) || !slices.Equal(sub.Subject.Condition.Attrs, []string{"temperature"}) {
+		t.Errorf("unexpected subscription attrs %v %v", sub.Notification.Attrs, sub.Subject.Condition.Attrs)
+	}
+	if got := string(sub.Notification.HTTPCustom.Json); got != `{"value":"${temperature}"}` {
+		t.Errorf("unexpected json payload %s", got)
+	}
+	if got := string(sub.Notification.HTTPCustom.NGSI); got != `{"temperature":{"type":"Number","value":"${temperature}"}}` {
+		t.Errorf("unexpected ngsi payload %s", got)
+	}
+	if got := manifest.Subscriptions["pumps"].Notification.Attrs[0]; got != "temp" {
+		t.Errorf("expected the Pump subscription unchanged, got %s", got)
+	}
+
+	rule := manifest.Rules["hot"]
+	if want := `select *, ev.temperature? as t from iotEvent as ev where type="Sensor" and temperature? > 30 and tempMax? > 40`; rule.Text != want {
+		t.Errorf("unexpected rule text %s", rule.Text)
+	}
+	if !strings.Contains(string(rule.Action), "${temperature}") {
+		t.Errorf("unexpected rule action %s", rule.Action)
+	}
+	if !strings.Contains(string(manifest.Rules["silent"].NoSignal), `"attribute":"temperature"`) {
+		t.Errorf("unexpected nosignal %s", manifest.Rules["silent"].NoSignal)
+	}
+
+	group := manifest.DeviceGroups[0]
+	if group.Attributes[0].Name != "temperature" || group.Attributes[1].Name != "temp" {
+		t.Errorf("expected only the Sensor attribute of the group renamed, got %+v", group.Attributes)
+	}
+	if got := string(group.ExplicitAttrs); got != `["temperature","humidity"]` {
+		t.Errorf("unexpected explicitAttrs %s", got)
+	}
+	device := manifest.Devices[0]
+	if device.Attributes[0].Name != "temperature" || device.Commands[0].Name != "temp" {
+		t.Errorf("expected the Sensor attribute renamed and the Pump command kept, got %+v %+v", device.Attributes, device.Commands)
+	}
+	mapping := manifest.ServiceMappings[0].ServicePathMappings[0].EntityMappings[0].AttributeMappings[0]
+	if mapping.OriginalAttributeName != "temperature" || mapping.NewAttributeName != "temperature" {
+		t.Errorf("unexpected attribute mapping %+v", mapping)
+	}
+	if got := string(manifest.Registrations[0].DataProvided); !strings.Contains(got, `"attrs":["temperature"]`) {
+		t.Errorf("unexpected registration %s", got)
+	}
+
+	fields := make([]string, 0, len(changes))
+	for _, change := range changes {
+		fields = append(fields, change.Resource+"/"+change.Field)
+	}
+	for _, want := range []string{
+		"entityType/attrs",
+		"entity/attrs",
+		"subscription/subject.condition.expression.q",
+		"subscription/notification.httpCustom.ngsi",
+		"rule/text",
+		"rule/nosignal.attribute",
+		"deviceGroup/explicitAttrs",
+		"device/attributes",
+		"serviceMapping/attributeMappings",
+		"registration/dataProvided.attrs",
+	} {
+		if !slices.Contains(fields, want) {
+			t.Errorf("expected change %s, got %v", want, fields)
+		}
+	}
+}
+
+func TestRenameAttrConflict(t *testing.T) {
+	manifest := testManifest()
+	manifest.Entities[0].Attrs["temperature"] = json.RawMessage(`21`)
+	if _, err := RenameAttr(&manifest, "Sensor", "temp", "temperature"); err == nil {
+		t.Fatal("expected a conflict with the existing attribute")
+	}
+	if manifest.EntityTypes[0].Attrs[0].Name != "temp" || manifest.Subscriptions["alerts"].Notification.Attrs[0] != "temp" {
+		t.Error("the manifest must not change when there are conflicts")
+	}
+}
+
+func TestRenameAttrInvalid(t *testing.T) {
+	manifest := testManifest()
+	for _, args := range [][3]string{
+		{"", "temp", "temperature"},
+		{"Sensor", "", "temperature"},
+		{"Sensor", "temp", "temp"},
+	} {
+		if _, err := RenameAttr(&manifest, args[0], args[1], args[2]); err == nil {
+			t.Errorf("expected %v to fail", args)
+		}
+	}
+}
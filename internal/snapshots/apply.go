@@ -0,0 +1,163 @@
+package snapshots
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/warpcomdev/fiware/internal/config"
+	"github.com/warpcomdev/fiware/internal/diff"
+	"github.com/warpcomdev/fiware/internal/perseo"
+	"github.com/warpcomdev/fiware/iotam"
+	"github.com/warpcomdev/fiware/keystone"
+	"github.com/warpcomdev/fiware/models"
+	"github.com/warpcomdev/fiware/orion"
+)
+
+// ApplyOptions control how a subservice is reconciled with a manifest
+type ApplyOptions struct {
+	Prune     bool              // Delete resources that are not in the manifest
+	BatchSize int               // Size of the batches of entities sent to orion
+	Endpoints map[string]string // Notification endpoints for subscriptions
+}
+
+// changes groups the resources of a kind in a report by action
+type changes[T any] struct {
+	Added   []T
+	Changed []T // desired version of the changed resources
+	Drifted []T // current version of the changed resources
+	Removed []T
+}
+
+func (c changes[T]) IsZero() bool {
+	return len(c.Added) <= 0 && len(c.Changed) <= 0 && len(c.Removed) <= 0
+}
+
+func changesOf[T any](report diff.Report, kind string) changes[T] {
+	var result changes[T]
+	for _, res := range report.Resources {
+		if res.Kind != kind {
+			continue
+		}
+		switch res.Action {
+		case diff.Added:
+			result.Added = append(result.Added, res.Desired.(T))
+		case diff.Changed:
+			result.Changed = append(result.Changed, res.Desired.(T))
+			result.Drifted = append(result.Drifted, res.Current.(T))
+		case diff.Removed:
+			result.Removed = append(result.Removed, res.Current.(T))
+		}
+	}
+	return result
+}
+
+// Apply the changes in the report to the subservice, so that it matches
+// the desired manifest the report was built from. Removed resources are
+// only deleted if options.Prune is set.
+//
+// Resources are created in dependency order (device groups before devices),
+// and deleted in reverse order. Errors do not stop the process, they are
+// collected and returned together at the end.
+func Apply(client keystone.HTTPClient, selected config.Config, headers http.Header, desired models.Manifest, report diff.Report, options ApplyOptions) error {
+	var (
+		groups   = changesOf[models.DeviceGroup](report, diff.DeviceGroups)
+		devices  = changesOf[models.Device](report, diff.Devices)
+		subs     = changesOf[models.Subscription](report, diff.Subscriptions)
+		rules    = changesOf[models.Rule](report, diff.Rules)
+		entities = changesOf[models.Entity](report, diff.Entities)
+		errList  []error
+	)
+	if !options.Prune {
+		groups.Removed, devices.Removed, subs.Removed, rules.Removed, entities.Removed = nil, nil, nil, nil, nil
+	}
+
+	// Pre-create all clients, to fail early
+	var (
+		orionServer  *orion.Orion
+		perseoServer *perseo.Perseo
+		iotamServer  *iotam.Iotam
+		err          error
+	)
+	if !subs.IsZero() || !entities.IsZero() {
+		if orionServer, err = orion.NewDialect(selected.OrionURL, selected.NGSI, selected.LDContext); err != nil {
+			return err
+		}
+	}
+	if !rules.IsZero() {
+		if perseoServer, err = perseo.New(selected.PerseoURL); err != nil {
+			return err
+		}
+	}
+	if !groups.IsZero() || !devices.IsZero() {
+		if iotamServer, err = iotam.New(selected.IotamURL); err != nil {
+			return err
+		}
+	}
+	collect := func(kind string, err error) {
+		if err != nil {
+			errList = append(errList, fmt.Errorf("while applying %s: %w", kind, err))
+		}
+	}
+
+	// Drifted resources are updated in place, and posted again
+	// if they disappeared since the diff was computed.
+	if len(groups.Changed) > 0 {
+		missing, err := iotamServer.UpdateServices(client, headers, groups.Changed)
+		collect(diff.DeviceGroups, err)
+		groups.Added = append(groups.Added, missing...)
+	}
+	if len(groups.Added) > 0 {
+		collect(diff.DeviceGroups, iotamServer.PostServices(client, headers, groups.Added))
+	}
+	if len(devices.Changed) > 0 {
+		missing, err := iotamServer.UpdateDevices(client, headers, devices.Changed)
+		collect(diff.Devices, err)
+		devices.Added = append(devices.Added, missing...)
+	}
+	if len(devices.Added) > 0 {
+		collect(diff.Devices, iotamServer.PostDevices(client, headers, devices.Added))
+	}
+	if len(subs.Changed) > 0 {
+		// Keep the ID of the current subscription, so that it is patched
+		for idx, sub := range subs.Changed {
+			sub.ID = subs.Drifted[idx].ID
+			subs.Changed[idx] = sub
+		}
+		missing, err := orionServer.UpdateSubscriptions(client, headers, subs.Changed, options.Endpoints, true)
+		collect(diff.Subscriptions, err)
+		subs.Added = append(subs.Added, missing...)
+	}
+	if len(subs.Added) > 0 {
+		collect(diff.Subscriptions, orionServer.PostSuscriptions(client, headers, subs.Added, options.Endpoints, false))
+	}
+	if len(rules.Changed) > 0 {
+		_, err := perseoServer.UpsertRules(client, headers, rules.Changed)
+		collect(diff.Rules, err)
+	}
+	if len(rules.Added) > 0 {
+		collect(diff.Rules, perseoServer.PostRules(client, headers, rules.Added))
+	}
+	if ents := append(entities.Added, entities.Changed...); len(ents) > 0 {
+		merged := orion.Merge(desired.EntityTypes, ents)
+		collect(diff.Entities, orionServer.UpdateEntities(client, headers, merged, options.BatchSize, false))
+	}
+
+	// Prune in reverse order
+	if len(entities.Removed) > 0 {
+		collect(diff.Entities, orionServer.DeleteEntities(client, headers, entities.Removed, options.BatchSize))
+	}
+	if len(rules.Removed) > 0 {
+		collect(diff.Rules, perseoServer.DeleteRules(client, headers, rules.Removed))
+	}
+	if len(subs.Removed) > 0 {
+		collect(diff.Subscriptions, orionServer.DeleteSuscriptions(client, headers, subs.Removed, false))
+	}
+	if len(devices.Removed) > 0 {
+		collect(diff.Devices, iotamServer.DeleteDevices(client, headers, devices.Removed))
+	}
+	if len(groups.Removed) > 0 {
+		collect(diff.DeviceGroups, iotamServer.DeleteServices(client, headers, groups.Removed))
+	}
+	return errors.Join(errList...)
+}
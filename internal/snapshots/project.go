@@ -1,8 +1,11 @@
 package snapshots
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"sort"
+	"sync"
 
 	"github.com/warpcomdev/fiware/internal/config"
 	"github.com/warpcomdev/fiware/internal/perseo"
@@ -23,6 +26,14 @@ func ProjectList(projects []models.Project) []string {
 
 // Snap takes an snapshot of all assets in project
 func Project(client keystone.HTTPClient, api *keystone.Keystone, selected config.Config, headers http.Header, project models.Project, assets []string, maximum int) (models.Manifest, error) {
+	return ProjectEndpoints(client, api, selected, headers, project, assets, maximum, config.FromConfig(selected).NotificationEndpoints)
+}
+
+// ProjectEndpoints is like Project, but replaces the notification URLs
+// of subscriptions with the given endpoints. URLs not in the endpoints
+// are simplified, and added to them, so that the endpoints can be
+// passed to diff.Manifests to compare the live subscriptions.
+func ProjectEndpoints(client keystone.HTTPClient, api *keystone.Keystone, selected config.Config, headers http.Header, project models.Project, assets []string, maximum int, endpoints map[string]string) (models.Manifest, error) {
 	var result models.Manifest
 	assetMap := map[string]bool{
 		"entities":      true,
@@ -56,7 +67,7 @@ func Project(client keystone.HTTPClient, api *keystone.Keystone, selected config
 		err          error
 	)
 	if assetMap["entities"] || assetMap["subscriptions"] || assetMap["registrations"] {
-		if orionServer, err = orion.New(selected.OrionURL); err != nil {
+		if orionServer, err = orion.NewDialect(selected.OrionURL, selected.NGSI, selected.LDContext); err != nil {
 			return result, err
 		}
 	}
@@ -71,58 +82,126 @@ func Project(client keystone.HTTPClient, api *keystone.Keystone, selected config
 		}
 	}
 
+	// Orion, Perseo and IoTA-M are queried concurrently. Each goroutine
+	// fills a different set of fields in the result.
+	var (
+		wg      sync.WaitGroup
+		errList [3]error
+	)
+
 	// Dump orion: entities, subscriptions and registrations
-	if assetMap["entities"] {
-		types, entities, err := orionServer.Entities(client, headers, "", "", "", maximum)
-		if err != nil {
-			return result, err
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if assetMap["entities"] {
+			types, entities, err := orionServer.Entities(client, headers, "", "", "", maximum)
+			if err != nil {
+				errList[0] = err
+				return
+			}
+			result.EntityTypes = types
+			result.Entities = entities
 		}
-		result.EntityTypes = types
-		result.Entities = entities
-	}
-	if assetMap["subscriptions"] {
-		subs, err := orionServer.Subscriptions(client, headers, config.FromConfig(selected).NotificationEndpoints)
-		if err != nil {
-			return result, err
+		if assetMap["subscriptions"] {
+			subs, err := orionServer.Subscriptions(client, headers, endpoints)
+			if err != nil {
+				errList[0] = err
+				return
+			}
+			result.Subscriptions = orion.SubsMap(subs)
 		}
-		result.Subscriptions = orion.SubsMap(subs)
-	}
-	if assetMap["registrations"] {
-		regs, err := orionServer.Registrations(client, headers)
-		if err != nil {
-			return result, err
+		if assetMap["registrations"] {
+			regs, err := orionServer.Registrations(client, headers)
+			if err != nil {
+				errList[0] = err
+				return
+			}
+			result.Registrations = regs
 		}
-		result.Registrations = regs
-	}
+	}()
 
 	// Dump perseo: rules
-	if assetMap["rules"] {
-		rules, err := perseoServer.Rules(client, headers)
-		if err != nil {
-			return result, err
-		}
-		namedRules := make(map[string]models.Rule, len(rules))
-		for _, rule := range rules {
-			namedRules[rule.Name] = rule
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if assetMap["rules"] {
+			rules, err := perseoServer.Rules(client, headers)
+			if err != nil {
+				errList[1] = err
+				return
+			}
+			namedRules := make(map[string]models.Rule, len(rules))
+			for _, rule := range rules {
+				namedRules[rule.Name] = rule
+			}
+			result.Rules = namedRules
 		}
-		result.Rules = namedRules
-	}
+	}()
 
 	// Dump iotam: groups and devices
-	if assetMap["services"] {
-		groups, err := iotamServer.DeviceGroups(client, headers)
-		if err != nil {
-			return result, err
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if assetMap["services"] {
+			groups, err := iotamServer.DeviceGroups(client, headers)
+			if err != nil {
+				errList[2] = err
+				return
+			}
+			result.DeviceGroups = groups
 		}
-		result.DeviceGroups = groups
-	}
-	if assetMap["devices"] {
-		devices, err := iotamServer.Devices(client, headers)
-		if err != nil {
-			return result, err
+		if assetMap["devices"] {
+			devices, err := iotamServer.Devices(client, headers)
+			if err != nil {
+				errList[2] = err
+				return
+			}
+			result.Devices = devices
 		}
-		result.Devices = devices
-	}
+	}()
 
+	wg.Wait()
+	if err := errors.Join(errList[:]...); err != nil {
+		return result, err
+	}
 	return result, nil
 }
+
+// ProjectResult is the outcome of a snapshot of a single project
+type ProjectResult struct {
+	Project  models.Project
+	Manifest models.Manifest
+	Err      error
+}
+
+// Projects takes a snapshot of several projects, using up to `parallel`
+// concurrent workers. Results are returned in the same order as the
+// projects, and errors are reported per project.
+func Projects(client keystone.HTTPClient, api *keystone.Keystone, selected config.Config, headers http.Header, projects []models.Project, assets []string, maximum int, parallel int) []ProjectResult {
+	if parallel < 1 {
+		parallel = 1
+	}
+	results := make([]ProjectResult, len(projects))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for range min(parallel, len(projects)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				project := projects[index]
+				manifest, err := Project(client, api, selected, headers, project, assets, maximum)
+				if err != nil {
+					err = fmt.Errorf("while downloading subservice %s: %w", project.Name, err)
+				}
+				results[index] = ProjectResult{Project: project, Manifest: manifest, Err: err}
+			}
+		}()
+	}
+	for index := range projects {
+		indexes <- index
+	}
+	close(indexes)
+	wg.Wait()
+	return results
+}
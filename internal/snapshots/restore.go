@@ -0,0 +1,127 @@
+package snapshots
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/warpcomdev/fiware/internal/config"
+	"github.com/warpcomdev/fiware/internal/diff"
+	"github.com/warpcomdev/fiware/internal/storage"
+	"github.com/warpcomdev/fiware/internal/urbo"
+	"github.com/warpcomdev/fiware/keystone"
+	"github.com/warpcomdev/fiware/models"
+)
+
+// Restorer returns a storage.RestoreFunc that pushes snapshots back to
+// the platform of their context, with the credentials in the request.
+// Urbo panels are uploaded again, and any other snapshot is restored as
+// a manifest, reconciling the subservice with it the same way `apply` does.
+func Restorer(client keystone.HTTPClient, store *config.Store) storage.RestoreFunc {
+	return func(r *http.Request, context, resourceType string, data []byte, prune bool) (diff.Report, error) {
+		selected, err := config.FromHeaders(r, store)
+		if err != nil {
+			return diff.Report{}, err
+		}
+		if selected.Name != context {
+			return diff.Report{}, fmt.Errorf("snapshot belongs to context %s, not %s", context, selected.Name)
+		}
+		if resourceType == "panels" {
+			// Same as the urbo API, which takes the token as bearer
+			if bearer := r.Header.Get("Authorization"); strings.HasPrefix(bearer, "Bearer ") {
+				selected.UrboToken = strings.TrimPrefix(bearer, "Bearer ")
+			}
+			return restorePanel(client, selected, data)
+		}
+		var manifest models.Manifest
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			return diff.Report{}, fmt.Errorf("snapshot is not a manifest: %w", err)
+		}
+		return RestoreManifest(client, selected, manifest, prune)
+	}
+}
+
+// RestoreManifest reconciles the subservice of the manifest (or the
+// selected one, if the manifest has none) with the manifest. Resources
+// not in the manifest are only deleted if prune is true.
+// Returns the changes applied.
+func RestoreManifest(client keystone.HTTPClient, selected config.Config, desired models.Manifest, prune bool) (diff.Report, error) {
+	kinds := diff.ManifestKinds(desired)
+	if len(kinds) <= 0 {
+		return diff.Report{}, errors.New("snapshot has no resources that can be restored")
+	}
+	api, err := keystone.New(selected.KeystoneURL, selected.Username, selected.Service)
+	if err != nil {
+		return diff.Report{}, err
+	}
+	subservice := desired.Subservice
+	if subservice == "" {
+		subservice = selected.Subservice
+	}
+	project := models.Project{Name: "/" + strings.TrimPrefix(subservice, "/")}
+	selected.Subservice = project.Name
+	headers := api.Headers(project.Name, selected.Token)
+	// Read every live entity. With a cap, entities past it would be
+	// posted again, or never pruned.
+	endpoints := config.NotificationEndpoints(selected, desired.Environment.NotificationEndpoints)
+	live, err := ProjectEndpoints(client, api, selected, headers, project, kinds, 0, endpoints)
+	if err != nil {
+		return diff.Report{}, err
+	}
+
+	report, err := diff.Manifests(live, desired, kinds, endpoints)
+	if err != nil {
+		return report, err
+	}
+	if !prune {
+		kept := make([]diff.Resource, 0, len(report.Resources))
+		for _, res := range report.Resources {
+			if res.Action != diff.Removed {
+				kept = append(kept, res)
+			}
+		}
+		report.Resources = kept
+	}
+	if report.Empty() {
+		return report, nil
+	}
+	return report, Apply(client, selected, headers, desired, report, ApplyOptions{
+		Prune:     prune,
+		Endpoints: endpoints,
+	})
+}
+
+// restorePanel uploads the panel to urbo, if it differs from the live one
+func restorePanel(client keystone.HTTPClient, selected config.Config, data []byte) (diff.Report, error) {
+	var panel struct {
+		Slug string `json:"slug"`
+	}
+	if err := json.Unmarshal(data, &panel); err != nil {
+		return diff.Report{}, err
+	}
+	if panel.Slug == "" {
+		return diff.Report{}, errors.New("panel must have slug")
+	}
+	api, err := urbo.New(selected.UrboURL, selected.Username, selected.Service, selected.Service)
+	if err != nil {
+		return diff.Report{}, err
+	}
+	headers := api.Headers(selected.UrboToken)
+	var report diff.Report
+	live, err := api.DownloadPanel(client, headers, panel.Slug)
+	if err != nil {
+		var netErr keystone.NetError
+		if !errors.As(err, &netErr) || netErr.StatusCode != http.StatusNotFound {
+			return report, err
+		}
+		report.Resources = []diff.Resource{{Kind: "panels", Key: panel.Slug, Action: diff.Added}}
+	} else if report, err = storage.Compare("panels", panel.Slug, live, data); err != nil {
+		return report, err
+	}
+	if report.Empty() {
+		return report, nil
+	}
+	return report, api.UploadPanel(client, headers, data)
+}
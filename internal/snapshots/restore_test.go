@@ -0,0 +1,56 @@
+package snapshots
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/warpcomdev/fiware/internal/diff"
+	"github.com/warpcomdev/fiware/internal/fakeplatform"
+	"github.com/warpcomdev/fiware/models"
+)
+
+func TestRestoreManifestLargeSubservice(t *testing.T) {
+	platform := fakeplatform.New()
+	defer platform.Close()
+
+	// More live entities than the old cap of 10000
+	const count = 10001
+	entities := make([]models.Entity, 0, count)
+	for i := 0; i < count; i++ {
+		id := fmt.Sprintf("s%05d", i)
+		if err := platform.AddEntity("/riego", json.RawMessage(`{"id":"`+id+`","type":"Sensor","temperature":{"type":"Number","value":20}}`)); err != nil {
+			t.Fatal(err)
+		}
+		entities = append(entities, models.Entity{
+			ID:    id,
+			Type:  "Sensor",
+			Attrs: map[string]json.RawMessage{"temperature": json.RawMessage(`20`)},
+		})
+	}
+	selected := platform.Config("/riego")
+	snapshot := models.Manifest{
+		EntityTypes: []models.EntityType{{Type: "Sensor", Attrs: []models.Attribute{{Name: "temperature", Type: "Number"}}}},
+		Entities:    entities,
+	}
+
+	// Every entity in the snapshot is live, nothing to restore
+	report, err := RestoreManifest(http.DefaultClient, selected, snapshot, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Empty() {
+		t.Fatalf("expected no changes, got %d added", report.Count(diff.Added))
+	}
+
+	// The last live entity is not in the snapshot, and must be pruned
+	snapshot.Entities = entities[:count-1]
+	report, err = RestoreManifest(http.DefaultClient, selected, snapshot, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Resources) != 1 || report.Resources[0].Action != diff.Removed || report.Resources[0].Key != "Sensor/s10000" {
+		t.Errorf("expected Sensor/s10000 removed, got %+v", report.Resources)
+	}
+}
@@ -0,0 +1,156 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// IndexFile is the name of the file, in each asset folder, that records
+// which snapshots share the same content.
+const IndexFile = ".index.json"
+
+// contentHash is the sha256 of the canonical form of the data.
+// JSON is re-encoded with sorted keys and no whitespace, so that
+// snapshots only differing in formatting get the same hash.
+// Numbers are kept as written, so large integers are not rounded.
+//
+// Since snapshots differing only in formatting share the same file,
+// Load may return the formatting of an earlier snapshot, instead of
+// the exact bytes saved.
+func contentHash(data []byte) string {
+	var content any
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&content); err == nil && !decoder.More() {
+		var canonical bytes.Buffer
+		encoder := json.NewEncoder(&canonical)
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(content); err == nil {
+			data = canonical.Bytes()
+		}
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// assetIndex maps content hashes to the snapshots with that content
+type assetIndex map[string][]string
+
+// loadIndex reads the index of the asset folder. If the index is
+// missing or corrupt, it is rebuilt from the snapshots in the folder.
+func (s *Store) loadIndex(assetPath string) (assetIndex, error) {
+	data, err := os.ReadFile(filepath.Join(assetPath, IndexFile))
+	if err == nil {
+		var index assetIndex
+		if err := json.Unmarshal(data, &index); err == nil && index != nil {
+			return index, nil
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	snapshots, err := s.readDir(assetPath, false)
+	if err != nil {
+		return nil, err
+	}
+	index := make(assetIndex)
+	for _, snapshot := range snapshots {
+		if strings.HasPrefix(snapshot, ".") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(assetPath, snapshot))
+		if err != nil {
+			return nil, err
+		}
+		index.add(contentHash(data), snapshot)
+	}
+	return index, nil
+}
+
+// save the index in the asset folder, or remove it if empty
+func (index assetIndex) save(assetPath string) error {
+	indexFile := filepath.Join(assetPath, IndexFile)
+	if len(index) == 0 {
+		if err := os.Remove(indexFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	data, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	safe := fmt.Sprintf("%s.%d", indexFile, time.Now().UnixNano())
+	if err := os.WriteFile(safe, data, 0644); err != nil {
+		os.Remove(safe)
+		return err
+	}
+	if err := os.Rename(safe, indexFile); err != nil {
+		os.Remove(safe)
+		return err
+	}
+	return nil
+}
+
+// add the snapshot to the content hash
+func (index assetIndex) add(sum, snapshot string) {
+	if !slices.Contains(index[sum], snapshot) {
+		index[sum] = append(index[sum], snapshot)
+	}
+}
+
+// remove the snapshot from the index
+func (index assetIndex) remove(snapshot string) {
+	for sum, snapshots := range index {
+		snapshots = slices.DeleteFunc(snapshots, func(s string) bool { return s == snapshot })
+		if len(snapshots) == 0 {
+			delete(index, sum)
+		} else {
+			index[sum] = snapshots
+		}
+	}
+}
+
+// rename the snapshot in the index
+func (index assetIndex) rename(oldSnapshot, newSnapshot string) {
+	index.remove(newSnapshot)
+	for _, snapshots := range index {
+		if i := slices.Index(snapshots, oldSnapshot); i >= 0 {
+			snapshots[i] = newSnapshot
+		}
+	}
+}
+
+// linkDuplicate links the snapshot file to an existing snapshot with
+// the same content, if there is any. Returns false if there is none,
+// or it cannot be linked (e.g. the filesystem does not support it).
+func (index assetIndex) linkDuplicate(assetPath, sum, snapshot string) bool {
+	snapFile := filepath.Join(assetPath, snapshot)
+	for _, candidate := range index[sum] {
+		if candidate == snapshot {
+			// Same name and content, nothing to do
+			if _, err := os.Stat(snapFile); err == nil {
+				return true
+			}
+			continue
+		}
+		safe := fmt.Sprintf("%s.%d", snapFile, time.Now().UnixNano())
+		if err := os.Link(filepath.Join(assetPath, candidate), safe); err != nil {
+			continue
+		}
+		if err := os.Rename(safe, snapFile); err != nil {
+			os.Remove(safe)
+			return false
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// saveAll saves the snapshots of the asset prod/entities/riego
+func saveAll(t *testing.T, store *Store, snapshots map[string]string) string {
+	t.Helper()
+	for snapshot, content := range snapshots {
+		if err := store.SaveSnapshot("prod", "entities", "riego", snapshot, strings.NewReader(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return filepath.Join(store.Path, "prod", "entities", "riego")
+}
+
+// sameFile is true if both snapshots are links to the same file
+func sameFile(t *testing.T, assetPath, a, b string) bool {
+	t.Helper()
+	infoA, err := os.Stat(filepath.Join(assetPath, a))
+	if err != nil {
+		t.Fatal(err)
+	}
+	infoB, err := os.Stat(filepath.Join(assetPath, b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return os.SameFile(infoA, infoB)
+}
+
+// readIndex decodes the index file of the asset
+func readIndex(t *testing.T, assetPath string) assetIndex {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(assetPath, IndexFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var index assetIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		t.Fatal(err)
+	}
+	return index
+}
+
+func TestSaveSnapshotDedup(t *testing.T) {
+	store := New(t.TempDir())
+	assetPath := saveAll(t, store, map[string]string{"a.json": `{"id": "s1", "value": 1}`})
+	saveAll(t, store, map[string]string{
+		"b.json": "{\n  \"value\": 1,\n  \"id\": \"s1\"\n}",
+		"c.json": `{"id":"s1","value":2}`,
+	})
+
+	if !sameFile(t, assetPath, "a.json", "b.json") {
+		t.Error("expected snapshots differing in formatting to be linked")
+	}
+	if sameFile(t, assetPath, "a.json", "c.json") {
+		t.Error("expected snapshots with different content not to be linked")
+	}
+	data, err := store.Load("prod", "entities", "riego", "b.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"id": "s1", "value": 1}` {
+		t.Errorf("expected the formatting of the first snapshot, got %s", data)
+	}
+	snapshots, err := store.Snapshots("prod", "entities", "riego")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(snapshots, []string{"c.json", "b.json", "a.json"}) {
+		t.Errorf("expected the index to be hidden, got %v", snapshots)
+	}
+}
+
+func TestSaveSnapshotLargeNumbers(t *testing.T) {
+	store := New(t.TempDir())
+	assetPath := saveAll(t, store, map[string]string{"a.json": `{"big":9007199254740993}`})
+	saveAll(t, store, map[string]string{"b.json": `{"big":9007199254740992}`})
+	if sameFile(t, assetPath, "a.json", "b.json") {
+		t.Error("expected large integers not to be rounded")
+	}
+}
+
+func TestIndexRenameRemove(t *testing.T) {
+	store := New(t.TempDir())
+	content := `{"id":"s1"}`
+	assetPath := saveAll(t, store, map[string]string{"a.json": content})
+	saveAll(t, store, map[string]string{"b.json": content})
+	sum := contentHash([]byte(content))
+
+	if err := store.RenameSnapshot("prod", "entities", "riego", "a.json", "first.json"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readIndex(t, assetPath)[sum]; !slices.Equal(got, []string{"first.json", "b.json"}) {
+		t.Errorf("expected the renamed snapshot in the index, got %v", got)
+	}
+
+	if err := store.RemoveSnapshot("prod", "entities", "riego", "first.json"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readIndex(t, assetPath)[sum]; !slices.Equal(got, []string{"b.json"}) {
+		t.Errorf("expected the removed snapshot out of the index, got %v", got)
+	}
+	// Removing the link must not affect the remaining snapshot
+	if data, err := store.Load("prod", "entities", "riego", "b.json"); err != nil || string(data) != content {
+		t.Errorf("unexpected content %s (%v)", data, err)
+	}
+
+	// A new duplicate links to the remaining snapshot
+	saveAll(t, store, map[string]string{"c.json": content})
+	if !sameFile(t, assetPath, "b.json", "c.json") {
+		t.Error("expected the new snapshot to be linked")
+	}
+
+	// The asset folder is removed with the last snapshot
+	for _, snapshot := range []string{"b.json", "c.json"} {
+		if err := store.RemoveSnapshot("prod", "entities", "riego", snapshot); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(assetPath); !os.IsNotExist(err) {
+		t.Errorf("expected the asset folder to be removed, got %v", err)
+	}
+}
+
+func TestIndexRebuild(t *testing.T) {
+	for name, corrupt := range map[string]func(indexFile string) error{
+		"missing": os.Remove,
+		"corrupt": func(indexFile string) error { return os.WriteFile(indexFile, []byte("{not json"), 0644) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			store := New(t.TempDir())
+			content := `{"id":"s1"}`
+			assetPath := saveAll(t, store, map[string]string{"a.json": content})
+			if err := corrupt(filepath.Join(assetPath, IndexFile)); err != nil {
+				t.Fatal(err)
+			}
+			saveAll(t, store, map[string]string{"b.json": content})
+			if !sameFile(t, assetPath, "a.json", "b.json") {
+				t.Error("expected the index to be rebuilt from the snapshots")
+			}
+			if got := readIndex(t, assetPath)[contentHash([]byte(content))]; !slices.Equal(got, []string{"a.json", "b.json"}) {
+				t.Errorf("unexpected index %v", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/warpcomdev/fiware/internal/diff"
+	"github.com/warpcomdev/fiware/models"
+)
+
+// RestoreFunc pushes the data of a snapshot back to the platform, using
+// the credentials in the request. Returns the changes applied.
+type RestoreFunc func(r *http.Request, context, resourceType string, data []byte, prune bool) (diff.Report, error)
+
+// asManifest decodes the snapshot as a manifest. Fails if the snapshot
+// has fields unknown to the manifest, or no resources that can be compared.
+func asManifest(data []byte) (models.Manifest, bool) {
+	var manifest models.Manifest
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&manifest); err != nil {
+		return manifest, false
+	}
+	return manifest, len(diff.ManifestKinds(manifest)) > 0
+}
+
+// Compare the data of two snapshots. Manifests are compared resource by
+// resource, any other content (e.g. urbo panels) is compared as a single
+// resource of the given kind and key.
+func Compare(kind, key string, from, to []byte) (diff.Report, error) {
+	fromManifest, fromOK := asManifest(from)
+	toManifest, toOK := asManifest(to)
+	if fromOK && toOK {
+		kinds := diff.ManifestKinds(fromManifest)
+		for _, kind := range diff.ManifestKinds(toManifest) {
+			if !slices.Contains(kinds, kind) {
+				kinds = append(kinds, kind)
+			}
+		}
+		return diff.Manifests(fromManifest, toManifest, kinds, nil)
+	}
+	var fromData, toData any
+	if err := json.Unmarshal(from, &fromData); err != nil {
+		return diff.Report{}, fmt.Errorf("while decoding %s %s: %w", kind, key, err)
+	}
+	if err := json.Unmarshal(to, &toData); err != nil {
+		return diff.Report{}, fmt.Errorf("while decoding %s %s: %w", kind, key, err)
+	}
+	report := diff.Report{Resources: make([]diff.Resource, 0, 1)}
+	changes, err := diff.Fields(fromData, toData)
+	if err != nil {
+		return report, err
+	}
+	if len(changes) > 0 {
+		report.Resources = append(report.Resources, diff.Resource{Kind: kind, Key: key, Action: diff.Changed, Changes: changes})
+	}
+	return report, nil
+}
+
+// Diff compares two snapshots of the same asset, and reports the
+// changes made from snapshot `from` to snapshot `to`.
+func (s *Store) Diff(context, resourceType, asset, from, to string) (diff.Report, error) {
+	fromData, err := s.Load(context, resourceType, asset, from)
+	if err != nil {
+		return diff.Report{}, err
+	}
+	toData, err := s.Load(context, resourceType, asset, to)
+	if err != nil {
+		return diff.Report{}, err
+	}
+	return Compare(resourceType, asset, fromData, toData)
+}
+
+// serveReport writes the report as JSON
+func serveReport(w http.ResponseWriter, report diff.Report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// RetentionFile is the name of the file, in the root of the store,
+// where retention policies are kept.
+const RetentionFile = "retention.json"
+
+// snapshotLayout is the format of the names given to snapshots by Save
+const snapshotLayout = "20060102-150405"
+
+// Policy decides which snapshots of an asset are kept.
+// A snapshot is kept if any of the rules keeps it.
+// Policies without rules keep every snapshot.
+type Policy struct {
+	Last    int `json:"last,omitempty"`    // keep the last N snapshots
+	Daily   int `json:"daily,omitempty"`   // keep the newest snapshot of each day, for N days
+	Monthly int `json:"monthly,omitempty"` // keep the newest snapshot of each month, for N months
+}
+
+// IsZero is true if the policy has no rules
+func (p Policy) IsZero() bool {
+	return p.Last <= 0 && p.Daily <= 0 && p.Monthly <= 0
+}
+
+// Policies by "{context}/{resourceType}". Either part can be "*",
+// to match any context or resource type.
+type Policies map[string]Policy
+
+// For returns the policy of the context and resource type. The most
+// specific key wins: "ctx/type", then "ctx/*", "*/type" and "*/*".
+func (p Policies) For(context, resourceType string) Policy {
+	for _, key := range []string{
+		context + "/" + resourceType,
+		context + "/*",
+		"*/" + resourceType,
+		"*/*",
+	} {
+		if policy, ok := p[key]; ok {
+			return policy
+		}
+	}
+	return Policy{}
+}
+
+// LoadPolicies reads the retention policies of the store.
+// Returns no policies if the file does not exist.
+func (s *Store) LoadPolicies() (Policies, error) {
+	data, err := os.ReadFile(filepath.Join(s.Path, RetentionFile))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return Policies{}, nil
+		}
+		return nil, err
+	}
+	var policies Policies
+	if err := json.Unmarshal(data, &policies); err != nil {
+		return nil, fmt.Errorf("while decoding %s: %w", RetentionFile, err)
+	}
+	for key := range policies {
+		if context, resourceType, ok := strings.Cut(key, "/"); !ok || context == "" || resourceType == "" {
+			return nil, fmt.Errorf("invalid retention key %q, must be {context}/{resourceType}", key)
+		}
+	}
+	return policies, nil
+}
+
+// Expired returns the snapshots that the policy does not keep, at time now.
+// Snapshots must be sorted newest first, as returned by Store.Snapshots.
+// Only snapshots named by Save expire; renamed snapshots are always kept.
+func (p Policy) Expired(snapshots []string, now time.Time) []string {
+	if p.IsZero() {
+		return nil
+	}
+	dailyLimit := now.AddDate(0, 0, -p.Daily)
+	monthlyLimit := now.AddDate(0, -p.Monthly, 0)
+	days := make(map[string]struct{})
+	months := make(map[string]struct{})
+	expired := make([]string, 0, len(snapshots))
+	count := 0
+	for _, snapshot := range snapshots {
+		stamp, err := time.ParseInLocation(snapshotLayout, strings.TrimSuffix(snapshot, ".json"), now.Location())
+		if err != nil || !strings.HasSuffix(snapshot, ".json") {
+			continue
+		}
+		count += 1
+		keep := count <= p.Last
+		if day := stamp.Format("20060102"); p.Daily > 0 && stamp.After(dailyLimit) {
+			if _, seen := days[day]; !seen {
+				days[day] = struct{}{}
+				keep = true
+			}
+		}
+		if month := stamp.Format("200601"); p.Monthly > 0 && stamp.After(monthlyLimit) {
+			if _, seen := months[month]; !seen {
+				months[month] = struct{}{}
+				keep = true
+			}
+		}
+		if !keep {
+			expired = append(expired, snapshot)
+		}
+	}
+	return expired
+}
+
+// Pruned is a snapshot removed, or to be removed, by Prune
+type Pruned struct {
+	Context      string `json:"context"`
+	ResourceType string `json:"resourceType"`
+	Asset        string `json:"asset"`
+	Snapshot     string `json:"snapshot"`
+}
+
+// String implements fmt.Stringer
+func (p Pruned) String() string {
+	return filepath.Join(p.Context, p.ResourceType, p.Asset, p.Snapshot)
+}
+
+// Prune removes the snapshots of every asset in the store that
+// the policies do not keep. If dryRun, nothing is removed.
+// Returns the snapshots removed.
+func (s *Store) Prune(policies Policies, now time.Time, dryRun bool) ([]Pruned, error) {
+	contexts, err := s.readDir(s.Path, true)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		pruned  []Pruned
+		errList []error
+	)
+	for _, context := range contexts {
+		resourceTypes, err := s.readDir(filepath.Join(s.Path, context), true)
+		if err != nil {
+			errList = append(errList, err)
+			continue
+		}
+		for _, resourceType := range resourceTypes {
+			policy := policies.For(context, resourceType)
+			if policy.IsZero() {
+				continue
+			}
+			assets, err := s.Assets(context, resourceType)
+			if err != nil {
+				errList = append(errList, err)
+				continue
+			}
+			for _, asset := range assets {
+				snapshots, err := s.Snapshots(context, resourceType, asset)
+				if err != nil {
+					errList = append(errList, err)
+					continue
+				}
+				for _, snapshot := range policy.Expired(snapshots, now) {
+					item := Pruned{Context: context, ResourceType: resourceType, Asset: asset, Snapshot: snapshot}
+					if !dryRun {
+						if err := s.RemoveSnapshot(context, resourceType, asset, snapshot); err != nil {
+							errList = append(errList, fmt.Errorf("while removing %s: %w", item, err))
+							continue
+						}
+					}
+					pruned = append(pruned, item)
+				}
+			}
+		}
+	}
+	return pruned, errors.Join(errList...)
+}
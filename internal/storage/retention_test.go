@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testSnapshots are sorted newest first, like Store.Snapshots
+var testSnapshots = []string{
+	"renamed.json",
+	"notes.txt",
+	"20240315-110000.json",
+	"20240315-100000.json",
+	"20240314-100000.json",
+	"20240301-100000.json",
+	"20240215-100000.json",
+	"20240101-100000.json",
+}
+
+func TestPolicyExpired(t *testing.T) {
+	now := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		name    string
+		policy  Policy
+		expired []string
+	}{
+		{
+			name:   "zero policy keeps everything",
+			policy: Policy{},
+		},
+		{
+			name:    "last",
+			policy:  Policy{Last: 1},
+			expired: []string{"20240315-100000.json", "20240314-100000.json", "20240301-100000.json", "20240215-100000.json", "20240101-100000.json"},
+		},
+		{
+			name:    "daily",
+			policy:  Policy{Daily: 2},
+			expired: []string{"20240315-100000.json", "20240301-100000.json", "20240215-100000.json", "20240101-100000.json"},
+		},
+		{
+			name:    "monthly",
+			policy:  Policy{Monthly: 2},
+			expired: []string{"20240315-100000.json", "20240314-100000.json", "20240301-100000.json", "20240101-100000.json"},
+		},
+		{
+			name:    "combined",
+			policy:  Policy{Last: 2, Daily: 1, Monthly: 3},
+			expired: []string{"20240314-100000.json", "20240301-100000.json"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := tc.policy.Expired(testSnapshots, now)
+			if !slices.Equal(got, tc.expired) {
+				t.Errorf("expected %v, got %v", tc.expired, got)
+			}
+		})
+	}
+}
+
+func TestPoliciesFor(t *testing.T) {
+	policies := Policies{
+		"prod/entities": {Last: 1},
+		"prod/*":        {Last: 2},
+		"*/entities":    {Last: 3},
+		"*/*":           {Last: 4},
+	}
+	for _, tc := range []struct {
+		context, resourceType string
+		last                  int
+	}{
+		{"prod", "entities", 1},
+		{"prod", "rules", 2},
+		{"dev", "entities", 3},
+		{"dev", "rules", 4},
+	} {
+		if got := policies.For(tc.context, tc.resourceType); got.Last != tc.last {
+			t.Errorf("%s/%s: expected last %d, got %d", tc.context, tc.resourceType, tc.last, got.Last)
+		}
+	}
+	if !(Policies{}).For("prod", "entities").IsZero() {
+		t.Error("expected a zero policy when nothing matches")
+	}
+}
+
+func TestLoadPolicies(t *testing.T) {
+	store := New(t.TempDir())
+	policies, err := store.LoadPolicies()
+	if err != nil || len(policies) != 0 {
+		t.Fatalf("expected no policies without file, got %v (%v)", policies, err)
+	}
+
+	retention := filepath.Join(store.Path, RetentionFile)
+	if err := os.WriteFile(retention, []byte(`{"prod/entities":{"last":3,"daily":7}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	policies, err = store.LoadPolicies()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := policies.For("prod", "entities"); got != (Policy{Last: 3, Daily: 7}) {
+		t.Errorf("unexpected policy %+v", got)
+	}
+
+	for _, invalid := range []string{`{"entities":{"last":1}}`, `{"/entities":{"last":1}}`, `[]`} {
+		if err := os.WriteFile(retention, []byte(invalid), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.LoadPolicies(); err == nil {
+			t.Errorf("expected %s to fail", invalid)
+		}
+	}
+}
+
+func TestPrune(t *testing.T) {
+	store := New(t.TempDir())
+	for _, resourceType := range []string{"entities", "rules"} {
+		for i, snapshot := range []string{"20240315-110000.json", "20240314-100000.json", "20240301-100000.json"} {
+			content := strings.NewReader(`{"version":` + strconv.Itoa(i) + `}`)
+			if err := store.SaveSnapshot("prod", resourceType, "riego", snapshot, content); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	policies := Policies{"prod/entities": {Last: 1}}
+	now := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+
+	pruned, err := store.Prune(policies, now, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pruned) != 2 || pruned[0].String() != filepath.Join("prod", "entities", "riego", "20240314-100000.json") {
+		t.Errorf("unexpected dry run result %v", pruned)
+	}
+	if snapshots, _ := store.Snapshots("prod", "entities", "riego"); len(snapshots) != 3 {
+		t.Errorf("dry run must not remove snapshots, got %v", snapshots)
+	}
+
+	if _, err := store.Prune(policies, now, false); err != nil {
+		t.Fatal(err)
+	}
+	if snapshots, _ := store.Snapshots("prod", "entities", "riego"); !slices.Equal(snapshots, []string{"20240315-110000.json"}) {
+		t.Errorf("expected only the last snapshot kept, got %v", snapshots)
+	}
+	if snapshots, _ := store.Snapshots("prod", "rules", "riego"); len(snapshots) != 3 {
+		t.Errorf("resources without policy must be kept, got %v", snapshots)
+	}
+}
@@ -12,12 +12,18 @@ import (
 	"slices"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
 // Store manages storage of items
 type Store struct {
 	Path string
+	// Restore is called to push a snapshot back to the platform.
+	// Snapshots cannot be restored if nil.
+	Restore RestoreFunc
+	// mu serializes changes to the snapshot indexes
+	mu sync.Mutex
 }
 
 // New Store saving thing in a path
@@ -60,11 +66,14 @@ func (s *Store) Snapshots(context, resourceType, asset string) ([]string, error)
 	if err != nil {
 		return nil, err
 	}
+	// Skip the index
+	snapshots = slices.DeleteFunc(snapshots, func(s string) bool { return strings.HasPrefix(s, ".") })
 	sort.Sort(sort.Reverse(sort.StringSlice(snapshots)))
 	return snapshots, nil
 }
 
-// Load item in a particular snapshot
+// Load item in a particular snapshot. Snapshots deduplicated by
+// SaveSnapshot keep the JSON formatting of the first one saved.
 func (s *Store) Load(context, resourceType, asset, snapshot string) ([]byte, error) {
 	snap := filepath.Join(s.Path, context, resourceType, asset, snapshot)
 	data, err := os.Open(snap)
@@ -75,19 +84,43 @@ func (s *Store) Load(context, resourceType, asset, snapshot string) ([]byte, err
 	return io.ReadAll(data)
 }
 
-// Save a snapshot
+// Save a snapshot. If the asset already has a snapshot with the same
+// content, the new snapshot is a hard link to it instead of a copy.
 func (s *Store) SaveSnapshot(context, resourceType, asset, snapshot string, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
 	assetPath := filepath.Join(s.Path, context, resourceType, asset)
 	if err := os.MkdirAll(assetPath, 0755); err != nil {
 		return err
 	}
-	snapFile := filepath.Join(assetPath, snapshot)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	index, err := s.loadIndex(assetPath)
+	if err != nil {
+		return err
+	}
+	sum := contentHash(data)
+	if !index.linkDuplicate(assetPath, sum, snapshot) {
+		if err := writeSnapshot(filepath.Join(assetPath, snapshot), data); err != nil {
+			return err
+		}
+	}
+	index.remove(snapshot)
+	index.add(sum, snapshot)
+	return index.save(assetPath)
+}
+
+// writeSnapshot writes the data to a temporary file,
+// and moves it to the snapshot file when done.
+func writeSnapshot(snapFile string, data []byte) error {
 	safe := fmt.Sprintf("%s.%d", snapFile, time.Now().UnixNano())
 	outfile, err := os.Create(safe)
 	if err != nil {
 		return err
 	}
-	if _, err := io.Copy(outfile, r); err != nil {
+	if _, err := outfile.Write(data); err != nil {
 		outfile.Close()
 		os.Remove(safe)
 		return err
@@ -115,9 +148,19 @@ func (s *Store) Save(context, resourceType, asset string, r io.Reader) (string,
 func (s *Store) RemoveSnapshot(context, resourceType, asset, snapshot string) error {
 	assetFolder := filepath.Join(s.Path, context, resourceType, asset)
 	snapFile := filepath.Join(assetFolder, snapshot)
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	if err := os.Remove(snapFile); err != nil {
 		return err
 	}
+	index, err := s.loadIndex(assetFolder)
+	if err != nil {
+		return err
+	}
+	index.remove(snapshot)
+	if err := index.save(assetFolder); err != nil {
+		return err
+	}
 	files, err := os.ReadDir(assetFolder)
 	if err != nil {
 		return err
@@ -133,16 +176,30 @@ func (s *Store) RenameSnapshot(context, resourceType, asset, oldSnapshot, newSna
 	assetFolder := filepath.Join(s.Path, context, resourceType, asset)
 	oldSnapFile := filepath.Join(assetFolder, oldSnapshot)
 	newSnapFile := filepath.Join(assetFolder, newSnapshot)
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	if err := os.Rename(oldSnapFile, newSnapFile); err != nil {
 		return err
 	}
-	return nil
+	index, err := s.loadIndex(assetFolder)
+	if err != nil {
+		return err
+	}
+	index.rename(oldSnapshot, newSnapshot)
+	return index.save(assetFolder)
 }
 
 type patchRequest struct {
 	Name string `json:"name"`
 }
 
+// Serve the snapshots at /{context}/{resourceType}/{asset}/{snapshot}.
+// Besides listing, loading, saving, renaming and deleting snapshots:
+//
+//   - GET {snapshot}?from={other} compares both snapshots, and returns
+//     the changes made from snapshot {other} to {snapshot}.
+//   - POST {snapshot}?restore pushes the snapshot back to the platform.
+//     Resources not in the snapshot are only removed with &prune=true.
 func (s *Store) Serve() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Body != nil {
@@ -167,6 +224,25 @@ func (s *Store) Serve() http.Handler {
 				http.Error(w, "invalid path", http.StatusBadRequest)
 				return
 			}
+			if len(urlPath) == 4 && r.URL.Query().Has("restore") {
+				if s.Restore == nil {
+					http.Error(w, "restore not supported", http.StatusNotImplemented)
+					return
+				}
+				data, err := s.Load(urlPath[0], urlPath[1], urlPath[2], urlPath[3])
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusNotFound)
+					return
+				}
+				prune := r.URL.Query().Get("prune") == "true"
+				report, err := s.Restore(r, urlPath[0], urlPath[1], data, prune)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				serveReport(w, report)
+				return
+			}
 			var (
 				snapshot string
 				err      error
@@ -191,6 +267,19 @@ func (s *Store) Serve() http.Handler {
 				http.Error(w, "invalid path", http.StatusBadRequest)
 				return
 			}
+			if from := r.URL.Query().Get("from"); len(urlPath) == 4 && from != "" {
+				if from != filepath.Base(from) || strings.HasPrefix(from, ".") {
+					http.Error(w, "invalid snapshot name", http.StatusBadRequest)
+					return
+				}
+				report, err := s.Diff(urlPath[0], urlPath[1], urlPath[2], from, urlPath[3])
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				serveReport(w, report)
+				return
+			}
 			if len(urlPath) == 4 {
 				data, err := s.Load(urlPath[0], urlPath[1], urlPath[2], urlPath[3])
 				if err != nil {
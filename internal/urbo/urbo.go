@@ -280,6 +280,39 @@ func (u *Urbo) UploadPanel(client keystone.HTTPClient, headers http.Header, pane
 	return nil
 }
 
+// scopedURL returns the URL for the api path, with the service scope
+func (u *Urbo) scopedURL(apiPath string) (*url.URL, error) {
+	path, err := u.URL.Parse(apiPath)
+	if err != nil {
+		return nil, err
+	}
+	query := url.Values{}
+	query.Add("service", u.Service)
+	query.Add("scopeService", u.ScopeService)
+	path.RawQuery = query.Encode()
+	return path, nil
+}
+
+// DeleteVertical removes a vertical. The panels of the vertical are kept.
+func (u *Urbo) DeleteVertical(client keystone.HTTPClient, headers http.Header, slug string) error {
+	path, err := u.scopedURL(fmt.Sprintf("/api/verticals/%s", slug))
+	if err != nil {
+		return err
+	}
+	_, err = keystone.Query(client, http.MethodDelete, headers, path, nil, true)
+	return err
+}
+
+// DeletePanel removes a panel
+func (u *Urbo) DeletePanel(client keystone.HTTPClient, headers http.Header, slug string) error {
+	path, err := u.scopedURL(fmt.Sprintf("/api/panels/%s:%s", u.Service, slug))
+	if err != nil {
+		return err
+	}
+	_, err = keystone.Query(client, http.MethodDelete, headers, path, nil, true)
+	return err
+}
+
 // remove_id cleans a json object from "_id", and "__v" fields which are not useful
 func remove_id(m interface{}) {
 	if submap, ok := m.(map[string]interface{}); ok {
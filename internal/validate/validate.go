@@ -0,0 +1,169 @@
+// Package validate checks the consistency of a manifest before it is
+// deployed, without connecting to the platform. It cross-checks the
+// resources of the manifest against each other, to catch errors that
+// would otherwise show up halfway through a post or apply.
+package validate
+
+import (
+	"fmt"
+	"maps"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/warpcomdev/fiware/models"
+)
+
+// Finding is a problem found in a resource of the manifest
+type Finding struct {
+	Resource string `json:"resource"` // kind of resource (subscription, rule, deviceGroup...)
+	Name     string `json:"name"`     // name, description or id of the resource
+	Problem  string `json:"problem"`
+}
+
+// String implements fmt.Stringer
+func (f Finding) String() string {
+	return fmt.Sprintf("[%s %s] %s", f.Resource, f.Name, f.Problem)
+}
+
+// Perseo event fields that are not entity attributes
+var eventFields = []string{"id", "type", "service", "subservice", "servicePath", "noticeId"}
+
+var (
+	// Perseo rules filter by type with type="T" or type='T'
+	ruleTypePattern = regexp.MustCompile(`\btype\s*=\s*["']([^"']+)["']`)
+	// Perseo rules refer to attributes as attr? or ev.attr?
+	ruleAttrPattern = regexp.MustCompile(`([A-Za-z_]\w*)\?`)
+)
+
+// validator keeps the models of the manifest and the findings
+type validator struct {
+	types    map[string][]string // attribute names of each modelled entity type
+	findings []Finding
+}
+
+func (v *validator) found(resource, name, format string, args ...any) {
+	v.findings = append(v.findings, Finding{Resource: resource, Name: name, Problem: fmt.Sprintf(format, args...)})
+}
+
+// Manifest checks the manifest, and returns the problems found:
+//
+//   - the entity types of subscriptions, device groups and devices
+//     must be modelled in the entity types of the manifest.
+//   - subscription notification URLs must resolve through the
+//     given notification endpoints. These should be the endpoints of
+//     the manifest merged with those of the context, as returned by
+//     config.NotificationEndpoints.
+//   - perseo rules must only refer to modelled types, and to attributes
+//     of those types.
+//   - the panels of urbo verticals must be in the panel sources.
+func Manifest(manifest models.Manifest, endpoints map[string]string) []Finding {
+	v := &validator{types: make(map[string][]string, len(manifest.EntityTypes))}
+	for _, et := range manifest.EntityTypes {
+		for _, attr := range et.Attrs {
+			v.types[et.Type] = append(v.types[et.Type], attr.Name)
+		}
+		if _, ok := v.types[et.Type]; !ok {
+			v.types[et.Type] = nil
+		}
+	}
+	v.subscriptions(manifest.Subscriptions, endpoints)
+	v.rules(manifest.Rules)
+	for _, group := range manifest.DeviceGroups {
+		v.entityType("deviceGroup", group.Resource+"/"+group.APIKey, group.EntityType)
+	}
+	for _, device := range manifest.Devices {
+		v.entityType("device", device.DeviceId, device.EntityType)
+	}
+	v.verticals(manifest.Verticals, manifest.ManifestPanels)
+	return v.findings
+}
+
+// entityType checks that the entity type is modelled
+func (v *validator) entityType(resource, name, entityType string) {
+	if entityType == "" {
+		v.found(resource, name, "missing entity type")
+		return
+	}
+	if _, ok := v.types[entityType]; !ok {
+		v.found(resource, name, "entity type %s is not modelled", entityType)
+	}
+}
+
+func (v *validator) subscriptions(subs map[string]models.Subscription, endpoints map[string]string) {
+	for _, key := range slices.Sorted(maps.Keys(subs)) {
+		sub := subs[key]
+		name := sub.Description
+		if name == "" {
+			name = key
+		}
+		for _, entity := range sub.Subject.Entities {
+			// Entities without type match any type
+			if entity.Type != "" {
+				v.entityType("subscription", name, entity.Type)
+			}
+		}
+		if _, err := sub.UpdateEndpoint(endpoints); err != nil {
+			v.found("subscription", name, "%v", err)
+		}
+	}
+}
+
+func (v *validator) rules(rules map[string]models.Rule) {
+	for _, key := range slices.Sorted(maps.Keys(rules)) {
+		rule := rules[key]
+		name := rule.Name
+		if name == "" {
+			name = key
+		}
+		// Attributes can only be checked against the types in the rule
+		var known []string
+		for _, match := range ruleTypePattern.FindAllStringSubmatch(rule.Text, -1) {
+			attrs, ok := v.types[match[1]]
+			if !ok {
+				v.found("rule", name, "entity type %s is not modelled", match[1])
+				continue
+			}
+			known = append(known, attrs...)
+		}
+		if known == nil {
+			continue
+		}
+		var unknown []string
+		for _, match := range ruleAttrPattern.FindAllStringSubmatch(rule.Text, -1) {
+			// Metadata are flattened as attr__metadata__name
+			attr, _, _ := strings.Cut(match[1], "__")
+			if !slices.Contains(known, attr) && !slices.Contains(eventFields, attr) && !slices.Contains(unknown, attr) {
+				unknown = append(unknown, attr)
+			}
+		}
+		for _, attr := range unknown {
+			v.found("rule", name, "attribute %s is not modelled in the entity types of the rule", attr)
+		}
+	}
+}
+
+// verticals checks that every panel of the vertical has a source file.
+// Panel files are named after the panel slug.
+func (v *validator) verticals(verticals map[string]models.Vertical, panels models.PanelManifest) {
+	sources := make(map[string]struct{})
+	for _, source := range panels.Sources {
+		for _, file := range source.Files {
+			base := filepath.Base(file)
+			sources[strings.TrimSuffix(base, filepath.Ext(base))] = struct{}{}
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(verticals)) {
+		vertical := verticals[key]
+		name := vertical.Slug
+		if name == "" {
+			name = key
+		}
+		for _, slug := range vertical.AllPanels() {
+			if _, ok := sources[slug]; !ok {
+				v.found("vertical", name, "panel %s not found in panel sources", slug)
+			}
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package validate
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/warpcomdev/fiware/models"
+)
+
+func testManifest() models.Manifest {
+	return models.Manifest{
+		EntityTypes: []models.EntityType{
+			{Type: "Sensor", Attrs: []models.Attribute{{Name: "temperature"}, {Name: "humidity"}}},
+		},
+		Subscriptions: map[string]models.Subscription{
+			"lastdata": {
+				Description: "lastdata",
+				Subject:     models.Subject{Entities: []models.SubjectEntity{{IdPattern: ".*", Type: "Sensor"}}},
+				Notification: models.Notification{
+					HTTP: models.NotificationHTTP{URL: "LASTDATA"},
+				},
+			},
+		},
+		Rules: map[string]models.Rule{
+			"hot": {Text: `select *, ev.temperature? as t from iotEvent as ev where type="Sensor" and temperature__metadata__unit? = "CEL" and id? = "s1"`},
+		},
+		DeviceGroups: []models.DeviceGroup{{Resource: "/iot/json", APIKey: "key", EntityType: "Sensor"}},
+		Devices:      []models.Device{{DeviceId: "d1", EntityType: "Sensor"}},
+		Verticals: map[string]models.Vertical{
+			"riego": {Slug: "riego", Panels: []string{"main"}, ShadowPanels: []string{"detail"}},
+		},
+		ManifestPanels: models.PanelManifest{Sources: map[string]models.ManifestSource{
+			"riego": {Path: "./panels", Files: []string{"main.json", "sub/detail.json"}},
+		}},
+	}
+}
+
+func problems(findings []Finding) []string {
+	result := make([]string, 0, len(findings))
+	for _, finding := range findings {
+		result = append(result, finding.String())
+	}
+	return result
+}
+
+func TestManifestValid(t *testing.T) {
+	endpoints := map[string]string{"LASTDATA": "http://cygnus:5051/notify"}
+	if findings := Manifest(testManifest(), endpoints); len(findings) > 0 {
+		t.Errorf("expected no findings, got %v", problems(findings))
+	}
+}
+
+func TestManifestFindings(t *testing.T) {
+	manifest := testManifest()
+	sub := manifest.Subscriptions["lastdata"]
+	sub.Subject.Entities = append(sub.Subject.Entities, models.SubjectEntity{IdPattern: ".*", Type: "Pump"})
+	manifest.Subscriptions["lastdata"] = sub
+	manifest.Rules["cold"] = models.Rule{Name: "cold", Text: `select * from iotEvent where type="Sensor" and temp? < 0`}
+	manifest.Rules["flow"] = models.Rule{Name: "flow", Text: `select * from iotEvent where type='Pump' and flow? > 0`}
+	manifest.Devices = append(manifest.Devices, models.Device{DeviceId: "d2"})
+	manifest.Verticals["riego"] = models.Vertical{Slug: "riego", Panels: []string{"main", "missing"}}
+
+	got := problems(Manifest(manifest, nil))
+	want := []string{
+		"[subscription lastdata] entity type Pump is not modelled",
+		"[subscription lastdata] notification endpoint LASTDATA not found",
+		"[rule cold] attribute temp is not modelled in the entity types of the rule",
+		"[rule flow] entity type Pump is not modelled",
+		"[device d2] missing entity type",
+		"[vertical riego] panel missing not found in panel sources",
+	}
+	for _, problem := range want {
+		if !slices.Contains(got, problem) {
+			t.Errorf("expected finding %q, got %v", problem, got)
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("expected %d findings, got %v", len(want), got)
+	}
+}
@@ -1,6 +1,7 @@
 package iotam
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
@@ -152,6 +153,140 @@ func (i *Iotam) DeleteDevices(client keystone.HTTPClient, headers http.Header, d
 	return errors.Join(errList...)
 }
 
+// serviceUpdate holds the fields of a device group that can be updated.
+// Resource, apikey and protocol identify the group and go in the query.
+type serviceUpdate struct {
+	EntityType         string                   `json:"entity_type,omitempty"`
+	Description        string                   `json:"description,omitempty"`
+	Transport          string                   `json:"transport,omitempty"`
+	Timestamp          *bool                    `json:"timestamp,omitempty"`
+	ExplicitAttrs      json.RawMessage          `json:"explicitAttrs,omitempty"`
+	InternalAttributes []models.DeviceAttribute `json:"internal_attributes"`
+	Attributes         []models.DeviceAttribute `json:"attributes"`
+	Lazy               []models.DeviceAttribute `json:"lazy"`
+	StaticAttributes   []models.DeviceAttribute `json:"static_attributes"`
+	Commands           []models.DeviceCommand   `json:"commands"`
+	ExpressionLanguage string                   `json:"expressionLanguage,omitempty"`
+	EntityNameExp      string                   `json:"entityNameExp,omitempty"`
+	PayloadType        string                   `json:"PayloadType,omitempty"`
+	AutoProvision      bool                     `json:"autoprovision"`
+}
+
+// deviceUpdate holds the fields of a device that can be updated.
+// DeviceId and protocol identify the device and go in the URL.
+type deviceUpdate struct {
+	EntityName         string                   `json:"entity_name,omitempty"`
+	EntityType         string                   `json:"entity_type,omitempty"`
+	Polling            *bool                    `json:"polling,omitempty"`
+	Transport          string                   `json:"transport,omitempty"`
+	Timestamp          *bool                    `json:"timestamp,omitempty"`
+	Endpoint           string                   `json:"endpoint,omitempty"`
+	Attributes         []models.DeviceAttribute `json:"attributes"`
+	Lazy               []models.DeviceAttribute `json:"lazy"`
+	Commands           []models.DeviceCommand   `json:"commands"`
+	StaticAttributes   []models.DeviceAttribute `json:"static_attributes"`
+	ExpressionLanguage string                   `json:"expressionLanguage,omitempty"`
+	ExplicitAttrs      json.RawMessage          `json:"explicitAttrs,omitempty"`
+}
+
+// emptyIfNil avoids sending null lists, so that a missing list in the
+// manifest clears the list in the IoT Agent.
+func emptyIfNil[T any](items []T) []T {
+	if items == nil {
+		return []T{}
+	}
+	return items
+}
+
+// UpdateServices sends a PUT request for a set of Services, with only
+// the mutable fields. Returns the list of Services that were not found.
+func (i *Iotam) UpdateServices(client keystone.HTTPClient, headers http.Header, services []models.DeviceGroup) ([]models.DeviceGroup, error) {
+	var (
+		errList  []error
+		notFound []models.DeviceGroup
+	)
+	for _, service := range services {
+		if service.Resource == "" || service.APIKey == "" || service.Protocol == "" {
+			return nil, errors.New("All devices must have protocol, resource and apikey")
+		}
+		path, err := i.URL.Parse("iot/services")
+		if err != nil {
+			return nil, err
+		}
+		query := path.Query()
+		query.Add("resource", service.Resource)
+		query.Add("apikey", service.APIKey)
+		query.Add("protocol", service.Protocol)
+		path.RawQuery = query.Encode()
+		request := serviceUpdate{
+			EntityType:         service.EntityType,
+			Description:        service.Description,
+			Transport:          service.Transport,
+			Timestamp:          service.Timestamp,
+			ExplicitAttrs:      service.ExplicitAttrs,
+			InternalAttributes: emptyIfNil(service.InternalAttributes),
+			Attributes:         emptyIfNil(service.Attributes),
+			Lazy:               emptyIfNil(service.Lazy),
+			StaticAttributes:   emptyIfNil(service.StaticAttributes),
+			Commands:           emptyIfNil(service.Commands),
+			ExpressionLanguage: service.ExpressionLanguage,
+			EntityNameExp:      service.EntityNameExp,
+			PayloadType:        service.PayloadType,
+			AutoProvision:      service.AutoProvision,
+		}
+		if _, _, err := keystone.PutJSON(client, headers, path, request); err != nil {
+			var netErr keystone.NetError
+			if errors.As(err, &netErr) && netErr.StatusCode == http.StatusNotFound {
+				notFound = append(notFound, service)
+			} else {
+				errList = append(errList, err)
+			}
+		}
+	}
+	return notFound, errors.Join(errList...)
+}
+
+// UpdateDevices sends a PUT request for a set of Devices, with only
+// the mutable fields. Returns the list of Devices that were not found.
+func (i *Iotam) UpdateDevices(client keystone.HTTPClient, headers http.Header, devices []models.Device) ([]models.Device, error) {
+	var (
+		errList  []error
+		notFound []models.Device
+	)
+	for _, device := range devices {
+		if device.DeviceId == "" || device.Protocol == "" {
+			return nil, errors.New("All devices must have a deviceId and protocol")
+		}
+		path, err := i.protocolURL(fmt.Sprintf("iot/devices/%s", device.DeviceId), device.Protocol)
+		if err != nil {
+			return nil, err
+		}
+		request := deviceUpdate{
+			EntityName:         device.EntityName,
+			EntityType:         device.EntityType,
+			Polling:            device.Polling,
+			Transport:          device.Transport,
+			Timestamp:          device.Timestamp,
+			Endpoint:           device.Endpoint,
+			Attributes:         emptyIfNil(device.Attributes),
+			Lazy:               emptyIfNil(device.Lazy),
+			Commands:           emptyIfNil(device.Commands),
+			StaticAttributes:   emptyIfNil(device.StaticAttributes),
+			ExpressionLanguage: device.ExpressionLanguage,
+			ExplicitAttrs:      device.ExplicitAttrs,
+		}
+		if _, _, err := keystone.PutJSON(client, headers, path, request); err != nil {
+			var netErr keystone.NetError
+			if errors.As(err, &netErr) && netErr.StatusCode == http.StatusNotFound {
+				notFound = append(notFound, device)
+			} else {
+				errList = append(errList, err)
+			}
+		}
+	}
+	return notFound, errors.Join(errList...)
+}
+
 func groupResources[R any](resources []R, indexFunc func(R) string) (map[string][]R, error) {
 	resourceMap := make(map[string][]R)
 	for _, res := range resources {
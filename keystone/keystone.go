@@ -10,6 +10,7 @@ import (
 	"math"
 	"net/http"
 	"net/url"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -146,51 +147,121 @@ func (l ExponentialBackoff) KeepTrying(retries int) (bool, time.Duration) {
 	return (retries < l.MaxRetries), targetDelay
 }
 
+// RetryPolicy is implemented by HTTPClients that want Query and Update
+// to retry failed requests with the given Backoff. Only idempotent
+// requests are retried, when the connection fails or the server
+// replies with a 429 or 5xx status code.
+type RetryPolicy interface {
+	Backoff() Backoff
+}
+
+// idempotent is true for the methods that can be safely retried
+func idempotent(method string) bool {
+	switch method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// retryable is true for connection errors, 429 and 5xx replies
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
+
+// do sends the request, retrying according to the client's RetryPolicy.
+// The body is provided separately so that it can be sent again.
+func do(client HTTPClient, req *http.Request, body []byte) (*http.Response, error) {
+	var backoff Backoff
+	if policy, ok := client.(RetryPolicy); ok && idempotent(req.Method) {
+		backoff = policy.Backoff()
+	}
+	for current := 0; ; current++ {
+		if len(body) > 0 {
+			req.Body = io.NopCloser(bytes.NewReader(body))
+		}
+		resp, err := client.Do(req)
+		if backoff == nil || !retryable(resp, err) {
+			return resp, err
+		}
+		retry, delay := backoff.KeepTrying(current)
+		if !retry {
+			return resp, err
+		}
+		if err != nil {
+			log.Printf("%s request to %s failed (%v), retrying in %s", req.Method, req.URL, err, delay)
+		} else {
+			log.Printf("%s request to %s failed with code %d, retrying in %s", req.Method, req.URL, resp.StatusCode, delay)
+		}
+		Exhaust(resp)
+		<-time.After(delay)
+	}
+}
+
 // Just enough model of the auth response to get to the user id
+// and token expiration
 type authReply struct {
 	Token struct {
 		User struct {
 			Id string `json:"id"`
 		} `json:"user"`
+		ExpiresAt string `json:"expires_at"`
 	} `json:"token"`
 }
 
 // Login into the Context Broker, get a session token
 func (o *Keystone) Login(client HTTPClient, password string, retries Backoff) (string, string, error) {
+	token, userId, _, err := o.LoginWithExpiry(client, password, retries)
+	return token, userId, err
+}
+
+// LoginWithExpiry logs into the Context Broker, and returns the session
+// token, the user id and the token expiration time. The expiration time
+// is zero if keystone did not report it.
+func (o *Keystone) LoginWithExpiry(client HTTPClient, password string, retries Backoff) (string, string, time.Time, error) {
 	payload := fmt.Sprintf(
 		`{"auth": {"identity": {"methods": ["password"], "password": {"user": {"domain": {"name": %q}, "name": %q, "password": %q}}}, "scope": {"domain": {"name": %q}}}}`,
 		o.Service, o.Username, password, o.Service,
 	)
 	loginURL, err := o.URL.Parse("/v3/auth/tokens")
 	if err != nil {
-		return "", "", err
+		return "", "", time.Time{}, err
 	}
 	var current int
 	for {
 		header, body, err := PostJSON(client, nil, loginURL, payload)
 		if err == nil {
 			var (
-				reply  authReply
-				userId string
+				reply     authReply
+				userId    string
+				expiresAt time.Time
 			)
 			if err := json.Unmarshal(body, &reply); err != nil {
 				log.Printf("Failed to parse auth reply, will not propagate user id: %s", err)
 			} else {
 				userId = reply.Token.User.Id
+				if reply.Token.ExpiresAt != "" {
+					if expiresAt, err = time.Parse(time.RFC3339Nano, reply.Token.ExpiresAt); err != nil {
+						log.Printf("Failed to parse token expiration %q: %s", reply.Token.ExpiresAt, err)
+					}
+				}
 			}
-			return header.Get("X-Subject-Token"), userId, nil
+			return header.Get("X-Subject-Token"), userId, expiresAt, nil
 		}
 		// retry errors 500
 		var netErr NetError
 		if errors.As(err, &netErr) {
 			if netErr.StatusCode != 500 {
-				return "", "", err
+				return "", "", time.Time{}, err
 			}
 		}
 		retry, delay := retries.KeepTrying(current)
 		current += 1
 		if !retry {
-			return "", "", err
+			return "", "", time.Time{}, err
 		}
 		<-time.After(delay)
 	}
@@ -323,7 +394,7 @@ func Query(client HTTPClient, method string, headers http.Header, path *url.URL,
 		URL:    path,
 		Method: method,
 	}
-	resp, err := client.Do(req)
+	resp, err := do(client, req, nil)
 	defer Exhaust(resp)
 	if err != nil {
 		return nil, newNetError(req, nil, err)
@@ -387,10 +458,7 @@ func Update(client HTTPClient, method string, headers http.Header, path *url.URL
 		Method:        method,
 		ContentLength: int64(len(dataBytes)),
 	}
-	if len(dataBytes) > 0 {
-		req.Body = io.NopCloser(bytes.NewReader(dataBytes))
-	}
-	resp, err := client.Do(req)
+	resp, err := do(client, req, dataBytes)
 	defer Exhaust(resp)
 
 	// Manage response
@@ -954,6 +1022,43 @@ func (k *Keystone) assignments(client HTTPClient, headers http.Header, domain, p
 	return result, nil
 }
 
+// errMissingID is returned by assignmentURL when the role or actor ID is empty
+var errMissingID = errors.New("assignment without role or actor id")
+
+// assignmentURL returns the URL to grant or revoke the role assignment,
+// to the user or group, in the given domain.
+func (k *Keystone) assignmentURL(domID string, assign models.RoleAssignment) (*url.URL, error) {
+	actor, actorID := "users", assign.User.ID
+	if actorID == "" && assign.Group.ID != "" {
+		actor, actorID = "groups", assign.Group.ID
+	}
+	if actorID == "" || assign.Role.ID == "" {
+		return nil, errMissingID
+	}
+	switch {
+	case assign.Inherited == "projects":
+		if assign.DomainID == "" {
+			return nil, fmt.Errorf("don't know how to handle inherit to non-domain %s", assign.ScopeName)
+		}
+		return k.URL.Parse(fmt.Sprintf("/v3/OS-INHERIT/domains/%s/%s/%s/roles/%s/inherited_to_projects", domID, actor, actorID, assign.Role.ID))
+	case assign.Inherited != "":
+		return nil, fmt.Errorf("don't know how to handle inherited role %s", assign.Inherited)
+	case assign.ProjectID != "":
+		return k.URL.Parse(fmt.Sprintf("/v3/projects/%s/%s/%s/roles/%s", assign.ProjectID, actor, actorID, assign.Role.ID))
+	case assign.DomainID != "":
+		return k.URL.Parse(fmt.Sprintf("/v3/domains/%s/%s/%s/roles/%s", domID, actor, actorID, assign.Role.ID))
+	}
+	return nil, fmt.Errorf("don't know how to handle assignment at scope %s", assign.ScopeName)
+}
+
+// actorName returns the name of the user or group in the assignment
+func actorName(assign models.RoleAssignment) string {
+	if assign.User.ID == "" && assign.User.Name == "" {
+		return "group " + assign.Group.Name
+	}
+	return "usr " + assign.User.Name
+}
+
 func (k *Keystone) PostAssignments(client HTTPClient, headers http.Header, assignments []models.RoleAssignment) error {
 	_, domId, err := k.MyDomain(client, headers)
 	if err != nil {
@@ -961,36 +1066,266 @@ func (k *Keystone) PostAssignments(client HTTPClient, headers http.Header, assig
 	}
 	errList := make([]error, 0, 16)
 	for _, assign := range assignments {
-		var (
-			urlCreate *url.URL
-			assignErr error
-		)
-		if assign.Inherited == "projects" {
-			if assign.DomainID == "" {
-				assignErr = fmt.Errorf("don't know how to handle inherit to non-domain %s", assign.ScopeName)
-			} else {
-				urlCreate, assignErr = k.URL.Parse(fmt.Sprintf("/v3/OS-INHERIT/domains/%s/users/%s/roles/%s/inherited_to_projects", domId, assign.User.ID, assign.Role.ID))
+		urlCreate, err := k.assignmentURL(domId, assign)
+		if err == nil {
+			_, _, err = PutJSON(client, headers, urlCreate, nil)
+		}
+		if err != nil {
+			errList = append(errList, fmt.Errorf("while assigning role %s to %s at scope %s: %w", assign.Role.Name, actorName(assign), assign.ScopeName, err))
+		}
+	}
+	if len(errList) > 0 {
+		return errors.Join(errList...)
+	}
+	return nil
+}
+
+// isNotFound is true if the request failed with 404
+func isNotFound(err error) bool {
+	var netErr NetError
+	return errors.As(err, &netErr) && netErr.StatusCode == http.StatusNotFound
+}
+
+type keystoneNames struct {
+	Links    json.RawMessage       `json:"links,omitempty"`
+	Users    []models.AssignmentID `json:"users,omitempty"`
+	Groups   []models.AssignmentID `json:"groups,omitempty"`
+	Projects []models.AssignmentID `json:"projects,omitempty"`
+}
+
+// nameIndex finds the IDs of the users, groups, projects and roles
+// of a domain by name. Each kind of resource is listed only once,
+// the first time it is needed.
+type nameIndex struct {
+	k       *Keystone
+	client  HTTPClient
+	headers http.Header
+	domName string
+	domID   string
+	ids     map[string]map[string]string // by kind, then name
+}
+
+func (k *Keystone) newNameIndex(client HTTPClient, headers http.Header) (*nameIndex, error) {
+	domName, domID, err := k.MyDomain(client, headers)
+	if err != nil {
+		return nil, err
+	}
+	return &nameIndex{
+		k:       k,
+		client:  client,
+		headers: headers,
+		domName: domName,
+		domID:   domID,
+		ids:     make(map[string]map[string]string),
+	}, nil
+}
+
+// id returns the ID of the resource of the given kind ("users", "groups",
+// "projects" or "roles") with the given name, or "" if not found.
+func (n *nameIndex) id(kind, name string) (string, error) {
+	ids, ok := n.ids[kind]
+	if !ok {
+		ids = make(map[string]string)
+		if kind == "roles" {
+			roles, err := n.k.nativeRoles(n.client, n.headers, n.domName, n.domID)
+			if err != nil {
+				return "", err
+			}
+			for _, role := range roles {
+				ids[role.Name] = role.ID
 			}
 		} else {
-			if assign.Inherited == "" {
-				if assign.DomainID != "" {
-					urlCreate, assignErr = k.URL.Parse(fmt.Sprintf("/v3/domains/%s/users/%s/roles/%s", domId, assign.User.ID, assign.Role.ID))
-				} else {
-					if assign.ProjectID != "" {
-						urlCreate, assignErr = k.URL.Parse(fmt.Sprintf("/v3/projects/%s/users/%s/roles/%s", assign.ProjectID, assign.User.ID, assign.Role.ID))
-					} else {
-						assignErr = fmt.Errorf("don't know how to handle assignment at scope %s", assign.ScopeName)
-					}
-				}
+			urlList, err := n.k.URL.Parse(fmt.Sprintf("/v3/%s?domain_id=%s", kind, n.domID))
+			if err != nil {
+				return "", err
+			}
+			var names keystoneNames
+			if _, err := Query(n.client, http.MethodGet, n.headers, urlList, &names, true); err != nil {
+				return "", err
+			}
+			for _, item := range slices.Concat(names.Users, names.Groups, names.Projects) {
+				ids[item.Name] = item.ID
+			}
+		}
+		n.ids[kind] = ids
+	}
+	return ids[name], nil
+}
+
+// deleteID deletes the user, group or project with the given ID
+func (k *Keystone) deleteID(client HTTPClient, headers http.Header, kind, id string) error {
+	urlDelete, err := k.URL.Parse(fmt.Sprintf("/v3/%s/%s", kind, id))
+	if err != nil {
+		return err
+	}
+	if kind == "projects" {
+		// Projects must be disabled before they can be deleted
+		disable := map[string]map[string]bool{"project": {"enabled": false}}
+		if _, _, err := Update(client, http.MethodPatch, headers, urlDelete, disable); err != nil {
+			return err
+		}
+	}
+	_, err = Query(client, http.MethodDelete, headers, urlDelete, nil, true)
+	return err
+}
+
+// deleteResources deletes the users, groups or projects (kind) by ID.
+// Items without ID are matched by name. Items with an ID that is not
+// found are skipped, and never matched by name: the ID may come from
+// another environment, where the same name is a different resource.
+// Items that cannot be found by name are skipped too.
+func (k *Keystone) deleteResources(client HTTPClient, headers http.Header, kind string, items []models.AssignmentID) error {
+	names, err := k.newNameIndex(client, headers)
+	if err != nil {
+		return err
+	}
+	singular := strings.TrimSuffix(kind, "s")
+	errList := make([]error, 0, len(items))
+	for _, item := range items {
+		if item.ID != "" {
+			err := k.deleteID(client, headers, kind, item.ID)
+			if err == nil {
+				continue
+			}
+			if isNotFound(err) {
+				log.Printf("%s %s with id %s not found, skipping", singular, item.Name, item.ID)
 			} else {
-				assignErr = fmt.Errorf("don't know how to handle inherited role %s", assign.Inherited)
+				errList = append(errList, fmt.Errorf("while deleting %s %s: %w", kind, item.ID, err))
 			}
+			continue
 		}
-		if assignErr != nil {
-			errList = append(errList, fmt.Errorf("while assigning role %s to usr %s at scope %s: %w", assign.Role.Name, assign.User.Name, assign.ScopeName, assignErr))
-		} else {
-			if _, _, err := PutJSON(client, headers, urlCreate, nil); err != nil {
-				errList = append(errList, fmt.Errorf("while assigning role %s to usr %s at scope %s: %w", assign.Role.Name, assign.User.Name, assign.ScopeName, err))
+		if item.Name == "" {
+			errList = append(errList, fmt.Errorf("while deleting %s: either id or name is required", kind))
+			continue
+		}
+		id, err := names.id(kind, item.Name)
+		if err != nil {
+			errList = append(errList, fmt.Errorf("while listing %s: %w", kind, err))
+			break
+		}
+		if id == "" {
+			log.Printf("%s %s not found, skipping", singular, item.Name)
+			continue
+		}
+		if err := k.deleteID(client, headers, kind, id); err != nil {
+			errList = append(errList, fmt.Errorf("while deleting %s %s: %w", kind, item.Name, err))
+		}
+	}
+	if len(errList) > 0 {
+		return errors.Join(errList...)
+	}
+	return nil
+}
+
+// DeleteUsers deletes the users by ID, or by name if they have no ID
+func (k *Keystone) DeleteUsers(client HTTPClient, headers http.Header, users []models.User) error {
+	items := make([]models.AssignmentID, 0, len(users))
+	for _, user := range users {
+		items = append(items, models.AssignmentID{ID: user.ID, Name: user.Name})
+	}
+	return k.deleteResources(client, headers, "users", items)
+}
+
+// DeleteGroups deletes the groups by ID, or by name if they have no ID
+func (k *Keystone) DeleteGroups(client HTTPClient, headers http.Header, groups []models.Group) error {
+	items := make([]models.AssignmentID, 0, len(groups))
+	for _, group := range groups {
+		items = append(items, models.AssignmentID{ID: group.ID, Name: group.Name})
+	}
+	return k.deleteResources(client, headers, "groups", items)
+}
+
+// DeleteProjects deletes the projects by ID, or by name if they have no ID.
+// Projects that are domains are skipped.
+func (k *Keystone) DeleteProjects(client HTTPClient, headers http.Header, projects []models.Project) error {
+	items := make([]models.AssignmentID, 0, len(projects))
+	for _, proj := range projects {
+		if !proj.IsDomain {
+			items = append(items, models.AssignmentID{ID: proj.ID, Name: proj.Name})
+		}
+	}
+	return k.deleteResources(client, headers, "projects", items)
+}
+
+// resolve replaces the IDs of the role, actor and project in the
+// assignment with the IDs of the resources with the same names.
+// Returns false if some of them is not found, or no ID changed.
+func (n *nameIndex) resolve(assign models.RoleAssignment) (models.RoleAssignment, bool, error) {
+	type lookup struct {
+		kind string
+		name string
+		id   *string
+	}
+	lookups := []lookup{
+		{kind: "roles", name: assign.Role.Name, id: &assign.Role.ID},
+		{kind: "users", name: assign.User.Name, id: &assign.User.ID},
+		{kind: "groups", name: assign.Group.Name, id: &assign.Group.ID},
+	}
+	if assign.ProjectID != "" {
+		lookups = append(lookups, lookup{kind: "projects", name: assign.ScopeName, id: &assign.ProjectID})
+	}
+	changed := false
+	for _, current := range lookups {
+		if current.name == "" {
+			continue
+		}
+		id, err := n.id(current.kind, current.name)
+		if err != nil {
+			return assign, false, fmt.Errorf("while listing %s: %w", current.kind, err)
+		}
+		if id == "" {
+			return assign, false, nil
+		}
+		if id != *current.id {
+			*current.id = id
+			changed = true
+		}
+	}
+	return assign, changed, nil
+}
+
+// DeleteAssignments revokes the role assignments of users or groups.
+// If the assignment lacks some ID, or the IDs are not found, the role,
+// actor and project are matched by name. Assignments that cannot be
+// found by name are skipped.
+func (k *Keystone) DeleteAssignments(client HTTPClient, headers http.Header, assignments []models.RoleAssignment) error {
+	names, err := k.newNameIndex(client, headers)
+	if err != nil {
+		return err
+	}
+	revoke := func(assign models.RoleAssignment) error {
+		urlDelete, err := k.assignmentURL(names.domID, assign)
+		if err != nil {
+			return err
+		}
+		_, err = Query(client, http.MethodDelete, headers, urlDelete, nil, true)
+		return err
+	}
+	errList := make([]error, 0, 16)
+	for _, assign := range assignments {
+		label := fmt.Sprintf("role %s from %s at scope %s", assign.Role.Name, actorName(assign), assign.ScopeName)
+		err := revoke(assign)
+		if err == nil {
+			continue
+		}
+		if !isNotFound(err) && !errors.Is(err, errMissingID) {
+			errList = append(errList, fmt.Errorf("while revoking %s: %w", label, err))
+			continue
+		}
+		resolved, changed, err := names.resolve(assign)
+		if err != nil {
+			errList = append(errList, err)
+			break
+		}
+		if !changed {
+			log.Printf("%s not found, skipping", label)
+			continue
+		}
+		if err := revoke(resolved); err != nil {
+			if isNotFound(err) {
+				log.Printf("%s not found, skipping", label)
+			} else {
+				errList = append(errList, fmt.Errorf("while revoking %s: %w", label, err))
 			}
 		}
 	}
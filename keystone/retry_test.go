@@ -0,0 +1,132 @@
+package keystone
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+// retryClient retries with a lineal backoff and no delay
+type retryClient struct {
+	retries int
+}
+
+func (rc retryClient) Do(req *http.Request) (*http.Response, error) {
+	return http.DefaultClient.Do(req)
+}
+
+func (rc retryClient) Backoff() Backoff {
+	return LinealBackoff{MaxRetries: rc.retries}
+}
+
+// flakyServer fails the first requests with the given status code.
+// Returns the server URL and a function to read the requests received.
+func flakyServer(t *testing.T, failures, statusCode int) (*url.URL, func() []string) {
+	t.Helper()
+	var (
+		mu     sync.Mutex
+		bodies []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(body))
+		count := len(bodies)
+		mu.Unlock()
+		if count <= failures {
+			w.WriteHeader(statusCode)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	t.Cleanup(server.Close)
+	u, err := url.Parse(server.URL + "/v2/entities")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), bodies...)
+	}
+}
+
+func TestQueryRetries(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		client     HTTPClient
+		failures   int
+		statusCode int
+		requests   int
+		fails      bool
+	}{
+		{name: "retried until success", client: retryClient{retries: 3}, failures: 2, statusCode: http.StatusServiceUnavailable, requests: 3},
+		{name: "too many requests", client: retryClient{retries: 3}, failures: 1, statusCode: http.StatusTooManyRequests, requests: 2},
+		{name: "retries exhausted", client: retryClient{retries: 2}, failures: 5, statusCode: http.StatusBadGateway, requests: 3, fails: true},
+		{name: "client errors not retried", client: retryClient{retries: 3}, failures: 1, statusCode: http.StatusNotFound, requests: 1, fails: true},
+		{name: "client without policy", client: http.DefaultClient, failures: 1, statusCode: http.StatusServiceUnavailable, requests: 1, fails: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path, received := flakyServer(t, tc.failures, tc.statusCode)
+			var reply struct {
+				OK bool `json:"ok"`
+			}
+			_, err := Query(tc.client, http.MethodGet, http.Header{}, path, &reply, true)
+			if (err != nil) != tc.fails {
+				t.Errorf("expected failure %v, got %v", tc.fails, err)
+			}
+			if !tc.fails && !reply.OK {
+				t.Error("expected the reply of the last request")
+			}
+			if got := len(received()); got != tc.requests {
+				t.Errorf("expected %d requests, got %d", tc.requests, got)
+			}
+		})
+	}
+}
+
+func TestUpdateRetries(t *testing.T) {
+	payload := map[string]string{"id": "s1"}
+
+	// Idempotent requests are sent again with the same body
+	path, received := flakyServer(t, 1, http.StatusServiceUnavailable)
+	if _, _, err := Update(retryClient{retries: 3}, http.MethodPut, http.Header{}, path, payload); err != nil {
+		t.Fatal(err)
+	}
+	bodies := received()
+	if len(bodies) != 2 || bodies[0] != bodies[1] || bodies[1] != `{"id":"s1"}` {
+		t.Errorf("expected the body to be sent twice, got %q", bodies)
+	}
+
+	// POST is not idempotent, so it must not be retried
+	path, received = flakyServer(t, 1, http.StatusServiceUnavailable)
+	if _, _, err := Update(retryClient{retries: 3}, http.MethodPost, http.Header{}, path, payload); err == nil {
+		t.Error("expected the POST to fail")
+	}
+	if got := len(received()); got != 1 {
+		t.Errorf("expected a single POST, got %d", got)
+	}
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	backoff := ExponentialBackoff{
+		MaxRetries:   3,
+		InitialDelay: time.Second,
+		DelayFactor:  2,
+		MaxDelay:     3 * time.Second,
+	}
+	for retries, want := range []time.Duration{time.Second, 2 * time.Second, 3 * time.Second} {
+		keep, delay := backoff.KeepTrying(retries)
+		if !keep || delay != want {
+			t.Errorf("retry %d: expected %s, got %v %s", retries, want, keep, delay)
+		}
+	}
+	if keep, _ := backoff.KeepTrying(3); keep {
+		t.Error("expected to stop after MaxRetries")
+	}
+}
@@ -0,0 +1,680 @@
+package orion
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/warpcomdev/fiware/keystone"
+	"github.com/warpcomdev/fiware/models"
+)
+
+// NGSI dialects spoken by the Context Broker
+const (
+	NGSIv2 = "v2"
+	NGSILD = "ld"
+)
+
+// DefaultLDContext is the @context used when none is configured
+const DefaultLDContext = "https://uri.etsi.org/ngsi-ld/v1/ngsi-ld-core-context.jsonld"
+
+// NewDialect creates an Orion client for the given NGSI dialect ("v2" or
+// "ld", empty means "v2"). ldContext is the @context used to expand and
+// compact attribute names in NGSI-LD, DefaultLDContext if empty.
+//
+// NGSI-LD brokers are read and written in NGSI-LD, but all the methods
+// take and return NGSIv2 entities and subscriptions, so the rest of the
+// application does not need to care about the dialect.
+func NewDialect(orionURL, dialect, ldContext string) (*Orion, error) {
+	o, err := New(orionURL)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(dialect) {
+	case "", NGSIv2:
+	case NGSILD:
+		o.LD = true
+		o.LDContext = ldContext
+		if o.LDContext == "" {
+			o.LDContext = DefaultLDContext
+		}
+	default:
+		return nil, fmt.Errorf("unknown NGSI dialect %q, must be %s or %s", dialect, NGSIv2, NGSILD)
+	}
+	return o, nil
+}
+
+// ldHeaders adds the @context Link header to the request headers
+func (o *Orion) ldHeaders(headers http.Header) http.Header {
+	var result http.Header
+	if headers == nil {
+		result = make(http.Header)
+	} else {
+		result = headers.Clone()
+	}
+	result.Set("Link", fmt.Sprintf(`<%s>; rel="http://www.w3.org/ns/json-ld#context"; type="application/ld+json"`, o.LDContext))
+	result.Set("Accept", "application/json")
+	return result
+}
+
+// headers returns the request headers for the dialect of the broker
+func (o *Orion) headers(headers http.Header) http.Header {
+	if o.LD {
+		return o.ldHeaders(headers)
+	}
+	return headers
+}
+
+// getPaginatedLD is the NGSI-LD version of keystone.GetPaginatedJSON, which
+// counts with count=true and the NGSILD-Results-Count header. LD payloads
+// carry many broker specific fields, so unknown fields are always allowed.
+func (o *Orion) getPaginatedLD(client keystone.HTTPClient, headers http.Header, path *url.URL, p keystone.Paginator, maximum int) error {
+	headers = o.ldHeaders(headers)
+	offset, limit, total := 0, 50, 50
+	for offset < total {
+		if total > 2*limit {
+			log.Printf("Getting %d items of %d at offset %d", limit, total, offset)
+		}
+		limitedURL := *path // make a copy
+		values := limitedURL.Query()
+		values.Set("offset", strconv.Itoa(offset))
+		values.Set("limit", strconv.Itoa(min(total-offset, limit)))
+		values.Set("count", "true")
+		limitedURL.RawQuery = values.Encode()
+		var data []json.RawMessage
+		header, err := keystone.Query(client, http.MethodGet, headers, &limitedURL, &data, true)
+		if err != nil {
+			return err
+		}
+		if total, err = strconv.Atoi(header.Get("NGSILD-Results-Count")); err != nil {
+			return fmt.Errorf("invalid NGSILD-Results-Count header: %w", err)
+		}
+		for _, raw := range data {
+			if err := p.Append(raw, true); err != nil {
+				return err
+			}
+		}
+		if len(data) <= 0 {
+			break
+		}
+		offset += len(data)
+		if maximum > 0 && total > maximum {
+			total = maximum
+		}
+	}
+	return nil
+}
+
+// ldEntityID turns an NGSIv2 entity id into the URN required by NGSI-LD.
+// ids that already look like URIs are kept.
+func ldEntityID(entityType, id string) string {
+	if strings.Contains(id, ":") {
+		return id
+	}
+	return fmt.Sprintf("urn:ngsi-ld:%s:%s", entityType, id)
+}
+
+// v2EntityID reverses ldEntityID
+func v2EntityID(entityType, id string) string {
+	if short, ok := strings.CutPrefix(id, fmt.Sprintf("urn:ngsi-ld:%s:", entityType)); ok && !strings.Contains(short, ":") {
+		return short
+	}
+	return id
+}
+
+// entityID returns the id of the entity as the broker knows it
+func (o *Orion) entityID(entityType, id string) string {
+	if o.LD {
+		return ldEntityID(entityType, id)
+	}
+	return id
+}
+
+// ldValueType guesses the NGSIv2 attribute type of a Property value
+func ldValueType(value json.RawMessage) (string, json.RawMessage) {
+	trimmed := bytes.TrimSpace(value)
+	if len(trimmed) <= 0 {
+		return "None", json.RawMessage("null")
+	}
+	switch trimmed[0] {
+	case '"':
+		return "Text", value
+	case '{':
+		var dateTime struct {
+			Type  string          `json:"@type"`
+			Value json.RawMessage `json:"@value"`
+		}
+		if json.Unmarshal(trimmed, &dateTime) == nil && dateTime.Type == "DateTime" {
+			return "DateTime", dateTime.Value
+		}
+		return "StructuredValue", value
+	case '[':
+		return "StructuredValue", value
+	case 't', 'f':
+		return "Boolean", value
+	case 'n':
+		return "None", value
+	default:
+		return "Number", value
+	}
+}
+
+// fromLDAttr turns an NGSI-LD Property, Relationship or GeoProperty into
+// an NGSIv2 attribute. Sub-properties become metadata.
+func fromLDAttr(raw json.RawMessage) (EntityAttr, error) {
+	var attr EntityAttr
+	// Attributes with several instances are lists,
+	// keep the default one (without datasetId).
+	if trimmed := bytes.TrimSpace(raw); len(trimmed) > 0 && trimmed[0] == '[' {
+		var instances []map[string]json.RawMessage
+		if err := json.Unmarshal(trimmed, &instances); err != nil {
+			return attr, err
+		}
+		if len(instances) <= 0 {
+			return attr, errors.New("empty attribute")
+		}
+		index := max(0, slices.IndexFunc(instances, func(i map[string]json.RawMessage) bool { return i["datasetId"] == nil }))
+		raw, _ = json.Marshal(instances[index])
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return attr, err
+	}
+	var kind string
+	json.Unmarshal(fields["type"], &kind)
+	switch kind {
+	case "Relationship":
+		attr.Type, attr.Value = "Relationship", fields["object"]
+	case "GeoProperty":
+		attr.Type, attr.Value = "geo:json", fields["value"]
+	case "LanguageProperty":
+		attr.Type, attr.Value = "StructuredValue", fields["languageMap"]
+	default:
+		attr.Type, attr.Value = ldValueType(fields["value"])
+	}
+	metadata := make(map[string]EntityAttr)
+	for key, sub := range fields {
+		switch key {
+		case "type", "value", "object", "languageMap", "datasetId", "instanceId", "createdAt", "modifiedAt":
+			continue
+		case "observedAt":
+			metadata[key] = EntityAttr{Type: "DateTime", Value: sub}
+		case "unitCode":
+			metadata[key] = EntityAttr{Type: "Text", Value: sub}
+		default:
+			md, err := fromLDAttr(sub)
+			if err != nil {
+				return attr, fmt.Errorf("while reading sub-property %s: %w", key, err)
+			}
+			md.Metadata = nil // metadata cannot be nested in NGSIv2
+			metadata[key] = md
+		}
+	}
+	if len(metadata) > 0 {
+		attr.Metadata, _ = json.Marshal(metadata)
+	}
+	return attr, nil
+}
+
+// toLDAttr turns an NGSIv2 attribute into an NGSI-LD Property,
+// Relationship or GeoProperty. Metadata become sub-properties.
+func toLDAttr(attr EntityAttr) map[string]json.RawMessage {
+	result := make(map[string]json.RawMessage)
+	value := attr.Value
+	if value == nil {
+		value = json.RawMessage("null")
+	}
+	switch attr.Type {
+	case "Relationship":
+		result["type"], result["object"] = json.RawMessage(`"Relationship"`), value
+	case "geo:json":
+		result["type"], result["value"] = json.RawMessage(`"GeoProperty"`), value
+	case "DateTime":
+		result["type"] = json.RawMessage(`"Property"`)
+		result["value"], _ = json.Marshal(map[string]json.RawMessage{
+			"@type":  json.RawMessage(`"DateTime"`),
+			"@value": value,
+		})
+	default:
+		result["type"], result["value"] = json.RawMessage(`"Property"`), value
+	}
+	var metadata map[string]EntityAttr
+	if len(attr.Metadata) > 0 && json.Unmarshal(attr.Metadata, &metadata) == nil {
+		for name, md := range metadata {
+			switch name {
+			case "observedAt", "unitCode":
+				result[name] = md.Value
+			default:
+				result[name], _ = json.Marshal(toLDAttr(EntityAttr{Type: md.Type, Value: md.Value}))
+			}
+		}
+	}
+	return result
+}
+
+// fromLDEntity turns an NGSI-LD entity into an NGSIv2 one
+func fromLDEntity(raw json.RawMessage) (Entity, error) {
+	var ld map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &ld); err != nil {
+		return nil, err
+	}
+	var id, entityType string
+	json.Unmarshal(ld["id"], &id)
+	json.Unmarshal(ld["type"], &entityType)
+	result := make(Entity, len(ld))
+	result["id"], _ = json.Marshal(v2EntityID(entityType, id))
+	result["type"] = ld["type"]
+	for name, value := range ld {
+		switch name {
+		case "id", "type", "@context", "createdAt", "modifiedAt", "scope":
+			continue
+		}
+		attr, err := fromLDAttr(value)
+		if err != nil {
+			return nil, fmt.Errorf("while reading attribute %s of entity %s: %w", name, id, err)
+		}
+		result[name], _ = json.Marshal(attr)
+	}
+	return result, nil
+}
+
+// toLDEntity turns an NGSIv2 entity into an NGSI-LD one
+func toLDEntity(e Entity) map[string]json.RawMessage {
+	result := make(map[string]json.RawMessage, len(e))
+	result["id"], _ = json.Marshal(ldEntityID(e.Type(), e.ID()))
+	result["type"] = e["type"]
+	for name, attr := range e.Attrs() {
+		result[name], _ = json.Marshal(toLDAttr(attr))
+	}
+	return result
+}
+
+// ldEntities is a Paginator that converts NGSI-LD entities to NGSIv2
+type ldEntities struct {
+	next keystone.Paginator
+}
+
+// Append implements Paginator
+func (p ldEntities) Append(raw json.RawMessage, allowUnknownFields bool) error {
+	ent, err := fromLDEntity(raw)
+	if err != nil {
+		return err
+	}
+	converted, err := json.Marshal(ent)
+	if err != nil {
+		return err
+	}
+	return p.next.Append(converted, allowUnknownFields)
+}
+
+// ldTypes lists the names of the entity types in the broker
+func (o *Orion) ldTypes(client keystone.HTTPClient, headers http.Header) ([]string, error) {
+	path, err := o.URL.Parse("ngsi-ld/v1/types")
+	if err != nil {
+		return nil, err
+	}
+	var types struct {
+		TypeList []string `json:"typeList"`
+	}
+	if _, err := keystone.Query(client, http.MethodGet, o.ldHeaders(headers), path, &types, true); err != nil {
+		return nil, fmt.Errorf("while reading entity types: %w", err)
+	}
+	return types.TypeList, nil
+}
+
+// queryEntities reads the entities in path, calling p.Append with each
+// one in NGSIv2 normalized format, whatever the dialect of the broker.
+func (o *Orion) queryEntities(client keystone.HTTPClient, headers http.Header, path *url.URL, p keystone.Paginator, maximum int) error {
+	if !o.LD {
+		return keystone.GetPaginatedJSON(client, headers, path, p, o.AllowUnknownFields, maximum)
+	}
+	// NGSI-LD does not allow listing entities without some filter
+	if path.Query().Get("type") == "" {
+		types, err := o.ldTypes(client, headers)
+		if err != nil {
+			return err
+		}
+		if len(types) <= 0 {
+			return nil
+		}
+		typed := *path // make a copy
+		values := typed.Query()
+		values.Set("type", strings.Join(types, ","))
+		typed.RawQuery = values.Encode()
+		path = &typed
+	}
+	return o.getPaginatedLD(client, headers, path, ldEntities{next: p}, maximum)
+}
+
+// ldAttrTypes is the NGSI-LD version of AttrTypes. NGSI-LD does not
+// keep value types, so attributes are typed by kind, and Properties
+// are reported as Text.
+func (o *Orion) ldAttrTypes(client keystone.HTTPClient, headers http.Header, entityType string) (map[string]string, error) {
+	path, err := o.URL.Parse("ngsi-ld/v1/attributes?details=true")
+	if err != nil {
+		return nil, err
+	}
+	var attrs []struct {
+		Name      string   `json:"attributeName"`
+		Types     []string `json:"attributeTypes"`
+		TypeNames []string `json:"typeNames"`
+	}
+	if _, err := keystone.Query(client, http.MethodGet, o.ldHeaders(headers), path, &attrs, true); err != nil {
+		return nil, fmt.Errorf("while reading attributes: %w", err)
+	}
+	result := make(map[string]string, len(attrs))
+	for _, attr := range attrs {
+		if entityType != "" && !slices.Contains(attr.TypeNames, entityType) {
+			continue
+		}
+		result[attr.Name] = "Text"
+		if len(attr.Types) > 0 {
+			switch attr.Types[0] {
+			case "Relationship":
+				result[attr.Name] = "Relationship"
+			case "GeoProperty":
+				result[attr.Name] = "geo:json"
+			}
+		}
+	}
+	return result, nil
+}
+
+// ldBatchErrors reads the errors in the response to an entityOperations request
+func ldBatchErrors(body []byte) error {
+	if trimmed := bytes.TrimSpace(body); len(trimmed) <= 0 || trimmed[0] != '{' {
+		return nil
+	}
+	var result struct {
+		Errors []struct {
+			EntityID string `json:"entityId"`
+			Error    struct {
+				Title  string `json:"title"`
+				Detail string `json:"detail"`
+			} `json:"error"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return err
+	}
+	var errList []error
+	for _, item := range result.Errors {
+		errList = append(errList, fmt.Errorf("entity %s: %s", item.EntityID, strings.TrimSpace(item.Error.Title+" "+item.Error.Detail)))
+	}
+	return errors.Join(errList...)
+}
+
+// ldOperation sends a request to ngsi-ld/v1/entityOperations
+func (o *Orion) ldOperation(client keystone.HTTPClient, headers http.Header, operation string, options string, body any) error {
+	path, err := o.URL.Parse("ngsi-ld/v1/entityOperations/" + operation)
+	if err != nil {
+		return err
+	}
+	if options != "" {
+		values := path.Query()
+		values.Add("options", options)
+		path.RawQuery = values.Encode()
+	}
+	_, response, err := keystone.Update(client, http.MethodPost, o.ldHeaders(headers), path, body)
+	if err != nil {
+		return err
+	}
+	return ldBatchErrors(response)
+}
+
+// ldUpdateBatch is the NGSI-LD version of updateBatch. The actionTypes
+// are mapped to the closest entity operation:
+//
+//   - append: upsert, updating the existing attributes.
+//   - appendStrict: create, fails if the entity already exists.
+//   - update: update, fails if the entity does not exist.
+//   - replace: upsert, replacing all the attributes.
+func (o *Orion) ldUpdateBatch(client keystone.HTTPClient, headers http.Header, ents []Entity, mode UpdateMode) error {
+	body := make([]map[string]json.RawMessage, 0, len(ents))
+	for _, ent := range ents {
+		body = append(body, toLDEntity(ent))
+	}
+	switch mode {
+	case ModeAppend:
+		return o.ldOperation(client, headers, "upsert", "update", body)
+	case ModeAppendStrict:
+		return o.ldOperation(client, headers, "create", "", body)
+	case ModeUpdate:
+		return o.ldOperation(client, headers, "update", "", body)
+	case ModeReplace:
+		return o.ldOperation(client, headers, "upsert", "replace", body)
+	}
+	return fmt.Errorf("unsupported update mode %s", mode)
+}
+
+// ldDeleteAttributes is the NGSI-LD version of DeleteAttributes. There
+// is no batch operation to delete attributes in NGSI-LD, so each
+// attribute is deleted with its own request.
+func (o *Orion) ldDeleteAttributes(client keystone.HTTPClient, headers http.Header, ents []models.Entity) error {
+	var errList []error
+	for _, ent := range ents {
+		for _, name := range slices.Sorted(maps.Keys(ent.Attrs)) {
+			path, err := o.URL.Parse("ngsi-ld/v1/entities/" + url.PathEscape(ldEntityID(ent.Type, ent.ID)) + "/attrs/" + url.PathEscape(name))
+			if err != nil {
+				return err
+			}
+			if _, err := keystone.Query(client, http.MethodDelete, o.ldHeaders(headers), path, nil, false); err != nil {
+				errList = append(errList, fmt.Errorf("while deleting attribute %s of entity %s: %w", name, ent.ID, err))
+			}
+		}
+	}
+	return errors.Join(errList...)
+}
+
+// ldSubscription is a subscription in NGSI-LD format
+type ldSubscription struct {
+	ID                string                 `json:"id,omitempty"`
+	Type              string                 `json:"type"`
+	Description       string                 `json:"description,omitempty"`
+	Entities          []models.SubjectEntity `json:"entities,omitempty"`
+	WatchedAttributes []string               `json:"watchedAttributes,omitempty"`
+	Q                 string                 `json:"q,omitempty"`
+	Notification      ldNotification         `json:"notification"`
+	ExpiresAt         string                 `json:"expiresAt,omitempty"`
+	Throttling        int                    `json:"throttling,omitzero"`
+	IsActive          *bool                  `json:"isActive,omitempty"`
+	Status            string                 `json:"status,omitempty"` // read only
+}
+
+// ldNotification is the notification of an NGSI-LD subscription
+type ldNotification struct {
+	Attributes       []string   `json:"attributes,omitempty"`
+	Format           string     `json:"format,omitempty"`
+	Endpoint         ldEndpoint `json:"endpoint"`
+	TimesSent        int        `json:"timesSent,omitzero"`         // read only
+	LastNotification string     `json:"lastNotification,omitempty"` // read only
+	LastFailure      string     `json:"lastFailure,omitempty"`      // read only
+	LastSuccess      string     `json:"lastSuccess,omitempty"`      // read only
+}
+
+// ldEndpoint is the notification endpoint of an NGSI-LD subscription
+type ldEndpoint struct {
+	URI          string       `json:"uri"`
+	Accept       string       `json:"accept,omitempty"`
+	ReceiverInfo []ldKeyValue `json:"receiverInfo,omitempty"`
+}
+
+type ldKeyValue struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// fromLDSubscription turns an NGSI-LD subscription into an NGSIv2 one
+func fromLDSubscription(ld ldSubscription) models.Subscription {
+	sub := models.Subscription{
+		Description: ld.Description,
+		Status:      "active",
+		Expires:     ld.ExpiresAt,
+		Throttling:  ld.Throttling,
+		Subject: models.Subject{
+			Condition: models.SubjectCondition{
+				Attrs:      ld.WatchedAttributes,
+				Expression: models.SubjectExpression{Q: ld.Q},
+			},
+			Entities: make([]models.SubjectEntity, 0, len(ld.Entities)),
+		},
+		Notification: models.Notification{
+			Attrs:       ld.Notification.Attributes,
+			AttrsFormat: ld.Notification.Format,
+			NotificationStatus: models.NotificationStatus{
+				LastFailure:      ld.Notification.LastFailure,
+				LastNotification: ld.Notification.LastNotification,
+				LastSuccess:      ld.Notification.LastSuccess,
+				TimesSent:        ld.Notification.TimesSent,
+			},
+		},
+		SubscriptionStatus: models.SubscriptionStatus{ID: ld.ID},
+	}
+	switch {
+	case ld.Status == "expired":
+		sub.Status = "expired"
+	case ld.Status == "paused" || (ld.IsActive != nil && !*ld.IsActive):
+		sub.Status = "inactive"
+	}
+	for _, entity := range ld.Entities {
+		if entity.ID != "" {
+			entity.ID = v2EntityID(entity.Type, entity.ID)
+		}
+		sub.Subject.Entities = append(sub.Subject.Entities, entity)
+	}
+	endpoint := ld.Notification.Endpoint
+	if scheme, rest, found := strings.Cut(endpoint.URI, "://"); found && strings.HasPrefix(scheme, "mqtt") {
+		host, topic, _ := strings.Cut(rest, "/")
+		sub.Notification.MQTT = models.NotificationMQTT{URL: scheme + "://" + host, Topic: topic}
+	} else if len(endpoint.ReceiverInfo) > 0 {
+		custom := models.NotificationCustom{URL: endpoint.URI, Headers: make(map[string]string, len(endpoint.ReceiverInfo))}
+		for _, info := range endpoint.ReceiverInfo {
+			custom.Headers[info.Key] = info.Value
+		}
+		sub.Notification.HTTPCustom = custom
+	} else {
+		sub.Notification.HTTP = models.NotificationHTTP{URL: endpoint.URI}
+	}
+	return sub
+}
+
+// toLDSubscription turns an NGSIv2 subscription into an NGSI-LD one.
+// Fails if the subscription uses features NGSI-LD does not support,
+// such as custom payloads or exceptAttrs.
+func toLDSubscription(sub models.Subscription) (ldSubscription, error) {
+	ld := ldSubscription{
+		ID:                sub.ID,
+		Type:              "Subscription",
+		Description:       sub.Description,
+		Entities:          make([]models.SubjectEntity, 0, len(sub.Subject.Entities)),
+		WatchedAttributes: sub.Subject.Condition.Attrs,
+		Q:                 sub.Subject.Condition.Expression.Q,
+		ExpiresAt:         sub.Expires,
+		Throttling:        sub.Throttling,
+		Notification: ldNotification{
+			Attributes: sub.Notification.Attrs,
+			Format:     sub.Notification.AttrsFormat,
+			Endpoint:   ldEndpoint{Accept: "application/json"},
+		},
+	}
+	if sub.Status != "" {
+		active := sub.Status != "inactive"
+		ld.IsActive = &active
+	}
+	if len(sub.Notification.ExceptAttrs) > 0 {
+		return ld, fmt.Errorf("subscription %s: exceptAttrs not supported in NGSI-LD", sub.Description)
+	}
+	for _, entity := range sub.Subject.Entities {
+		if entity.ID != "" {
+			entity.ID = ldEntityID(entity.Type, entity.ID)
+		}
+		ld.Entities = append(ld.Entities, entity)
+	}
+	notification := sub.Notification
+	switch {
+	case !notification.HTTP.IsZero():
+		ld.Notification.Endpoint.URI = notification.HTTP.URL
+	case !notification.HTTPCustom.IsZero():
+		custom := notification.HTTPCustom
+		if custom.Payload != nil || custom.Json != nil || custom.NGSI != nil || len(custom.Qs) > 0 || custom.Method != "" {
+			return ld, fmt.Errorf("subscription %s: custom payloads not supported in NGSI-LD", sub.Description)
+		}
+		ld.Notification.Endpoint.URI = custom.URL
+		for _, key := range slices.Sorted(maps.Keys(custom.Headers)) {
+			ld.Notification.Endpoint.ReceiverInfo = append(ld.Notification.Endpoint.ReceiverInfo, ldKeyValue{Key: key, Value: custom.Headers[key]})
+		}
+	case !notification.MQTT.IsZero():
+		ld.Notification.Endpoint.URI = strings.TrimSuffix(notification.MQTT.URL, "/") + "/" + strings.TrimPrefix(notification.MQTT.Topic, "/")
+	default:
+		return ld, fmt.Errorf("subscription %s: notification not supported in NGSI-LD", sub.Description)
+	}
+	return ld, nil
+}
+
+// readSubscriptions reads the subscriptions in NGSIv2 format,
+// whatever the dialect of the broker.
+func (o *Orion) readSubscriptions(client keystone.HTTPClient, headers http.Header) ([]models.Subscription, error) {
+	path, err := o.subscriptionURL("")
+	if err != nil {
+		return nil, err
+	}
+	if !o.LD {
+		pages := keystone.NewPaginator(make([]models.Subscription, 0, 50))
+		if err := keystone.GetPaginatedJSON(client, headers, path, pages, o.AllowUnknownFields, 0); err != nil {
+			return nil, err
+		}
+		return pages.Slice, nil
+	}
+	pages := keystone.NewPaginator(make([]ldSubscription, 0, 50))
+	if err := o.getPaginatedLD(client, headers, path, pages, 0); err != nil {
+		return nil, err
+	}
+	result := make([]models.Subscription, 0, len(pages.Slice))
+	for _, ld := range pages.Slice {
+		result = append(result, fromLDSubscription(ld))
+	}
+	return result, nil
+}
+
+// subscriptionURL returns the URL of the subscription with the
+// given id, or of the subscriptions collection if id is empty.
+func (o *Orion) subscriptionURL(id string) (*url.URL, error) {
+	path := "v2/subscriptions"
+	if o.LD {
+		path = "ngsi-ld/v1/subscriptions"
+	}
+	if id != "" {
+		path = path + "/" + id
+	}
+	return o.URL.Parse(path)
+}
+
+// sendSubscription creates (POST) or patches (PATCH) a subscription,
+// in the dialect of the broker.
+func (o *Orion) sendSubscription(client keystone.HTTPClient, headers http.Header, method string, id string, sub models.Subscription) error {
+	path, err := o.subscriptionURL(id)
+	if err != nil {
+		return err
+	}
+	if !o.LD {
+		_, _, err = keystone.Update(client, method, headers, path, sub)
+		return err
+	}
+	ld, err := toLDSubscription(sub)
+	if err != nil {
+		return err
+	}
+	if method == http.MethodPatch {
+		ld.ID = "" // the ID must not be part of the payload
+	}
+	_, _, err = keystone.Update(client, method, o.ldHeaders(headers), path, ld)
+	return err
+}
@@ -0,0 +1,221 @@
+package orion
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/warpcomdev/fiware/internal/fakeplatform"
+	"github.com/warpcomdev/fiware/models"
+)
+
+func TestLDEntityID(t *testing.T) {
+	for _, tc := range []struct{ v2, ld string }{
+		{v2: "s1", ld: "urn:ngsi-ld:Sensor:s1"},
+		{v2: "urn:ngsi-ld:Sensor:other:s1", ld: "urn:ngsi-ld:Sensor:other:s1"},
+		{v2: "urn:ngsi-ld:Pump:p1", ld: "urn:ngsi-ld:Pump:p1"},
+	} {
+		if got := ldEntityID("Sensor", tc.v2); got != tc.ld {
+			t.Errorf("ldEntityID(%s): expected %s, got %s", tc.v2, tc.ld, got)
+		}
+		if got := v2EntityID("Sensor", tc.ld); got != tc.v2 {
+			t.Errorf("v2EntityID(%s): expected %s, got %s", tc.ld, tc.v2, got)
+		}
+	}
+}
+
+func TestFromLDEntity(t *testing.T) {
+	raw := json.RawMessage(`{
+		"id": "urn:ngsi-ld:Sensor:s1",
+		"type": "Sensor",
+		"@context": "https://uri.etsi.org/ngsi-ld/v1/ngsi-ld-core-context.jsonld",
+		"createdAt": "2024-01-01T00:00:00Z",
+		"temperature": {
+			"type": "Property", "value": 21.5,
+			"observedAt": "2024-01-01T00:00:00Z", "unitCode": "CEL",
+			"accuracy": {"type": "Property", "value": 0.1}
+		},
+		"name": {"type": "Property", "value": "sensor one"},
+		"installed": {"type": "Property", "value": {"@type": "DateTime", "@value": "2023-05-01T00:00:00Z"}},
+		"pump": {"type": "Relationship", "object": "urn:ngsi-ld:Pump:p1"},
+		"location": {"type": "GeoProperty", "value": {"type": "Point", "coordinates": [-3.7, 40.4]}},
+		"status": [
+			{"type": "Property", "value": "old", "datasetId": "urn:ngsi-ld:Dataset:old"},
+			{"type": "Property", "value": "ok"}
+		]
+	}`)
+	entity, err := fromLDEntity(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entity.ID() != "s1" || entity.Type() != "Sensor" {
+		t.Errorf("expected Sensor s1, got %s %s", entity.Type(), entity.ID())
+	}
+	attrs := entity.Attrs()
+	if len(attrs) != 6 {
+		t.Errorf("expected 6 attributes, got %v", attrs)
+	}
+	for name, want := range map[string]EntityAttr{
+		"temperature": {Type: "Number", Value: json.RawMessage(`21.5`)},
+		"name":        {Type: "Text", Value: json.RawMessage(`"sensor one"`)},
+		"installed":   {Type: "DateTime", Value: json.RawMessage(`"2023-05-01T00:00:00Z"`)},
+		"pump":        {Type: "Relationship", Value: json.RawMessage(`"urn:ngsi-ld:Pump:p1"`)},
+		"location":    {Type: "geo:json", Value: json.RawMessage(`{"type":"Point","coordinates":[-3.7,40.4]}`)},
+		"status":      {Type: "Text", Value: json.RawMessage(`"ok"`)},
+	} {
+		got := attrs[name]
+		if got.Type != want.Type || compactJSON(t, got.Value) != compactJSON(t, want.Value) {
+			t.Errorf("attribute %s: expected %s %s, got %s %s", name, want.Type, want.Value, got.Type, got.Value)
+		}
+	}
+	var metadata map[string]EntityAttr
+	if err := json.Unmarshal(attrs["temperature"].Metadata, &metadata); err != nil {
+		t.Fatal(err)
+	}
+	if metadata["unitCode"].Type != "Text" || metadata["observedAt"].Type != "DateTime" || string(metadata["accuracy"].Value) != "0.1" {
+		t.Errorf("expected sub-properties as metadata, got %+v", metadata)
+	}
+}
+
+func TestLDEntityRoundTrip(t *testing.T) {
+	entity := Entity{
+		"id":          json.RawMessage(`"s1"`),
+		"type":        json.RawMessage(`"Sensor"`),
+		"temperature": json.RawMessage(`{"type":"Number","value":20,"metadata":{"unitCode":{"type":"Text","value":"CEL"}}}`),
+		"updated":     json.RawMessage(`{"type":"DateTime","value":"2024-01-01T00:00:00Z"}`),
+		"pump":        json.RawMessage(`{"type":"Relationship","value":"urn:ngsi-ld:Pump:p1"}`),
+	}
+	ld := toLDEntity(entity)
+	if string(ld["id"]) != `"urn:ngsi-ld:Sensor:s1"` {
+		t.Errorf("expected URN id, got %s", ld["id"])
+	}
+	raw, err := json.Marshal(ld)
+	if err != nil {
+		t.Fatal(err)
+	}
+	back, err := fromLDEntity(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if back.ID() != "s1" {
+		t.Errorf("expected id s1, got %s", back.ID())
+	}
+	for name, attr := range entity.Attrs() {
+		got := back.Attrs()[name]
+		if got.Type != attr.Type || compactJSON(t, got.Value) != compactJSON(t, attr.Value) {
+			t.Errorf("attribute %s: expected %s %s, got %s %s", name, attr.Type, attr.Value, got.Type, got.Value)
+		}
+	}
+	if compactJSON(t, back.Attrs()["temperature"].Metadata) != `{"unitCode":{"type":"Text","value":"CEL"}}` {
+		t.Errorf("expected unitCode metadata, got %s", back.Attrs()["temperature"].Metadata)
+	}
+}
+
+func TestLDSubscriptionRoundTrip(t *testing.T) {
+	for _, notification := range []models.Notification{
+		{HTTP: models.NotificationHTTP{URL: "http://cygnus:5051/notify"}},
+		{HTTPCustom: models.NotificationCustom{URL: "http://cygnus:5051/notify", Headers: map[string]string{"fiware-servicepath": "/riego"}}},
+		{MQTT: models.NotificationMQTT{URL: "mqtt://broker:1883", Topic: "sensors"}},
+	} {
+		notification.Attrs = []string{"temperature"}
+		notification.AttrsFormat = "normalized"
+		sub := models.Subscription{
+			Description: "sensors",
+			Status:      "inactive",
+			Subject: models.Subject{
+				Entities:  []models.SubjectEntity{{ID: "s1", Type: "Sensor"}},
+				Condition: models.SubjectCondition{Attrs: []string{"temperature"}},
+			},
+			Notification: notification,
+		}
+		ld, err := toLDSubscription(sub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ld.Entities[0].ID != "urn:ngsi-ld:Sensor:s1" || ld.IsActive == nil || *ld.IsActive {
+			t.Errorf("unexpected LD subscription %+v", ld)
+		}
+		got, err := json.Marshal(fromLDSubscription(ld))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, _ := json.Marshal(sub)
+		if string(got) != string(want) {
+			t.Errorf("expected %s, got %s", want, got)
+		}
+	}
+}
+
+func TestLDSubscriptionUnsupported(t *testing.T) {
+	for name, notification := range map[string]models.Notification{
+		"exceptAttrs":    {ExceptAttrs: []string{"a"}, HTTP: models.NotificationHTTP{URL: "http://a"}},
+		"custom payload": {HTTPCustom: models.NotificationCustom{URL: "http://a", Method: "PUT"}},
+		"no endpoint":    {},
+	} {
+		if _, err := toLDSubscription(models.Subscription{Notification: notification}); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestLDDialect(t *testing.T) {
+	platform := fakeplatform.New()
+	defer platform.Close()
+	selected := platform.Config("/riego")
+	api, err := NewDialect(selected.OrionURL, NGSILD, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers := platform.Headers("/riego")
+	entity := Entity{
+		"id":          json.RawMessage(`"s1"`),
+		"type":        json.RawMessage(`"Sensor"`),
+		"temperature": json.RawMessage(`{"type":"Number","value":20}`),
+	}
+	if err := api.UpdateEntities(http.DefaultClient, headers, []Entity{entity}, 10, false); err != nil {
+		t.Fatal(err)
+	}
+	_, entities, err := api.Entities(http.DefaultClient, headers, "", "Sensor", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entities) != 1 || entities[0].ID != "s1" || string(entities[0].Attrs["temperature"]) != "20" {
+		t.Errorf("expected entity s1 in NGSIv2 format, got %+v", entities)
+	}
+
+	sub := models.Subscription{
+		Description: "sensors",
+		Subject: models.Subject{
+			Entities: []models.SubjectEntity{{IdPattern: ".*", Type: "Sensor"}},
+		},
+		Notification: models.Notification{
+			Attrs: []string{"temperature"},
+			HTTP:  models.NotificationHTTP{URL: "LASTDATA"},
+		},
+	}
+	endpoints := map[string]string{"LASTDATA": "http://cygnus:5051/notify"}
+	if err := api.PostSuscriptions(http.DefaultClient, headers, []models.Subscription{sub}, endpoints, true); err != nil {
+		t.Fatal(err)
+	}
+	subs, err := api.Subscriptions(http.DefaultClient, headers, endpoints)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subs) != 1 || subs[0].Description != "sensors" || subs[0].Status != "active" || subs[0].Notification.HTTP.URL != "LASTDATA" {
+		t.Errorf("expected the subscription in NGSIv2 format, got %+v", subs)
+	}
+
+	if _, err := NewDialect(selected.OrionURL, "v3", ""); err == nil {
+		t.Error("expected unknown dialects to fail")
+	}
+}
+
+func compactJSON(t *testing.T, raw json.RawMessage) string {
+	t.Helper()
+	var value any
+	if err := json.Unmarshal(raw, &value); err != nil {
+		t.Fatalf("invalid json %s: %v", raw, err)
+	}
+	compact, _ := json.Marshal(value)
+	return string(compact)
+}
@@ -5,19 +5,26 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
+	"maps"
 	"net/http"
 	"net/url"
+	"regexp"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/warpcomdev/fiware/keystone"
 	"github.com/warpcomdev/fiware/models"
+	"github.com/warpcomdev/fiware/serialize"
 )
 
 // Orion manages connection to the Context Broker
 type Orion struct {
 	URL                *url.URL
 	AllowUnknownFields bool
+	LD                 bool   // speak NGSI-LD instead of NGSIv2
+	LDContext          string // @context for NGSI-LD requests
 }
 
 const defaultBatchSize = 50
@@ -50,14 +57,10 @@ func simplifyEndpoint(ep string) string {
 
 // Subscriptions reads the list of suscriptions from the Context Broker
 func (o *Orion) Subscriptions(client keystone.HTTPClient, headers http.Header, notifEndpoints map[string]string) ([]models.Subscription, error) {
-	path, err := o.URL.Parse("v2/subscriptions")
+	subs, err := o.readSubscriptions(client, headers)
 	if err != nil {
 		return nil, err
 	}
-	pages := keystone.NewPaginator(make([]models.Subscription, 0, 50))
-	if err := keystone.GetPaginatedJSON(client, headers, path, pages, o.AllowUnknownFields, 0); err != nil {
-		return nil, err
-	}
 	reverseEndpoints := make(map[string]string, len(notifEndpoints))
 	for k, v := range notifEndpoints {
 		reverseEndpoints[v] = k
@@ -76,14 +79,14 @@ func (o *Orion) Subscriptions(client keystone.HTTPClient, headers http.Header, n
 			*url = simplified
 		}
 	}
-	for idx, sub := range pages.Slice {
+	for idx, sub := range subs {
 		simplify(sub.Notification.HTTP.IsZero(), &sub.Notification.HTTP.URL)
 		simplify(sub.Notification.HTTPCustom.IsZero(), &sub.Notification.HTTPCustom.URL)
 		simplify(sub.Notification.MQTT.IsZero(), &sub.Notification.MQTT.URL)
 		simplify(sub.Notification.MQTTCustom.IsZero(), &sub.Notification.MQTTCustom.URL)
-		pages.Slice[idx] = sub
+		subs[idx] = sub
 	}
-	return pages.Slice, nil
+	return subs, nil
 }
 
 // Turns a list of subscriptions into a map indexed by description
@@ -110,7 +113,11 @@ func SubsMap(subs []models.Subscription) map[string]models.Subscription {
 
 // Suscriptions reads the list of suscriptions from the Context Broker
 func (o *Orion) Registrations(client keystone.HTTPClient, headers http.Header) ([]models.Registration, error) {
-	path, err := o.URL.Parse("v2/registrations")
+	if o.LD {
+		log.Print("Registrations are not supported for NGSI-LD brokers, skipping")
+		return nil, nil
+	}
+	path, err := o.registrationURL("")
 	if err != nil {
 		return nil, err
 	}
@@ -121,6 +128,133 @@ func (o *Orion) Registrations(client keystone.HTTPClient, headers http.Header) (
 	return pages.Slice, nil
 }
 
+// errLDRegistrations is returned when managing registrations in NGSI-LD brokers
+var errLDRegistrations = errors.New("registrations are not supported for NGSI-LD brokers")
+
+// registrationURL returns the URL of the registration with the
+// given id, or of the registrations collection if id is empty.
+func (o *Orion) registrationURL(id string) (*url.URL, error) {
+	if id != "" {
+		return o.URL.Parse(fmt.Sprintf("v2/registrations/%s", id))
+	}
+	return o.URL.Parse("v2/registrations")
+}
+
+// PostRegistrations posts a list of registrations to orion. If useDescription
+// is true, fails when there is already a registration with the same description.
+func (o *Orion) PostRegistrations(client keystone.HTTPClient, headers http.Header, regs []models.Registration, useDescription bool) error {
+	if o.LD {
+		return errLDRegistrations
+	}
+	var errList []error
+	if useDescription {
+		// Check there is not a registration with the same description
+		allRegs, err := o.Registrations(client, headers)
+		if err != nil {
+			return err
+		}
+		descId := make(map[string]string, len(allRegs))
+		for _, reg := range allRegs {
+			if reg.Description != "" {
+				descId[reg.Description] = reg.ID
+			}
+		}
+		for _, reg := range regs {
+			if _, ok := descId[reg.Description]; ok && reg.Description != "" {
+				errList = append(errList, fmt.Errorf("registration with description %s already exists", reg.Description))
+			}
+		}
+		if errList != nil {
+			return errors.Join(errList...)
+		}
+	}
+	path, err := o.registrationURL("")
+	if err != nil {
+		return err
+	}
+	for _, reg := range regs {
+		// The ID is assigned by orion, it must not be part of the payload
+		payload := struct {
+			Description  string          `json:"description,omitempty"`
+			DataProvided json.RawMessage `json:"dataProvided,omitempty"`
+			Provider     json.RawMessage `json:"provider,omitempty"`
+			Status       string          `json:"status,omitempty"`
+		}{
+			Description:  reg.Description,
+			DataProvided: reg.DataProvided,
+			Provider:     reg.Provider,
+			Status:       reg.Status,
+		}
+		if _, _, err := keystone.Update(client, http.MethodPost, headers, path, payload); err != nil {
+			errList = append(errList, err)
+		}
+	}
+	return errors.Join(errList...)
+}
+
+// DeleteRegistrations deletes a list of registrations from orion. If
+// useDescription is true, registrations without ID, or whose ID is not
+// found, are matched by description.
+func (o *Orion) DeleteRegistrations(client keystone.HTTPClient, headers http.Header, regs []models.Registration, useDescription bool) error {
+	if o.LD {
+		return errLDRegistrations
+	}
+	// Check every registration before deleting any
+	for _, reg := range regs {
+		if reg.ID == "" && (!useDescription || reg.Description == "") {
+			return errors.New("all registrations must have an ID")
+		}
+	}
+	var errList []error
+	byDescription := make(map[string]struct{})
+	for _, reg := range regs {
+		if reg.ID == "" {
+			byDescription[reg.Description] = struct{}{}
+			continue
+		}
+		path, err := o.registrationURL(reg.ID)
+		if err != nil {
+			return err
+		}
+		if _, err := keystone.Query(client, http.MethodDelete, headers, path, nil, false); err != nil {
+			var netErr keystone.NetError
+			if useDescription && reg.Description != "" && errors.As(err, &netErr) && netErr.StatusCode == http.StatusNotFound {
+				byDescription[reg.Description] = struct{}{}
+			} else {
+				errList = append(errList, err)
+			}
+		}
+	}
+	if len(byDescription) <= 0 {
+		return errors.Join(errList...)
+	}
+	// Match the remaining registrations by description
+	allRegs, err := o.Registrations(client, headers)
+	if err != nil {
+		errList = append(errList, err)
+		return errors.Join(errList...)
+	}
+	found := make(map[string]struct{}, len(byDescription))
+	for _, reg := range allRegs {
+		if _, ok := byDescription[reg.Description]; ok && reg.Description != "" {
+			path, err := o.registrationURL(reg.ID)
+			if err != nil {
+				return err
+			}
+			if _, err := keystone.Query(client, http.MethodDelete, headers, path, nil, false); err != nil {
+				errList = append(errList, err)
+			}
+			found[reg.Description] = struct{}{}
+		}
+	}
+	for description := range byDescription {
+		if _, ok := found[description]; !ok {
+			log.Printf("registration with description %s not found, skipping", description)
+		}
+	}
+	return errors.Join(errList...)
+}
+
 // PostSuscriptions posts a list of suscriptions to orion
 func (o *Orion) PostSuscriptions(client keystone.HTTPClient, headers http.Header, subs []models.Subscription, ep map[string]string, useDescription bool) error {
 	var errList []error
@@ -155,18 +289,14 @@ func (o *Orion) PostSuscriptions(client keystone.HTTPClient, headers http.Header
 	for _, sub := range subs {
 		sub.SubscriptionStatus = models.SubscriptionStatus{}
 		sub.Notification.NotificationStatus = models.NotificationStatus{}
-		path, err := o.URL.Parse("v2/subscriptions")
-		if err != nil {
-			return err
-		}
 		if sub.Notification.AttrsFormat == "" {
 			sub.Notification.AttrsFormat = "normalized"
 		}
-		sub, err = sub.UpdateEndpoint(ep)
+		sub, err := sub.UpdateEndpoint(ep)
 		if err != nil {
 			errList = append(errList, err)
 		} else {
-			if _, _, err := keystone.Update(client, http.MethodPost, headers, path, sub); err != nil {
+			if err := o.sendSubscription(client, headers, http.MethodPost, "", sub); err != nil {
 				errList = append(errList, err)
 			}
 		}
@@ -190,11 +320,11 @@ func (o *Orion) DeleteSuscriptions(client keystone.HTTPClient, headers http.Head
 			// skip the current sub, go to "byDescription"
 			continue
 		}
-		path, err := o.URL.Parse(fmt.Sprintf("v2/subscriptions/%s", sub.ID))
+		path, err := o.subscriptionURL(sub.ID)
 		if err != nil {
 			return err
 		}
-		if _, err := keystone.Query(client, http.MethodDelete, headers, path, nil, false); err != nil {
+		if _, err := keystone.Query(client, http.MethodDelete, o.headers(headers), path, nil, false); err != nil {
 			var netErr keystone.NetError
 			if useDescription && errors.As(err, &netErr) {
 				if netErr.StatusCode == 404 {
@@ -221,11 +351,11 @@ func (o *Orion) DeleteSuscriptions(client keystone.HTTPClient, headers http.Head
 	for _, sub := range allSubs {
 		if sub.Description != "" {
 			if _, ok := byDescription[sub.Description]; ok {
-				path, err := o.URL.Parse(fmt.Sprintf("v2/subscriptions/%s", sub.ID))
+				path, err := o.subscriptionURL(sub.ID)
 				if err != nil {
 					return err
 				}
-				if _, err := keystone.Query(client, http.MethodDelete, headers, path, nil, false); err != nil {
+				if _, err := keystone.Query(client, http.MethodDelete, o.headers(headers), path, nil, false); err != nil {
 					errList = append(errList, err)
 				}
 			}
@@ -234,6 +364,59 @@ func (o *Orion) DeleteSuscriptions(client keystone.HTTPClient, headers http.Head
 	return errors.Join(errList...)
 }
 
+// UpdateSubscriptions patches existing subscriptions in Orion, keeping their IDs.
+// Subscriptions are matched by ID, or by description if useDescription is true.
+// Returns the list of subscriptions that did not match any existing one.
+func (o *Orion) UpdateSubscriptions(client keystone.HTTPClient, headers http.Header, subs []models.Subscription, ep map[string]string, useDescription bool) ([]models.Subscription, error) {
+	epCopy := make(map[string]string, len(ep))
+	for k, v := range ep {
+		epCopy[k] = v
+	}
+	allSubs, err := o.Subscriptions(client, headers, epCopy)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]struct{}, len(allSubs))
+	descId := make(map[string]string, len(allSubs))
+	for _, sub := range allSubs {
+		byID[sub.ID] = struct{}{}
+		if sub.Description != "" {
+			descId[sub.Description] = sub.ID
+		}
+	}
+	var (
+		errList   []error
+		unmatched []models.Subscription
+	)
+	for _, sub := range subs {
+		id := ""
+		if _, ok := byID[sub.ID]; ok && sub.ID != "" {
+			id = sub.ID
+		} else if useDescription && sub.Description != "" {
+			id = descId[sub.Description]
+		}
+		if id == "" {
+			unmatched = append(unmatched, sub)
+			continue
+		}
+		// The ID must not be part of the payload
+		sub.SubscriptionStatus = models.SubscriptionStatus{}
+		sub.Notification.NotificationStatus = models.NotificationStatus{}
+		if sub.Notification.AttrsFormat == "" {
+			sub.Notification.AttrsFormat = "normalized"
+		}
+		sub, err = sub.UpdateEndpoint(ep)
+		if err != nil {
+			errList = append(errList, err)
+			continue
+		}
+		if err := o.sendSubscription(client, headers, http.MethodPatch, id, sub); err != nil {
+			errList = append(errList, err)
+		}
+	}
+	return unmatched, errors.Join(errList...)
+}
+
 // Entity representa una entidad tal como la ve la API
 type Entity map[string]json.RawMessage
 
@@ -261,6 +444,35 @@ func (e Entity) Attrs() map[string]EntityAttr {
 	return attrs
 }
 
+// Serialize implements serialize.Serializable. Writes the id and type,
+// followed by all the other attributes sorted by name.
+func (e Entity) Serialize(s serialize.Serializer) {
+	s.KeyString("id", e.ID())
+	s.KeyString("type", e.Type())
+	for _, name := range slices.Sorted(maps.Keys(e)) {
+		if name != "id" && name != "type" {
+			s.KeyRaw(name, e[name], true)
+		}
+	}
+}
+
+// KeyValues returns a copy of the entity with only the
+// value of each attribute, without type and metadata.
+func (e Entity) KeyValues() Entity {
+	result := make(Entity, len(e))
+	for name, raw := range e {
+		if name == "id" || name == "type" {
+			result[name] = raw
+			continue
+		}
+		var attr EntityAttr
+		if err := json.Unmarshal(raw, &attr); err == nil && attr.Value != nil {
+			result[name] = attr.Value
+		}
+	}
+	return result
+}
+
 type EntityAttr struct {
 	Type     string          `json:"type"`
 	Value    json.RawMessage `json:"value"`
@@ -393,11 +605,15 @@ func (p *entityPaginator) Append(raw json.RawMessage) error {
 	return nil
 }
 
-// Entities reads the list of entities from the Context Broker
-func (o *Orion) Entities(client keystone.HTTPClient, headers http.Header, idPattern string, entityType string, simpleQuery string, maximum int) ([]models.EntityType, []models.Entity, error) {
-	path, err := o.URL.Parse("v2/entities")
+// entitiesURL builds the v2/entities path with the given filters
+func (o *Orion) entitiesURL(idPattern string, entityType string, simpleQuery string) (*url.URL, error) {
+	base := "v2/entities"
+	if o.LD {
+		base = "ngsi-ld/v1/entities"
+	}
+	path, err := o.URL.Parse(base)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 	// If filtered, add parameters
 	if idPattern != "" || entityType != "" || simpleQuery != "" {
@@ -413,16 +629,109 @@ func (o *Orion) Entities(client keystone.HTTPClient, headers http.Header, idPatt
 		}
 		path.RawQuery = values.Encode()
 	}
+	return path, nil
+}
+
+// Entities reads the list of entities from the Context Broker
+func (o *Orion) Entities(client keystone.HTTPClient, headers http.Header, idPattern string, entityType string, simpleQuery string, maximum int) ([]models.EntityType, []models.Entity, error) {
+	path, err := o.entitiesURL(idPattern, entityType, simpleQuery)
+	if err != nil {
+		return nil, nil, err
+	}
 	pages := keystone.NewPaginator(make([]Entity, 0, 50))
-	if err := keystone.GetPaginatedJSON(client, headers, path, pages, o.AllowUnknownFields, maximum); err != nil {
+	if err := o.queryEntities(client, headers, path, pages, maximum); err != nil {
 		return nil, nil, err
 	}
 	t, e := Split(pages.Slice)
 	return t, e, nil
 }
 
-// UpdateEntities updates a list of entities
+// entityStream is a Paginator that hands over each entity as soon as it is read
+type entityStream func(Entity) error
+
+// Append implements Paginator
+func (s entityStream) Append(raw json.RawMessage, allowUnknownFields bool) error {
+	var ent Entity
+	if err := json.Unmarshal(raw, &ent); err != nil {
+		return fmt.Errorf("failed to decode entity from %s: %w", string(raw), err)
+	}
+	return s(ent)
+}
+
+// StreamEntities reads entities from the Context Broker page by page, calling
+// handle for each entity as it arrives, instead of keeping them in memory.
+// Stops at the first error returned by handle.
+func (o *Orion) StreamEntities(client keystone.HTTPClient, headers http.Header, idPattern string, entityType string, simpleQuery string, maximum int, handle func(Entity) error) error {
+	path, err := o.entitiesURL(idPattern, entityType, simpleQuery)
+	if err != nil {
+		return err
+	}
+	return o.queryEntities(client, headers, path, entityStream(handle), maximum)
+}
+
+// entityTypeInfo is the summary of an entity type returned by v2/types
+type entityTypeInfo struct {
+	Type  string `json:"type"`
+	Attrs map[string]struct {
+		Types []string `json:"types"`
+	} `json:"attrs"`
+	Count int `json:"count"`
+}
+
+// AttrTypes reads the names and types of the attributes of an entity type
+// from v2/types. If entityType is empty, attributes of all types are
+// returned. When an attribute has several types, the first one is kept.
+func (o *Orion) AttrTypes(client keystone.HTTPClient, headers http.Header, entityType string) (map[string]string, error) {
+	if o.LD {
+		return o.ldAttrTypes(client, headers, entityType)
+	}
+	path, err := o.URL.Parse("v2/types")
+	if err != nil {
+		return nil, err
+	}
+	pages := keystone.NewPaginator(make([]entityTypeInfo, 0, 16))
+	if err := keystone.GetPaginatedJSON(client, headers, path, pages, true, 0); err != nil {
+		return nil, fmt.Errorf("while reading entity types: %w", err)
+	}
+	result := make(map[string]string)
+	for _, info := range pages.Slice {
+		if entityType != "" && info.Type != entityType {
+			continue
+		}
+		for name, attr := range info.Attrs {
+			if _, found := result[name]; !found && len(attr.Types) > 0 {
+				result[name] = attr.Types[0]
+			}
+		}
+	}
+	return result, nil
+}
+
+// UpdateMode is the actionType used to update entities
+type UpdateMode string
+
+const (
+	ModeAppend       UpdateMode = "append"       // create entities and attributes, or update them
+	ModeAppendStrict UpdateMode = "appendStrict" // create entities and attributes, fail if they exist
+	ModeUpdate       UpdateMode = "update"       // update existing attributes, fail if they don't exist
+	ModeReplace      UpdateMode = "replace"      // replace all attributes of existing entities
+	ModeAuto         UpdateMode = "auto"         // choose one of the above per entity, see UpsertEntities
+)
+
+// UpdateModes lists all the supported modes
+var UpdateModes = []UpdateMode{ModeAppend, ModeAppendStrict, ModeUpdate, ModeReplace, ModeAuto}
+
+// UpdateEntities updates a list of entities, with actionType append
 func (o *Orion) UpdateEntities(client keystone.HTTPClient, headers http.Header, ents []Entity, batchSize int, overrideMetadata bool) error {
+	return o.UpdateEntitiesMode(client, headers, ents, batchSize, overrideMetadata, ModeAppend)
+}
+
+// UpdateEntitiesMode updates a list of entities with the given actionType.
+// ModeAuto is not an actionType, use UpsertEntities instead.
+func (o *Orion) UpdateEntitiesMode(client keystone.HTTPClient, headers http.Header, ents []Entity, batchSize int, overrideMetadata bool, mode UpdateMode) error {
+	if mode == ModeAuto {
+		return errors.New("auto mode is not an actionType")
+	}
 	if batchSize <= 0 {
 		batchSize = defaultBatchSize
 	}
@@ -431,32 +740,189 @@ func (o *Orion) UpdateEntities(client keystone.HTTPClient, headers http.Header,
 			// Wait for a timeout, for safety's sake
 			<-time.After(3 * time.Second)
 		}
-		req := struct {
-			ActionType string   `json:"actionType"`
-			Entities   []Entity `json:"entities"`
-		}{
-			ActionType: "append",
-			Entities:   make([]Entity, 0, len(ents)),
-		}
 		top := len(ents)
 		if top >= base+batchSize {
 			top = base + batchSize
 		}
-		req.Entities = append(req.Entities, ents[base:top]...)
-		path, err := o.URL.Parse("v2/op/update")
-		if err != nil {
+		if err := o.updateBatch(client, headers, ents[base:top], overrideMetadata, mode); err != nil {
 			return err
 		}
-		if overrideMetadata {
+	}
+	return nil
+}
+
+// updateBatch sends a single request to v2/op/update
+func (o *Orion) updateBatch(client keystone.HTTPClient, headers http.Header, ents []Entity, overrideMetadata bool, mode UpdateMode) error {
+	if o.LD {
+		return o.ldUpdateBatch(client, headers, ents, mode)
+	}
+	req := struct {
+		ActionType string   `json:"actionType"`
+		Entities   []Entity `json:"entities"`
+	}{
+		ActionType: string(mode),
+		Entities:   ents,
+	}
+	path, err := o.URL.Parse("v2/op/update")
+	if err != nil {
+		return err
+	}
+	if overrideMetadata {
+		values := path.Query()
+		values.Add("options", "overrideMetadata")
+		path.RawQuery = values.Encode()
+	}
+	_, _, err = keystone.Update(client, http.MethodPost, headers, path, req)
+	return err
+}
+
+// entityKey identifies an entity
+type entityKey struct {
+	Type string
+	ID   string
+}
+
+// maxIDListLength bounds the length of the id list sent in each query
+// of existingAttrs, to keep URLs below the limits of Orion and proxies.
+const maxIDListLength = 2048
+
+// idChunks splits the ids in lists of at most size items, and at most
+// maxIDListLength characters when joined with commas. IDs with commas
+// cannot be part of a list, so each one gets a chunk of its own.
+func idChunks(ids []string, size int) [][]string {
+	chunks := make([][]string, 0, len(ids)/max(size, 1)+1)
+	current, length := make([]string, 0, size), 0
+	flush := func() {
+		if len(current) > 0 {
+			chunks = append(chunks, current)
+			current, length = make([]string, 0, size), 0
+		}
+	}
+	for _, id := range ids {
+		if strings.Contains(id, ",") {
+			chunks = append(chunks, []string{id})
+			continue
+		}
+		if len(current) >= size || (len(current) > 0 && length+1+len(id) > maxIDListLength) {
+			flush()
+		}
+		if len(current) > 0 {
+			length += 1
+		}
+		current = append(current, id)
+		length += len(id)
+	}
+	flush()
+	return chunks
+}
+
+// existingAttrs reads the attribute names of the entities that exist in Orion
+func (o *Orion) existingAttrs(client keystone.HTTPClient, headers http.Header, ents []Entity, batchSize int) (map[entityKey]map[string]struct{}, error) {
+	byType := make(map[string][]string)
+	for _, ent := range ents {
+		byType[ent.Type()] = append(byType[ent.Type()], o.entityID(ent.Type(), ent.ID()))
+	}
+	result := make(map[entityKey]map[string]struct{}, len(ents))
+	for entityType, ids := range byType {
+		for _, chunk := range idChunks(ids, batchSize) {
+			path, err := o.entitiesURL("", entityType, "")
+			if err != nil {
+				return nil, err
+			}
 			values := path.Query()
-			values.Add("options", "overrideMetadata")
+			if len(chunk) == 1 && strings.Contains(chunk[0], ",") {
+				values.Add("idPattern", "^"+regexp.QuoteMeta(chunk[0])+"$")
+			} else {
+				values.Add("id", strings.Join(chunk, ","))
+			}
 			path.RawQuery = values.Encode()
+			pages := keystone.NewPaginator(make([]Entity, 0, len(chunk)))
+			if err := o.queryEntities(client, headers, path, pages, 0); err != nil {
+				return nil, err
+			}
+			for _, current := range pages.Slice {
+				attrs := make(map[string]struct{}, len(current))
+				for name := range current.Attrs() {
+					attrs[name] = struct{}{}
+				}
+				result[entityKey{Type: current.Type(), ID: current.ID()}] = attrs
+			}
 		}
-		if _, _, err := keystone.Update(client, http.MethodPost, headers, path, req); err != nil {
-			return err
+	}
+	return result, nil
+}
+
+// autoMode chooses the actionType for the entity, given the attributes
+// it currently has in Orion (nil if the entity does not exist).
+func autoMode(ent Entity, existing map[string]struct{}) UpdateMode {
+	if existing == nil {
+		return ModeAppendStrict
+	}
+	attrs := ent.Attrs()
+	for name := range existing {
+		if _, ok := attrs[name]; !ok {
+			return ModeReplace
 		}
 	}
-	return nil
+	for name := range attrs {
+		if _, ok := existing[name]; !ok {
+			return ModeAppend
+		}
+	}
+	return ModeUpdate
+}
+
+// UpsertResult describes the actionType used for an entity in UpsertEntities
+type UpsertResult struct {
+	Type   string
+	ID     string
+	Action UpdateMode
+	Err    error
+}
+
+// UpsertEntities reads the entities from Orion and, for each one, chooses
+// the actionType: appendStrict if the entity does not exist, replace if
+// it has attributes that are not in the list, append if it lacks some
+// of the attributes, update otherwise.
+func (o *Orion) UpsertEntities(client keystone.HTTPClient, headers http.Header, ents []Entity, batchSize int, overrideMetadata bool) ([]UpsertResult, error) {
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+	existing, err := o.existingAttrs(client, headers, ents, batchSize)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]UpsertResult, 0, len(ents))
+	byMode := make(map[UpdateMode][]int)
+	for _, ent := range ents {
+		mode := autoMode(ent, existing[entityKey{Type: ent.Type(), ID: ent.ID()}])
+		byMode[mode] = append(byMode[mode], len(results))
+		results = append(results, UpsertResult{Type: ent.Type(), ID: ent.ID(), Action: mode})
+	}
+	var errList []error
+	batches := 0
+	for _, mode := range UpdateModes {
+		indexes := byMode[mode]
+		for base := 0; base < len(indexes); base += batchSize {
+			if batches > 0 {
+				// Wait for a timeout, for safety's sake
+				<-time.After(3 * time.Second)
+			}
+			batches += 1
+			top := min(len(indexes), base+batchSize)
+			batch := make([]Entity, 0, top-base)
+			for _, index := range indexes[base:top] {
+				batch = append(batch, ents[index])
+			}
+			if err := o.updateBatch(client, headers, batch, overrideMetadata, mode); err != nil {
+				for _, index := range indexes[base:top] {
+					results[index].Err = err
+				}
+				errList = append(errList, fmt.Errorf("while sending %s batch: %w", mode, err))
+			}
+		}
+	}
+	return results, errors.Join(errList...)
 }
 
 // DeleteEntities deletes a list of entities from Orion
@@ -487,6 +953,16 @@ func (o *Orion) DeleteEntities(client keystone.HTTPClient, headers http.Header,
 				Type: e.Type,
 			})
 		}
+		if o.LD {
+			ids := make([]string, 0, len(req.Entities))
+			for _, e := range req.Entities {
+				ids = append(ids, ldEntityID(e.Type, e.ID))
+			}
+			if err := o.ldOperation(client, headers, "delete", "", ids); err != nil {
+				lastError = err // keep trying!
+			}
+			continue
+		}
 		path, err := o.URL.Parse("v2/op/update")
 		if err != nil {
 			return err
@@ -497,3 +973,51 @@ func (o *Orion) DeleteEntities(client keystone.HTTPClient, headers http.Header,
 	}
 	return lastError
 }
+
+// DeleteAttributes deletes attributes from a list of entities, in batches.
+// Only the names of the attributes in each entity are used, so that each
+// entity can list just the attributes it actually has: orion fails
+// the whole batch if any of the attributes does not exist.
+func (o *Orion) DeleteAttributes(client keystone.HTTPClient, headers http.Header, ents []models.Entity, batchSize int) error {
+	if o.LD {
+		return o.ldDeleteAttributes(client, headers, ents)
+	}
+	var lastError error
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+	path, err := o.URL.Parse("v2/op/update")
+	if err != nil {
+		return err
+	}
+	for base := 0; base < len(ents); base += batchSize {
+		top := min(base+batchSize, len(ents))
+		req := struct {
+			ActionType string                       `json:"actionType"`
+			Entities   []map[string]json.RawMessage `json:"entities"`
+		}{
+			ActionType: "delete",
+			Entities:   make([]map[string]json.RawMessage, 0, top-base),
+		}
+		for _, e := range ents[base:top] {
+			if len(e.Attrs) <= 0 {
+				// No attributes would delete the whole entity
+				continue
+			}
+			item := make(map[string]json.RawMessage, len(e.Attrs)+2)
+			for name := range e.Attrs {
+				item[name] = json.RawMessage(`{}`)
+			}
+			item["id"], _ = json.Marshal(e.ID)
+			item["type"], _ = json.Marshal(e.Type)
+			req.Entities = append(req.Entities, item)
+		}
+		if len(req.Entities) <= 0 {
+			continue
+		}
+		if _, _, err := keystone.Update(client, http.MethodPost, headers, path, req); err != nil {
+			lastError = err // keep trying!
+		}
+	}
+	return lastError
+}
@@ -0,0 +1,80 @@
+package orion
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/warpcomdev/fiware/internal/fakeplatform"
+)
+
+func TestIDChunks(t *testing.T) {
+	long := strings.Repeat("x", maxIDListLength/2)
+	for _, tc := range []struct {
+		name   string
+		ids    []string
+		size   int
+		chunks []int
+	}{
+		{name: "by size", ids: []string{"a", "b", "c", "d", "e"}, size: 2, chunks: []int{2, 2, 1}},
+		{name: "by length", ids: []string{long, long, long}, size: 10, chunks: []int{1, 1, 1}},
+		{name: "ids with commas", ids: []string{"a", "b,c", "d"}, size: 10, chunks: []int{1, 2}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			chunks := idChunks(tc.ids, tc.size)
+			sizes := make([]int, 0, len(chunks))
+			for _, chunk := range chunks {
+				sizes = append(sizes, len(chunk))
+				if joined := strings.Join(chunk, ","); len(chunk) > 1 && len(joined) > maxIDListLength {
+					t.Errorf("chunk too long: %d", len(joined))
+				}
+			}
+			if fmt.Sprint(sizes) != fmt.Sprint(tc.chunks) {
+				t.Errorf("expected chunk sizes %v, got %v", tc.chunks, sizes)
+			}
+		})
+	}
+}
+
+func TestExistingAttrs(t *testing.T) {
+	platform := fakeplatform.New()
+	defer platform.Close()
+	api, err := New(platform.Config("/riego").OrionURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []string{"with,comma"}
+	for i := range 100 {
+		ids = append(ids, fmt.Sprintf("%s%03d", strings.Repeat("s", 60), i))
+	}
+	ents := make([]Entity, 0, len(ids)+1)
+	for _, id := range ids {
+		raw := fmt.Sprintf(`{"id":%q,"type":"Sensor","temperature":{"type":"Number","value":20}}`, id)
+		if err := platform.AddEntity("/riego", json.RawMessage(raw)); err != nil {
+			t.Fatal(err)
+		}
+		var ent Entity
+		if err := json.Unmarshal([]byte(raw), &ent); err != nil {
+			t.Fatal(err)
+		}
+		ents = append(ents, ent)
+	}
+	var missing Entity
+	if err := json.Unmarshal([]byte(`{"id":"missing","type":"Sensor"}`), &missing); err != nil {
+		t.Fatal(err)
+	}
+	ents = append(ents, missing)
+
+	existing, err := api.existingAttrs(http.DefaultClient, platform.Headers("/riego"), ents, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(existing) != len(ids) {
+		t.Errorf("expected %d existing entities, got %d", len(ids), len(existing))
+	}
+	if _, ok := existing[entityKey{Type: "Sensor", ID: "with,comma"}]["temperature"]; !ok {
+		t.Errorf("expected the entity with a comma in the ID, got %v", existing[entityKey{Type: "Sensor", ID: "with,comma"}])
+	}
+}
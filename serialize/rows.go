@@ -0,0 +1,203 @@
+package serialize
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// RowFormat selects how RowSerializer writes each row
+type RowFormat int
+
+const (
+	JSONLines RowFormat = iota // one compact JSON object per line
+	CSV                        // one CSV record per line, with a header
+)
+
+var errNestedRow = errors.New("nested blocks and lists are not supported in rows")
+
+// RowSerializer writes each top level block as a single row, as soon as
+// the block ends. It is meant for streaming formats such as JSON Lines
+// or CSV, where items are written one by one instead of as a whole
+// document. Nested blocks and lists are not supported, complex values
+// must be provided with KeyRaw.
+type RowSerializer struct {
+	Writer  Writer
+	Format  RowFormat
+	Columns []string // CSV only, keys to write in each record
+	Header  []string // CSV only, first record. Defaults to Columns.
+	Err     error
+	depth   int
+	keys    []string
+	values  []json.RawMessage
+	csv     *csv.Writer
+}
+
+// NewJSONLines creates a serializer that writes a JSON object per line
+func NewJSONLines(w Writer) *RowSerializer {
+	return &RowSerializer{Writer: w, Format: JSONLines}
+}
+
+// NewCSV creates a serializer that writes a CSV record per row, with the
+// values of the given columns. String values are written without quotes,
+// any other value is written as JSON. Missing values are left empty.
+func NewCSV(w Writer, columns, header []string) *RowSerializer {
+	return &RowSerializer{Writer: w, Format: CSV, Columns: columns, Header: header}
+}
+
+func (r *RowSerializer) keyValue(k string, v json.RawMessage) {
+	if r.Err != nil {
+		return
+	}
+	if r.depth != 1 {
+		r.Err = errNestedRow
+		return
+	}
+	r.keys = append(r.keys, k)
+	r.values = append(r.values, v)
+}
+
+func (r *RowSerializer) marshal(k string, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		r.Err = err
+		return
+	}
+	r.keyValue(k, data)
+}
+
+// KeyString implements Serializer
+func (r *RowSerializer) KeyString(k, v string) {
+	r.marshal(k, v)
+}
+
+// String implements Serializer
+func (r *RowSerializer) String(v string, compact bool) {
+	r.Err = errNestedRow
+}
+
+// KeyInt implements Serializer
+func (r *RowSerializer) KeyInt(k string, v int) {
+	r.marshal(k, v)
+}
+
+// KeyFloat implements Serializer
+func (r *RowSerializer) KeyFloat(k string, v float64) {
+	r.marshal(k, v)
+}
+
+// KeyBool implements Serializer
+func (r *RowSerializer) KeyBool(k string, v bool) {
+	r.marshal(k, v)
+}
+
+// KeyRaw implements Serializer. Values are always compacted.
+func (r *RowSerializer) KeyRaw(k string, v json.RawMessage, compact bool) {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, v); err != nil {
+		r.Err = fmt.Errorf("while compacting %s: %w", k, err)
+		return
+	}
+	r.keyValue(k, buf.Bytes())
+}
+
+// BeginBlock starts a new row
+func (r *RowSerializer) BeginBlock(optionalTitle string) {
+	if r.Err != nil {
+		return
+	}
+	if r.depth != 0 {
+		r.Err = errNestedRow
+		return
+	}
+	r.depth += 1
+	r.keys = r.keys[:0]
+	r.values = r.values[:0]
+}
+
+// EndBlock writes the current row
+func (r *RowSerializer) EndBlock() {
+	if r.Err != nil {
+		return
+	}
+	r.depth -= 1
+	switch r.Format {
+	case CSV:
+		r.Err = r.writeCSV()
+	default:
+		r.Err = r.writeJSON()
+	}
+}
+
+// BeginList implements Serializer
+func (r *RowSerializer) BeginList(optionalTitle string) {
+	r.Err = errNestedRow
+}
+
+// EndList implements Serializer
+func (r *RowSerializer) EndList() {
+	r.Err = errNestedRow
+}
+
+// Error implements Serializer
+func (r *RowSerializer) Error() error {
+	return r.Err
+}
+
+func (r *RowSerializer) writeJSON() error {
+	var buf bytes.Buffer
+	buf.WriteString("{")
+	for i, k := range r.keys {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		key, _ := json.Marshal(k)
+		buf.Write(key)
+		buf.WriteString(":")
+		buf.Write(r.values[i])
+	}
+	buf.WriteString("}\n")
+	_, err := r.Writer.Write(buf.Bytes())
+	return err
+}
+
+func (r *RowSerializer) writeCSV() error {
+	if r.csv == nil {
+		r.csv = csv.NewWriter(r.Writer)
+		header := r.Header
+		if header == nil {
+			header = r.Columns
+		}
+		if err := r.csv.Write(header); err != nil {
+			return err
+		}
+	}
+	record := make([]string, len(r.Columns))
+	for i, column := range r.Columns {
+		for j, k := range r.keys {
+			if k == column {
+				record[i] = csvValue(r.values[j])
+				break
+			}
+		}
+	}
+	if err := r.csv.Write(record); err != nil {
+		return err
+	}
+	r.csv.Flush()
+	return r.csv.Error()
+}
+
+// csvValue unquotes strings, and turns null into an empty value
+func csvValue(v json.RawMessage) string {
+	if bytes.Equal(v, []byte("null")) {
+		return ""
+	}
+	var text string
+	if len(v) > 0 && v[0] == '"' && json.Unmarshal(v, &text) == nil {
+		return text
+	}
+	return string(v)
+}